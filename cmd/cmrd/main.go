@@ -7,6 +7,7 @@ import (
 	"os/signal"
 
 	"github.com/jhonroun/cmrd/internal/cli"
+	"github.com/jhonroun/cmrd/pkg/cmrd"
 )
 
 func main() {
@@ -15,6 +16,6 @@ func main() {
 
 	if err := cli.Run(ctx, os.Args[1:]); err != nil {
 		fmt.Fprintln(os.Stderr, "error:", err)
-		os.Exit(1)
+		os.Exit(cmrd.ExitCode(err))
 	}
 }
@@ -0,0 +1,561 @@
+package aria2
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jhonroun/cmrd/internal/cloudmail"
+)
+
+const (
+	defaultPollInterval = 500 * time.Millisecond
+	defaultRPCStartWait = 5 * time.Second
+	// maxPollFailures status polls in a row may fail before RunRPC gives up;
+	// the poll interval doubles after each failure up to maxPollDelay.
+	maxPollFailures = 5
+	maxPollDelay    = 5 * time.Second
+)
+
+// ErrRPCUnavailable is returned by RunRPC when aria2c started but its JSON-RPC
+// interface could not be reached; the console mode of Run still works then.
+var ErrRPCUnavailable = errors.New("aria2c JSON-RPC interface unavailable")
+
+// Download states of FileState.
+const (
+	StateWaiting  = "waiting"
+	StateActive   = "active"
+	StateComplete = "complete"
+	StateError    = "error"
+)
+
+// FileState is the state of one file of an RPC run, as reported by aria2c.
+type FileState struct {
+	// Index is the position of the file in the list passed to RunRPC.
+	Index int
+	GID   string
+	// State is StateWaiting, StateActive, StateComplete or StateError.
+	State string
+	// TotalBytes is 0 while the size is unknown.
+	TotalBytes int64
+	DoneBytes  int64
+	// Speed is the download speed in bytes per second.
+	Speed int64
+	// Err is a *DownloadError for files in StateError.
+	Err error
+}
+
+// DownloadError reports a file aria2c failed to download in RPC mode.
+// Code is the aria2c error code, with the same meaning as its exit status.
+type DownloadError struct {
+	File    string
+	Code    int
+	Message string
+}
+
+func (e *DownloadError) Error() string {
+	return fmt.Sprintf("aria2c failed to download %s: code %d: %s", e.File, e.Code, e.Message)
+}
+
+// ExitCode returns the aria2c error code of a failed run: the exit status of
+// the process, or the code of the first failed file in RPC mode.
+func ExitCode(err error) (int, bool) {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), true
+	}
+	var downloadErr *DownloadError
+	if errors.As(err, &downloadErr) {
+		return downloadErr.Code, true
+	}
+	return 0, false
+}
+
+// RPCClient calls the JSON-RPC interface of aria2c over HTTP.
+type RPCClient struct {
+	endpoint string
+	secret   string
+	client   *http.Client
+	nextID   atomic.Int64
+}
+
+// NewRPCClient creates a client for endpoint, e.g. http://127.0.0.1:6800/jsonrpc.
+// secret is the --rpc-secret of aria2c; empty sends no token.
+func NewRPCClient(endpoint string, secret string) *RPCClient {
+	return &RPCClient{
+		endpoint: endpoint,
+		secret:   secret,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type rpcRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      string `json:"id"`
+	Method  string `json:"method"`
+	Params  []any  `json:"params"`
+}
+
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Call invokes method with params and decodes the result into result, which may be nil.
+func (c *RPCClient) Call(ctx context.Context, method string, result any, params ...any) error {
+	if c.secret != "" {
+		params = append([]any{"token:" + c.secret}, params...)
+	}
+	if params == nil {
+		params = []any{}
+	}
+	payload, err := json.Marshal(rpcRequest{
+		JSONRPC: "2.0",
+		ID:      strconv.FormatInt(c.nextID.Add(1), 10),
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var decoded rpcResponse
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return fmt.Errorf("%s: http status %d: %w", method, resp.StatusCode, err)
+	}
+	if decoded.Error != nil {
+		return fmt.Errorf("%s: rpc error %d: %s", method, decoded.Error.Code, decoded.Error.Message)
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(decoded.Result, result); err != nil {
+		return fmt.Errorf("%s: decode result: %w", method, err)
+	}
+	return nil
+}
+
+// Status is the part of an aria2 download status read by the runner.
+// aria2 encodes numbers as strings.
+type Status struct {
+	GID             string `json:"gid"`
+	Status          string `json:"status"`
+	TotalLength     string `json:"totalLength"`
+	CompletedLength string `json:"completedLength"`
+	DownloadSpeed   string `json:"downloadSpeed"`
+	ErrorCode       string `json:"errorCode"`
+	ErrorMessage    string `json:"errorMessage"`
+}
+
+var statusKeys = []string{"gid", "status", "totalLength", "completedLength", "downloadSpeed", "errorCode", "errorMessage"}
+
+// AddURI queues one file given by its URIs, which must be mirrors of the same
+// content, and returns its GID.
+func (c *RPCClient) AddURI(ctx context.Context, uris []string, options map[string]string) (string, error) {
+	var gid string
+	err := c.Call(ctx, "aria2.addUri", &gid, uris, options)
+	return gid, err
+}
+
+// TellActive returns the downloads in progress.
+func (c *RPCClient) TellActive(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := c.Call(ctx, "aria2.tellActive", &statuses, statusKeys)
+	return statuses, err
+}
+
+// TellStopped returns up to num finished, failed or removed downloads starting at offset.
+func (c *RPCClient) TellStopped(ctx context.Context, offset int, num int) ([]Status, error) {
+	var statuses []Status
+	err := c.Call(ctx, "aria2.tellStopped", &statuses, offset, num, statusKeys)
+	return statuses, err
+}
+
+// GetVersion returns the aria2 version; it is used to wait for the interface.
+func (c *RPCClient) GetVersion(ctx context.Context) (string, error) {
+	var version struct {
+		Version string `json:"version"`
+	}
+	err := c.Call(ctx, "aria2.getVersion", &version)
+	return version.Version, err
+}
+
+// Shutdown stops aria2c without waiting for running downloads.
+func (c *RPCClient) Shutdown(ctx context.Context) error {
+	return c.Call(ctx, "aria2.forceShutdown", nil)
+}
+
+// RunRPC starts aria2c with its JSON-RPC interface on a local port, queues
+// files and polls the per-file state until every file is finished or failed.
+// Events carry the state of every file in Files. Failed files are returned as
+// *DownloadError values joined together. When aria2c exits or does not answer
+// before its interface is up, RunRPC returns ErrRPCUnavailable.
+func (r *Runner) RunRPC(ctx context.Context, files []cloudmail.File, downloadDir string, proxy *url.URL, onUpdate func(ProgressEvent)) error {
+	args, conf, err := r.args(proxy)
+	if err != nil {
+		return err
+	}
+	port, err := freePort()
+	if err != nil {
+		return err
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return err
+	}
+	// The secret goes through a private config file, so other local users
+	// cannot read it from the process list and control the instance.
+	confPath, err := writeConf(conf + "rpc-secret=" + secret + "\n")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(confPath)
+	args = append(args,
+		"--conf-path="+confPath,
+		"--enable-rpc=true",
+		"--rpc-listen-all=false",
+		"--rpc-listen-port="+strconv.Itoa(port),
+		"--stop-with-process="+strconv.Itoa(os.Getpid()),
+		"--summary-interval=0",
+		// Finished downloads must stay visible to tellStopped until the run ends.
+		"--max-download-result="+strconv.Itoa(max(len(files), 1000)),
+	)
+
+	cmd := exec.Command(r.BinaryPath, args...)
+	output := &tailBuffer{limit: 4 << 10}
+	cmd.Stdout, cmd.Stderr = output, output
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if onUpdate != nil {
+		onUpdate(ProgressEvent{Phase: "download", Message: "aria2c started (JSON-RPC)"})
+	}
+	var waitErr error
+	exited := make(chan struct{})
+	go func() {
+		waitErr = cmd.Wait()
+		close(exited)
+	}()
+
+	client := NewRPCClient(fmt.Sprintf("http://127.0.0.1:%d/jsonrpc", port), secret)
+	stop := func() {
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 2*time.Second)
+		defer cancel()
+		if err := client.Shutdown(shutdownCtx); err != nil {
+			_ = cmd.Process.Kill()
+		}
+		select {
+		case <-exited:
+		case <-time.After(5 * time.Second):
+			_ = cmd.Process.Kill()
+			<-exited
+		}
+	}
+
+	if err := waitRPC(ctx, client, exited, positiveDuration(r.RPCStartWait, defaultRPCStartWait)); err != nil {
+		stop()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if waitErr != nil {
+			err = fmt.Errorf("%w: %s", waitErr, output.String())
+		}
+		return fmt.Errorf("%w: %w", ErrRPCUnavailable, err)
+	}
+
+	states, err := drive(ctx, client, files, downloadDir, positiveDuration(r.PollInterval, defaultPollInterval), exited, onUpdate)
+	stop()
+	if waitErr != nil && err != nil && ctx.Err() == nil {
+		// Keep the exit status of a crashed aria2c for ExitCode.
+		err = errors.Join(err, waitErr)
+	}
+	if onUpdate != nil {
+		event := rpcEvent(states)
+		event.Done, event.Err = true, err
+		if err == nil {
+			event.Percent, event.Message = 100, "aria2c finished"
+		} else {
+			event.Message = err.Error()
+		}
+		onUpdate(event)
+	}
+	return err
+}
+
+// waitRPC polls the interface until it answers, aria2c exits or timeout passes.
+func waitRPC(ctx context.Context, client *RPCClient, exited <-chan struct{}, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		attemptCtx, cancel := context.WithTimeout(ctx, time.Second)
+		_, err := client.GetVersion(attemptCtx)
+		cancel()
+		if err == nil || ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if time.Now().After(deadline) {
+			return err
+		}
+		select {
+		case <-exited:
+			return errors.New("aria2c exited")
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+// drive queues files on an aria2 instance and reports their state every
+// interval until all of them stopped, then returns the last states. It fails
+// when exited is closed or maxPollFailures polls in a row fail. The caller
+// shuts the instance down.
+func drive(ctx context.Context, client *RPCClient, files []cloudmail.File, downloadDir string, interval time.Duration, exited <-chan struct{}, onUpdate func(ProgressEvent)) ([]FileState, error) {
+	states := make([]FileState, len(files))
+	indexes := make(map[string]int, len(files))
+	for index, file := range files {
+		gid, err := client.AddURI(ctx, append([]string{file.URL}, file.Mirrors...), map[string]string{
+			"dir": downloadDir,
+			"out": file.Output,
+		})
+		if err != nil {
+			return states, fmt.Errorf("queue %s: %w", file.Output, err)
+		}
+		indexes[gid] = index
+		states[index] = FileState{Index: index, GID: gid, State: StateWaiting, TotalBytes: file.Size}
+	}
+
+	delay, failures := interval, 0
+	for {
+		select {
+		case <-ctx.Done():
+			return states, ctx.Err()
+		case <-time.After(delay):
+		}
+
+		statuses, err := poll(ctx, client, len(files))
+		if err != nil {
+			if ctx.Err() != nil {
+				return states, ctx.Err()
+			}
+			select {
+			case <-exited:
+				return states, fmt.Errorf("aria2c exited: %w", err)
+			default:
+			}
+			// A busy aria2c may miss a poll; back off and try again.
+			if failures++; failures == maxPollFailures {
+				return states, fmt.Errorf("%d status polls failed: %w", failures, err)
+			}
+			delay = min(delay*2, maxPollDelay)
+			continue
+		}
+		delay, failures = interval, 0
+		for _, status := range statuses {
+			if index, ok := indexes[status.GID]; ok {
+				states[index].apply(status, files[index].Output)
+			}
+		}
+
+		var (
+			errs     []error
+			finished int
+		)
+		for _, state := range states {
+			switch state.State {
+			case StateComplete:
+				finished++
+			case StateError:
+				finished++
+				errs = append(errs, state.Err)
+			}
+		}
+		if onUpdate != nil {
+			onUpdate(rpcEvent(states))
+		}
+		if finished == len(states) {
+			return states, errors.Join(errs...)
+		}
+	}
+}
+
+// poll returns the statuses of running and stopped downloads.
+func poll(ctx context.Context, client *RPCClient, stopped int) ([]Status, error) {
+	active, err := client.TellActive(ctx)
+	if err != nil {
+		return nil, err
+	}
+	finished, err := client.TellStopped(ctx, 0, stopped)
+	if err != nil {
+		return nil, err
+	}
+	return append(active, finished...), nil
+}
+
+// apply updates the state from an aria2 status.
+func (s *FileState) apply(status Status, output string) {
+	switch status.Status {
+	case "active":
+		s.State = StateActive
+	case "complete":
+		s.State = StateComplete
+	case "error", "removed":
+		s.State = StateError
+	default:
+		s.State = StateWaiting
+	}
+	if total := parseNumber(status.TotalLength); total > 0 {
+		s.TotalBytes = total
+	}
+	s.DoneBytes = parseNumber(status.CompletedLength)
+	s.Speed = parseNumber(status.DownloadSpeed)
+	if s.State == StateError {
+		message := status.ErrorMessage
+		if message == "" {
+			message = status.Status
+		}
+		s.Err = &DownloadError{File: output, Code: int(parseNumber(status.ErrorCode)), Message: message}
+		s.Speed = 0
+	}
+	if s.State == StateComplete {
+		s.TotalBytes = max(s.TotalBytes, s.DoneBytes)
+		s.DoneBytes, s.Speed = s.TotalBytes, 0
+	}
+}
+
+// rpcEvent summarizes file states; Percent is by bytes when all sizes are known.
+func rpcEvent(states []FileState) ProgressEvent {
+	var (
+		total, done, speed int64
+		finished           int
+		sizesKnown         = true
+	)
+	for _, state := range states {
+		total += state.TotalBytes
+		done += state.DoneBytes
+		speed += state.Speed
+		if state.TotalBytes == 0 {
+			sizesKnown = false
+		}
+		if state.State == StateComplete || state.State == StateError {
+			finished++
+		}
+	}
+	event := ProgressEvent{
+		Phase:   "download",
+		Message: fmt.Sprintf("%d/%d files, %d of %d bytes, %d B/s", finished, len(states), done, total, speed),
+		Files:   slices.Clone(states),
+	}
+	switch {
+	case sizesKnown && total > 0:
+		event.Percent = float64(done) * 100 / float64(total)
+	case len(states) > 0:
+		event.Percent = float64(finished) * 100 / float64(len(states))
+	}
+	return event
+}
+
+func parseNumber(value string) int64 {
+	number, _ := strconv.ParseInt(value, 10, 64)
+	return number
+}
+
+// freePort returns a local TCP port that is free at the moment of the call.
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+func newSecret() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// writeConf writes an aria2c config file readable only by the current user;
+// the caller removes it.
+func writeConf(content string) (string, error) {
+	temp, err := os.CreateTemp("", "cmrd-aria2-*.conf")
+	if err != nil {
+		return "", err
+	}
+	path := temp.Name()
+	_, err = temp.WriteString(content)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("write aria2 config: %w", err)
+	}
+	return path, nil
+}
+
+// tailBuffer keeps the last limit bytes written to it, for error messages.
+type tailBuffer struct {
+	mu    sync.Mutex
+	buf   []byte
+	limit int
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if over := len(b.buf) - b.limit; over > 0 {
+		b.buf = b.buf[over:]
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return strings.TrimSpace(string(b.buf))
+}
+
+func positiveDuration(value time.Duration, fallback time.Duration) time.Duration {
+	if value > 0 {
+		return value
+	}
+	return fallback
+}
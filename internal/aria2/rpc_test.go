@@ -0,0 +1,223 @@
+package aria2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jhonroun/cmrd/internal/cloudmail"
+)
+
+// fakeRPC is an aria2 JSON-RPC server whose downloads advance one step per
+// tellActive call. Files whose name starts with "fail" stop with error code 3.
+type fakeRPC struct {
+	t      *testing.T
+	secret string
+
+	mu      sync.Mutex
+	options []map[string]string
+	uris    [][]string
+	steps   []int
+	// failPolls is the number of next tellActive calls answered with HTTP 500.
+	failPolls int
+}
+
+const fakeSize = 300
+
+func (f *fakeRPC) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID     string            `json:"id"`
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		f.t.Errorf("decode request: %v", err)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	reply := func(result any) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": req.ID, "result": result})
+	}
+	var token string
+	if len(req.Params) == 0 || json.Unmarshal(req.Params[0], &token) != nil || token != "token:"+f.secret {
+		_ = json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": req.ID, "error": map[string]any{"code": 1, "message": "Unauthorized"}})
+		return
+	}
+
+	switch req.Method {
+	case "aria2.getVersion":
+		reply(map[string]string{"version": "1.37.0"})
+	case "aria2.addUri":
+		var uris []string
+		var options map[string]string
+		_ = json.Unmarshal(req.Params[1], &uris)
+		_ = json.Unmarshal(req.Params[2], &options)
+		f.uris = append(f.uris, uris)
+		f.options = append(f.options, options)
+		f.steps = append(f.steps, 0)
+		reply(fmt.Sprintf("gid%d", len(f.uris)))
+	case "aria2.tellActive":
+		if f.failPolls != 0 {
+			f.failPolls--
+			http.Error(w, "busy", http.StatusInternalServerError)
+			return
+		}
+		var active []Status
+		for index := range f.steps {
+			// One download at a time, like --max-concurrent-downloads=1.
+			if f.steps[index] >= 3 {
+				continue
+			}
+			f.steps[index]++
+			if f.steps[index] < 3 {
+				active = append(active, f.status(index))
+			}
+			break
+		}
+		reply(active)
+	case "aria2.tellStopped":
+		var stopped []Status
+		for index := range f.steps {
+			if f.steps[index] >= 3 {
+				stopped = append(stopped, f.status(index))
+			}
+		}
+		reply(stopped)
+	case "aria2.forceShutdown":
+		reply("OK")
+	default:
+		f.t.Errorf("unexpected method %s", req.Method)
+	}
+}
+
+func (f *fakeRPC) status(index int) Status {
+	done := f.steps[index] * fakeSize / 3
+	status := Status{
+		GID:             fmt.Sprintf("gid%d", index+1),
+		Status:          "active",
+		TotalLength:     fmt.Sprint(fakeSize),
+		CompletedLength: fmt.Sprint(done),
+		DownloadSpeed:   "100",
+	}
+	if f.steps[index] >= 3 {
+		status.Status, status.DownloadSpeed = "complete", "0"
+		if strings.HasPrefix(path.Base(f.options[index]["out"]), "fail") {
+			status.Status, status.CompletedLength = "error", "0"
+			status.ErrorCode, status.ErrorMessage = "3", "Resource not found"
+		}
+	}
+	return status
+}
+
+func TestDriveRPC(t *testing.T) {
+	fake := &fakeRPC{t: t, secret: "s3cret"}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	client := NewRPCClient(server.URL+"/jsonrpc", "s3cret")
+
+	if version, err := client.GetVersion(context.Background()); err != nil || version != "1.37.0" {
+		t.Fatalf("get version: %q, %v", version, err)
+	}
+	if _, err := NewRPCClient(server.URL+"/jsonrpc", "wrong").GetVersion(context.Background()); err == nil {
+		t.Fatal("expected an error for a wrong secret")
+	}
+
+	files := []cloudmail.File{
+		{URL: "https://a.example/1", Mirrors: []string{"https://b.example/1"}, Output: "share/a.bin", Size: fakeSize},
+		{URL: "https://a.example/2", Output: "share/fail.bin", Size: fakeSize},
+	}
+	var events []ProgressEvent
+	states, err := drive(context.Background(), client, files, "/downloads", time.Millisecond, nil, func(event ProgressEvent) {
+		events = append(events, event)
+	})
+
+	var downloadErr *DownloadError
+	if !errors.As(err, &downloadErr) || downloadErr.File != "share/fail.bin" || downloadErr.Code != 3 {
+		t.Fatalf("expected a download error for the failed file, got %v", err)
+	}
+	if !IsExpiredLink(err) {
+		t.Fatalf("code 3 should count as an expired link: %v", err)
+	}
+	if code, ok := ExitCode(err); !ok || code != 3 {
+		t.Fatalf("unexpected exit code %d, %v", code, ok)
+	}
+
+	if !slices.Equal(fake.uris[0], []string{"https://a.example/1", "https://b.example/1"}) {
+		t.Fatalf("mirrors were not queued as URIs of one download: %q", fake.uris[0])
+	}
+	if fake.options[1]["dir"] != "/downloads" || fake.options[1]["out"] != "share/fail.bin" {
+		t.Fatalf("unexpected options: %v", fake.options[1])
+	}
+
+	if len(states) != 2 || states[0].State != StateComplete || states[0].DoneBytes != fakeSize || states[1].State != StateError {
+		t.Fatalf("unexpected final states: %+v", states)
+	}
+	// The first poll sees the first file a third done and the second one still queued.
+	first := events[0]
+	if len(first.Files) != 2 || first.Files[0].State != StateActive || first.Files[0].DoneBytes != 100 ||
+		first.Files[0].Speed != 100 || first.Files[1].State != StateWaiting {
+		t.Fatalf("unexpected first event: %+v", first)
+	}
+	if first.Percent <= 0 || first.Percent >= 100 {
+		t.Fatalf("unexpected first percent: %v", first.Percent)
+	}
+	if last := events[len(events)-1]; last.Files[1].Err == nil {
+		t.Fatalf("last event misses the file error: %+v", last)
+	}
+}
+
+func TestDriveRPCCanceled(t *testing.T) {
+	fake := &fakeRPC{t: t, secret: "s3cret"}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := drive(ctx, NewRPCClient(server.URL+"/jsonrpc", "s3cret"), []cloudmail.File{{URL: "https://a.example/1", Output: "a"}}, "/downloads", time.Millisecond, nil, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation, got %v", err)
+	}
+}
+
+func TestDriveRPCPollFailures(t *testing.T) {
+	fake := &fakeRPC{t: t, secret: "s3cret", failPolls: maxPollFailures - 1}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	client := NewRPCClient(server.URL+"/jsonrpc", "s3cret")
+	files := []cloudmail.File{{URL: "https://a.example/1", Output: "a", Size: fakeSize}}
+
+	// Failed polls in a row below the limit are retried.
+	states, err := drive(context.Background(), client, files, "/downloads", time.Millisecond, nil, nil)
+	if err != nil || states[0].State != StateComplete {
+		t.Fatalf("expected the download to finish after failed polls, got %+v, %v", states, err)
+	}
+
+	fake.mu.Lock()
+	fake.failPolls = maxPollFailures
+	fake.mu.Unlock()
+	if _, err := drive(context.Background(), client, files, "/downloads", time.Millisecond, nil, nil); err == nil {
+		t.Fatal("expected an error after too many failed polls")
+	}
+
+	// An exited aria2c fails the first failed poll.
+	fake.mu.Lock()
+	fake.failPolls = 1
+	fake.mu.Unlock()
+	exited := make(chan struct{})
+	close(exited)
+	_, err = drive(context.Background(), client, files, "/downloads", time.Millisecond, exited, nil)
+	if err == nil || !strings.Contains(err.Error(), "aria2c exited") {
+		t.Fatalf("expected an exit error, got %v", err)
+	}
+}
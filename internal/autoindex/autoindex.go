@@ -0,0 +1,246 @@
+// Package autoindex resolves plain HTTP directory listings, such as the
+// autoindex pages of nginx, Apache or lighttpd and Go's http.FileServer.
+package autoindex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jhonroun/cmrd/internal/cloudmail"
+)
+
+// maxPageSize limits the size of one listing page.
+const maxPageSize = 16 << 20
+
+var hrefRE = regexp.MustCompile(`(?i)<a\s[^>]*?href\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+
+// ErrNotListing is returned for links that are not directory URLs.
+var ErrNotListing = errors.New("not a directory listing URL")
+
+// File describes one file of a listing.
+type File struct {
+	URL    string
+	Output string
+	// RemotePath is the URL of the file, as the listing links it.
+	RemotePath string
+	// Size and ModTime come from a HEAD request; Size is 0 when the server does not report it.
+	Size    int64
+	ModTime time.Time
+}
+
+// Dir describes one folder of a listing.
+type Dir struct {
+	Output     string
+	RemotePath string
+	// Empty reports that the folder has no entries on the remote side.
+	Empty bool
+}
+
+// Config configures the client.
+type Config struct {
+	HTTPClient *http.Client
+	UserAgent  string
+	// Keep selects entries by their path relative to the resolved folder;
+	// nil keeps everything. Folders it rejects are not listed.
+	Keep func(rel string, size int64, dir bool) bool
+}
+
+// Client walks directory listings.
+type Client struct {
+	client    *http.Client
+	userAgent string
+	keep      func(rel string, size int64, dir bool) bool
+}
+
+// New creates a client.
+func New(cfg Config) *Client {
+	client := cfg.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	userAgent := strings.TrimSpace(cfg.UserAgent)
+	if userAgent == "" {
+		userAgent = "cmrd/0.1"
+	}
+	keep := cfg.Keep
+	if keep == nil {
+		keep = func(string, int64, bool) bool { return true }
+	}
+	return &Client{client: client, userAgent: userAgent, keep: keep}
+}
+
+// Match reports whether link is an http or https URL of a directory, that is
+// a path ending with a slash.
+func Match(link string) bool {
+	_, err := parseDirURL(link)
+	return err == nil
+}
+
+func parseDirURL(link string) (*url.URL, error) {
+	parsed, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Scheme != "https" && parsed.Scheme != "http" || parsed.Host == "" || !strings.HasSuffix(parsed.Path, "/") {
+		return nil, fmt.Errorf("%w: %q", ErrNotListing, link)
+	}
+	parsed.RawQuery, parsed.Fragment = "", ""
+	return parsed, nil
+}
+
+// Walk lists a directory URL and its subdirectories. Files are reported to
+// file and, when dir is not nil, every folder before its contents. Outputs
+// start with the name of the linked folder, or the host name for the root.
+// Walk stops without error when a callback returns false.
+func (c *Client) Walk(ctx context.Context, link string, file func(File) bool, dir func(Dir) bool) error {
+	root, err := parseDirURL(link)
+	if err != nil {
+		return err
+	}
+	name := path.Base(root.Path)
+	if name == "/" || name == "." {
+		name = root.Hostname()
+	}
+	entries, err := c.list(ctx, root)
+	if err != nil {
+		return err
+	}
+	if dir != nil && !dir(Dir{Output: name, RemotePath: root.String(), Empty: len(entries) == 0}) {
+		return nil
+	}
+	visited := map[string]bool{root.String(): true}
+	_, err = c.walk(ctx, entries, "", name, visited, file, dir)
+	return err
+}
+
+// walk reports the listed entries of a folder whose path relative to the
+// linked folder is rel. Folders in visited are skipped, so a listing that
+// links back into the walk cannot make it loop. It returns false when a
+// callback stopped the walk.
+func (c *Client) walk(ctx context.Context, entries []*url.URL, rel string, rootName string, visited map[string]bool, file func(File) bool, dir func(Dir) bool) (bool, error) {
+	for _, entry := range entries {
+		name := strings.TrimSuffix(path.Base(entry.Path), "/")
+		entryRel := strings.TrimPrefix(rel+"/"+name, "/")
+		output := rootName + "/" + entryRel
+		if strings.HasSuffix(entry.Path, "/") {
+			if visited[entry.String()] || !c.keep(entryRel, 0, true) {
+				continue
+			}
+			visited[entry.String()] = true
+			children, err := c.list(ctx, entry)
+			if err != nil {
+				return false, err
+			}
+			if dir != nil && !dir(Dir{Output: output, RemotePath: entry.String(), Empty: len(children) == 0}) {
+				return false, nil
+			}
+			if more, err := c.walk(ctx, children, entryRel, rootName, visited, file, dir); !more || err != nil {
+				return more, err
+			}
+			continue
+		}
+
+		size, modTime, err := c.stat(ctx, entry)
+		if err != nil {
+			return false, err
+		}
+		if !c.keep(entryRel, size, false) {
+			continue
+		}
+		if !file(File{
+			URL:        entry.String(),
+			Output:     output,
+			RemotePath: entry.String(),
+			Size:       size,
+			ModTime:    modTime,
+		}) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// list returns the direct children of folder linked from its listing page,
+// in page order. Parent, sort and external links are skipped, and so are
+// dot segments, even percent-encoded ones, that would leave folder.
+func (c *Client) list(ctx context.Context, folder *url.URL) ([]*url.URL, error) {
+	resp, err := c.do(ctx, http.MethodGet, folder.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	page, err := io.ReadAll(io.LimitReader(resp.Body, maxPageSize))
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		entries []*url.URL
+		seen    = make(map[string]bool)
+	)
+	for _, match := range hrefRE.FindAllStringSubmatch(string(page), -1) {
+		href := html.UnescapeString(match[1] + match[2])
+		entry, err := folder.Parse(href)
+		if err != nil || entry.RawQuery != "" || entry.Scheme != folder.Scheme || entry.Host != folder.Host {
+			continue
+		}
+		entry.Fragment = ""
+		// entry.Path is unescaped, so %2e%2e/ shows up here as ../.
+		child, ok := strings.CutPrefix(entry.Path, folder.Path)
+		name := strings.TrimSuffix(child, "/")
+		if !ok || name == "" || name == "." || name == ".." || strings.Contains(name, "/") || seen[entry.Path] {
+			continue
+		}
+		if !strings.HasPrefix(path.Clean(entry.Path), folder.Path) {
+			continue
+		}
+		seen[entry.Path] = true
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// stat returns the size and modification time the server reports for a file.
+// Servers that reject HEAD requests leave both unset.
+func (c *Client) stat(ctx context.Context, file *url.URL) (int64, time.Time, error) {
+	resp, err := c.do(ctx, http.MethodHead, file.String())
+	if err != nil {
+		var httpErr *cloudmail.HTTPError
+		if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusMethodNotAllowed {
+			return 0, time.Time{}, nil
+		}
+		return 0, time.Time{}, err
+	}
+	resp.Body.Close()
+
+	size, _ := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return max(size, 0), modTime.UTC(), nil
+}
+
+func (c *Client) do(ctx context.Context, method string, endpoint string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, cloudmail.NewHTTPError(resp)
+	}
+	return resp, nil
+}
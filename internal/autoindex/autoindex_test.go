@@ -0,0 +1,126 @@
+package autoindex
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWalk(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"pub/a.txt":          "hello",
+		"pub/my docs/b.txt":  "world!",
+		"pub/skip/c.txt":     "c",
+		"pub/x#y.txt":        "hash",
+		"other/secret.txt":   "secret",
+		"pub/empty/":         "",
+		"pub/my docs/d.tmp":  "tmp",
+		"pub/my docs/e.data": "data",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if strings.HasSuffix(name, "/") {
+			if err := os.MkdirAll(path, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server := httptest.NewServer(http.FileServer(http.Dir(root)))
+	t.Cleanup(server.Close)
+
+	client := New(Config{Keep: func(rel string, size int64, dir bool) bool {
+		return rel != "skip" && !strings.HasSuffix(rel, ".tmp")
+	}})
+	var files, dirs []string
+	err := client.Walk(context.Background(), server.URL+"/pub/", func(file File) bool {
+		files = append(files, fmt.Sprint(file.Output, " ", file.URL, " ", file.Size))
+		return true
+	}, func(dir Dir) bool {
+		dirs = append(dirs, dir.Output)
+		return true
+	})
+	if err != nil {
+		t.Fatalf("walk: %v", err)
+	}
+	// http.FileServer lists entries sorted by name.
+	wantFiles := []string{
+		"pub/a.txt " + server.URL + "/pub/a.txt 5",
+		"pub/my docs/b.txt " + server.URL + "/pub/my%20docs/b.txt 6",
+		"pub/my docs/e.data " + server.URL + "/pub/my%20docs/e.data 4",
+		"pub/x#y.txt " + server.URL + "/pub/x%23y.txt 4",
+	}
+	if !slices.Equal(files, wantFiles) {
+		t.Fatalf("files mismatch: got=%q want=%q", files, wantFiles)
+	}
+	if want := []string{"pub", "pub/empty", "pub/my docs"}; !slices.Equal(dirs, want) {
+		t.Fatalf("dirs mismatch: got=%q want=%q", dirs, want)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := map[string]bool{
+		"https://mirror.example/pub/":         true,
+		"http://mirror.example/":              true,
+		"https://mirror.example/pub/file.iso": false,
+		"ftp://mirror.example/pub/":           false,
+		"mirror.example/pub/":                 false,
+		"https://mirror.example/pub/?C=M;O=A": true,
+	}
+	for link, want := range tests {
+		if got := Match(link); got != want {
+			t.Fatalf("match %q: got=%v want=%v", link, got, want)
+		}
+	}
+}
+
+func TestWalkSkipsDotSegments(t *testing.T) {
+	pages := map[string]string{
+		"/pub/":     `<a href="%2e%2e/">up</a> <a href="./">self</a> <a href="%2E%2E/pub/">again</a> <a href="sub/">sub</a> <a href="a.txt">a</a>`,
+		"/pub/sub/": `<a href="%2e%2e/">up</a> <a href="./">self</a> <a href="/pub/sub/">self again</a>`,
+	}
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.Method+" "+r.URL.Path)
+		if page, ok := pages[r.URL.Path]; ok {
+			fmt.Fprint(w, page)
+			return
+		}
+		if r.URL.Path == "/pub/a.txt" {
+			w.Header().Set("Content-Length", "5")
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	var outputs []string
+	err := New(Config{}).Walk(context.Background(), server.URL+"/pub/", func(file File) bool {
+		outputs = append(outputs, file.Output)
+		return true
+	}, func(dir Dir) bool {
+		outputs = append(outputs, dir.Output+"/")
+		return true
+	})
+	if err != nil {
+		t.Fatalf("walk: %v", err)
+	}
+	if want := []string{"pub/", "pub/sub/", "pub/a.txt"}; !slices.Equal(outputs, want) {
+		t.Fatalf("outputs mismatch: got=%q want=%q", outputs, want)
+	}
+	if want := []string{"GET /pub/", "GET /pub/sub/", "HEAD /pub/a.txt"}; !slices.Equal(requested, want) {
+		t.Fatalf("requests mismatch: got=%q want=%q", requested, want)
+	}
+}
@@ -0,0 +1,113 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jhonroun/cmrd/pkg/cmrd"
+)
+
+// cacheFlags holds resolve cache flags shared by resolve, download and serve-grpc.
+type cacheFlags struct {
+	dir     string
+	ttl     time.Duration
+	noCache bool
+}
+
+func addCacheFlags(fs *flag.FlagSet, withToggle bool) *cacheFlags {
+	flags := &cacheFlags{}
+	fs.StringVar(&flags.dir, "cache-dir", cmrd.DefaultCacheDir(), "Resolve cache directory")
+	fs.DurationVar(&flags.ttl, "cache-ttl", cmrd.DefaultCacheTTL, "Lifetime of cached resolve results")
+	if withToggle {
+		fs.BoolVar(&flags.noCache, "no-cache", false, "Do not read or write the resolve cache")
+	}
+	return flags
+}
+
+func (f *cacheFlags) apply(cfg *cmrd.Config) {
+	cfg.CacheTTL = f.ttl
+	if f.noCache {
+		cfg.CacheDir = ""
+		return
+	}
+	cfg.CacheDir = strings.TrimSpace(f.dir)
+}
+
+func runCache(args []string) error {
+	if len(args) == 0 {
+		printCacheHelp(os.Stdout)
+		return nil
+	}
+
+	fs := flag.NewFlagSet("cache "+args[0], flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	cacheOpts := addCacheFlags(fs, false)
+	expiredOnly := fs.Bool("expired", false, "Remove only expired entries")
+
+	switch args[0] {
+	case "help", "--help", "-h":
+		printCacheHelp(os.Stdout)
+		return nil
+	case "ls", "clear":
+	default:
+		return fmt.Errorf("unknown cache command %q\n\n%s", args[0], cacheHelpText)
+	}
+
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			printCacheHelp(os.Stdout)
+			return nil
+		}
+		return err
+	}
+	dir := strings.TrimSpace(cacheOpts.dir)
+	if dir == "" {
+		return errors.New("cache directory is not set, use --cache-dir")
+	}
+
+	if args[0] == "clear" {
+		removed, err := cmrd.ClearCache(dir, cacheOpts.ttl, *expiredOnly)
+		fmt.Printf("Removed cache entries: %d\n", removed)
+		return err
+	}
+
+	entries, err := cmrd.ListCache(dir, cacheOpts.ttl)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		state := "fresh"
+		if entry.Expired {
+			state = "expired"
+		}
+		if entry.LinkID == "" {
+			fmt.Printf("%-7s  unreadable entry %s\n", state, entry.Path)
+			continue
+		}
+		age := time.Since(entry.Created).Round(time.Second)
+		fmt.Printf("%-7s  %s  %d files, %s, age %s\n", state, entry.LinkID, entry.Files, formatBytes(entry.Size), age)
+	}
+	fmt.Printf("Cache entries: %d (%s)\n", len(entries), dir)
+	return nil
+}
+
+func printCacheHelp(w io.Writer) {
+	fmt.Fprint(w, cacheHelpText)
+}
+
+const cacheHelpText = `Usage:
+  cmrd cache ls [flags]
+  cmrd cache clear [flags]
+
+Lists or removes folder trees saved by resolve, download and serve-grpc.
+
+Flags:
+  --cache-dir string   Resolve cache directory (default: user cache dir/cmrd/resolve)
+  --cache-ttl duration Lifetime of cached resolve results (default 1h0m0s)
+  --expired            clear: remove only expired entries
+`
@@ -36,6 +36,10 @@ func Run(ctx context.Context, args []string) error {
 		return runResolve(ctx, args[1:])
 	case "download":
 		return runDownload(ctx, args[1:])
+	case "verify":
+		return runVerify(ctx, args[1:])
+	case "cache":
+		return runCache(args[1:])
 	case "serve-grpc":
 		return runServeGRPC(ctx, args[1:])
 	default:
@@ -47,11 +51,18 @@ func runResolve(ctx context.Context, args []string) error {
 	fs := flag.NewFlagSet("resolve", flag.ContinueOnError)
 	fs.SetOutput(io.Discard)
 
-	linksPath := fs.String("links", "links.txt", "Path to file with public links")
+	linkOpts := addLinkFlags(fs)
 	jsonOutput := fs.Bool("json", false, "Print JSON output")
 	timeout := fs.Duration("timeout", 30*time.Second, "HTTP timeout")
-	proxy := fs.String("proxy", "", "Proxy host:port or URL")
-	proxyAuth := fs.String("proxy-auth", "", "Proxy auth in user:pass format")
+	proxyOpts := addProxyFlags(fs)
+	sessionOpts := addSessionFlags(fs)
+	resolveWorkers := fs.Int("resolve-workers", 4, "Number of folders listed in parallel")
+	retries := fs.Int("retries", 5, "Number of retries for failed requests")
+	rateOpts := addRateFlags(fs)
+	continueOnError := fs.Bool("continue-on-error", false, "Keep resolving other links when one fails")
+	filterOpts := addFilterFlags(fs)
+	pathOpts := addPathFlags(fs, true)
+	cacheOpts := addCacheFlags(fs, true)
 
 	if err := fs.Parse(args); err != nil {
 		if errors.Is(err, flag.ErrHelp) {
@@ -61,51 +72,157 @@ func runResolve(ctx context.Context, args []string) error {
 		return err
 	}
 
-	links, err := cmrd.ReadLinksFile(*linksPath)
+	entries, err := linkOpts.entries(fs)
 	if err != nil {
 		return err
 	}
 
 	cfg := cmrd.DefaultConfig()
 	cfg.HTTPTimeout = *timeout
-	cfg.Proxy = strings.TrimSpace(*proxy)
-	cfg.ProxyAuth = strings.TrimSpace(*proxyAuth)
+	if err := proxyOpts.apply(ctx, &cfg); err != nil {
+		return err
+	}
+	if err := sessionOpts.apply(&cfg); err != nil {
+		return err
+	}
+	cfg.ResolveWorkers = *resolveWorkers
+	cfg.Retries = *retries
+	rateOpts.apply(&cfg)
+	pathOpts.apply(&cfg)
+	cacheOpts.apply(&cfg)
+	if cfg.Filter, err = filterOpts.filter(); err != nil {
+		return err
+	}
 
 	client, err := cmrd.New(cfg)
 	if err != nil {
 		return err
 	}
 
-	files, err := client.Resolve(ctx, links)
-	if err != nil {
+	var (
+		files      []cmrd.FileTask
+		results    []cmrd.LinkResult
+		resolveErr error
+	)
+	for _, group := range cmrd.GroupLinks(entries) {
+		linkClient, err := client.ForLink(group.Options)
+		if err != nil {
+			return err
+		}
+		if !*continueOnError {
+			resolved, err := linkClient.Resolve(ctx, group.Links)
+			if err != nil {
+				return err
+			}
+			files = append(files, resolved...)
+			continue
+		}
+		results = append(results, linkClient.ResolveAll(ctx, group.Links)...)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+	if *continueOnError {
+		files, resolveErr = cmrd.SplitResults(results)
+		printLinkResults(os.Stderr, results)
+	}
+	if err := pathOpts.writeReport(cmrd.PathMappings(files)); err != nil {
 		return err
 	}
 
 	if *jsonOutput {
 		encoder := json.NewEncoder(os.Stdout)
 		encoder.SetIndent("", "  ")
-		return encoder.Encode(files)
+		if err := encoder.Encode(files); err != nil {
+			return err
+		}
+		return resolveErr
 	}
 
-	fmt.Printf("Resolved files: %d\n", len(files))
+	fmt.Printf("Resolved files: %d (%s)\n", len(files), formatBytes(cmrd.TotalSize(files)))
 	for _, file := range files {
-		fmt.Printf("%s\n  out=%s\n\n", file.URL, file.Output)
+		fmt.Printf("%s\n  out=%s\n", file.URL, file.Output)
+		if file.Label != "" {
+			fmt.Printf("  label=%s\n", file.Label)
+		}
+		if file.Provider != "" {
+			fmt.Printf("  provider=%s\n", file.Provider)
+		}
+		if file.OriginalOutput != "" {
+			fmt.Printf("  renamed from=%s\n", file.OriginalOutput)
+		}
+		fmt.Printf("  size=%s\n\n", formatBytes(file.Size))
 	}
-	return nil
+	return resolveErr
+}
+
+// printLinkResults prints per-link status and timing.
+func printLinkResults(w io.Writer, results []cmrd.LinkResult) {
+	failed := 0
+	for _, result := range results {
+		duration := result.Duration.Round(time.Millisecond)
+		if result.Err != nil {
+			failed++
+			fmt.Fprintf(w, "FAIL %s (%s): %v\n", result.Link, duration, result.Err)
+			continue
+		}
+		fmt.Fprintf(w, "OK   %s (%s): %d files\n", result.Link, duration, len(result.Files))
+	}
+	fmt.Fprintf(w, "Links: %d, ok: %d, failed: %d\n", len(results), len(results)-failed, failed)
+}
+
+// printFailedLinks prints the summary of links skipped by --continue-on-error.
+func printFailedLinks(w io.Writer, err error) {
+	var resolveErr *cmrd.ResolveError
+	if !errors.As(err, &resolveErr) {
+		return
+	}
+	for _, linkErr := range resolveErr.Links {
+		fmt.Fprintf(w, "FAIL %s\n", linkErr.Error())
+	}
+	fmt.Fprintf(w, "Failed links: %d\n", len(resolveErr.Links))
+}
+
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
 }
 
 func runDownload(ctx context.Context, args []string) error {
 	fs := flag.NewFlagSet("download", flag.ContinueOnError)
 	fs.SetOutput(io.Discard)
 
-	linksPath := fs.String("links", "links.txt", "Path to file with public links")
+	linkOpts := addLinkFlags(fs)
 	downloadDir := fs.String("dir", "downloads", "Download destination directory")
 	aria2Path := fs.String("aria2c", "", "Path to aria2c binary (or CMRD_ARIA2C_PATH)")
 	timeout := fs.Duration("timeout", 30*time.Second, "HTTP timeout")
-	proxy := fs.String("proxy", "", "Proxy host:port or URL")
-	proxyAuth := fs.String("proxy-auth", "", "Proxy auth in user:pass format")
+	proxyOpts := addProxyFlags(fs)
+	sessionOpts := addSessionFlags(fs)
+	resolveWorkers := fs.Int("resolve-workers", 4, "Number of folders listed in parallel")
 	tuiMode := fs.Bool("tui", true, "Enable Bubble Tea TUI")
-	keepInput := fs.Bool("keep-input", false, "Keep generated aria2 input file")
+	keepInput := fs.Bool("keep-input", false, "Keep generated aria2 input file (console mode)")
+	aria2Console := fs.Bool("aria2-console", false, "Read aria2c progress from its console output instead of JSON-RPC")
+	backend := fs.String("backend", cmrd.BackendAuto, "Download backend: auto, aria2 or native")
+	concurrency := fs.Int("concurrency", 10, "Number of files downloaded in parallel")
+	splits := fs.Int("split", 10, "Number of connections per file")
+	retries := fs.Int("retries", 5, "Number of retries for failed requests")
+	rateOpts := addRateFlags(fs)
+	urlRefreshes := fs.Int("url-refreshes", cmrd.DefaultURLRefreshes, "Number of times expired download URLs are refreshed")
+	verify := fs.Bool("verify", true, "Verify downloaded files against Cloud.Mail hash")
+	continueOnError := fs.Bool("continue-on-error", false, "Download resolved links when other links fail")
+	archive := fs.Bool("archive", false, "Download each folder link as one ZIP archive")
+	extract := fs.Bool("extract", false, "Extract archives into the download directory (implies --archive)")
+	filterOpts := addFilterFlags(fs)
+	pathOpts := addPathFlags(fs, true)
+	cacheOpts := addCacheFlags(fs, true)
 
 	if err := fs.Parse(args); err != nil {
 		if errors.Is(err, flag.ErrHelp) {
@@ -115,7 +232,7 @@ func runDownload(ctx context.Context, args []string) error {
 		return err
 	}
 
-	links, err := cmrd.ReadLinksFile(*linksPath)
+	entries, err := linkOpts.entries(fs)
 	if err != nil {
 		return err
 	}
@@ -124,26 +241,151 @@ func runDownload(ctx context.Context, args []string) error {
 	cfg.Aria2Path = strings.TrimSpace(*aria2Path)
 	cfg.DownloadDir = strings.TrimSpace(*downloadDir)
 	cfg.HTTPTimeout = *timeout
-	cfg.Proxy = strings.TrimSpace(*proxy)
-	cfg.ProxyAuth = strings.TrimSpace(*proxyAuth)
+	if err := proxyOpts.apply(ctx, &cfg); err != nil {
+		return err
+	}
+	if err := sessionOpts.apply(&cfg); err != nil {
+		return err
+	}
+	cfg.ResolveWorkers = *resolveWorkers
 	cfg.DeleteInputAfterDone = !*keepInput
+	cfg.Aria2Console = *aria2Console
+	cfg.Backend = strings.TrimSpace(*backend)
+	cfg.Concurrency = *concurrency
+	cfg.Splits = *splits
+	cfg.Retries = *retries
+	rateOpts.apply(&cfg)
+	cfg.URLRefreshes = *urlRefreshes
+	cfg.VerifyHashes = *verify
+	cfg.ContinueOnError = *continueOnError
+	cfg.Archive = *archive || *extract
+	cfg.ExtractArchive = *extract
+	pathOpts.apply(&cfg)
+	cacheOpts.apply(&cfg)
+	if cfg.Filter, err = filterOpts.filter(); err != nil {
+		return err
+	}
 
 	client, err := cmrd.New(cfg)
 	if err != nil {
 		return err
 	}
 
+	var mappings []cmrd.PathMapping
+	collectMappings := func(event cmrd.ProgressEvent) {
+		// Every run of links with the same options reports its own mappings.
+		mappings = append(mappings, event.PathMappings...)
+	}
+
 	if *tuiMode {
-		return tui.RunDownload(ctx, client, links)
+		err = tui.RunDownload(ctx, client, entries, collectMappings)
+		printFailedLinks(os.Stderr, err)
+		return errors.Join(err, pathOpts.writeReport(mappings))
 	}
 
-	return client.Download(ctx, links, func(event cmrd.ProgressEvent) {
+	err = client.DownloadEntries(ctx, entries, func(event cmrd.ProgressEvent) {
+		collectMappings(event)
+		prefix := strings.ToUpper(event.Phase)
+		if event.Label != "" {
+			prefix += " " + event.Label
+		}
+		for _, fileErr := range event.FileErrors {
+			fmt.Printf("[%s] FAIL %s\n", prefix, fileErr.Error())
+		}
 		if event.Percent > 0 {
-			fmt.Printf("[%s] %.1f%% %s\n", strings.ToUpper(event.Phase), event.Percent, event.Message)
+			fmt.Printf("[%s] %.1f%% %s\n", prefix, event.Percent, event.Message)
 			return
 		}
-		fmt.Printf("[%s] %s\n", strings.ToUpper(event.Phase), event.Message)
+		fmt.Printf("[%s] %s\n", prefix, event.Message)
 	})
+	printFailedLinks(os.Stdout, err)
+	return errors.Join(err, pathOpts.writeReport(mappings))
+}
+
+func runVerify(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	linkOpts := addLinkFlags(fs)
+	downloadDir := fs.String("dir", "downloads", "Download directory to check")
+	timeout := fs.Duration("timeout", 30*time.Second, "HTTP timeout")
+	proxyOpts := addProxyFlags(fs)
+	sessionOpts := addSessionFlags(fs)
+	resolveWorkers := fs.Int("resolve-workers", 4, "Number of folders listed in parallel")
+	retries := fs.Int("retries", 5, "Number of retries for failed requests")
+	rateOpts := addRateFlags(fs)
+	filterOpts := addFilterFlags(fs)
+	pathOpts := addPathFlags(fs, false)
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			printVerifyHelp(os.Stdout)
+			return nil
+		}
+		return err
+	}
+
+	entries, err := linkOpts.entries(fs)
+	if err != nil {
+		return err
+	}
+
+	cfg := cmrd.DefaultConfig()
+	cfg.DownloadDir = strings.TrimSpace(*downloadDir)
+	cfg.HTTPTimeout = *timeout
+	if err := proxyOpts.apply(ctx, &cfg); err != nil {
+		return err
+	}
+	if err := sessionOpts.apply(&cfg); err != nil {
+		return err
+	}
+	cfg.ResolveWorkers = *resolveWorkers
+	cfg.Retries = *retries
+	rateOpts.apply(&cfg)
+	pathOpts.apply(&cfg)
+	if cfg.Filter, err = filterOpts.filter(); err != nil {
+		return err
+	}
+
+	client, err := cmrd.New(cfg)
+	if err != nil {
+		return err
+	}
+
+	var (
+		total     int
+		failed    []cmrd.FileError
+		verifyErr *cmrd.VerifyError
+	)
+	for _, group := range cmrd.GroupLinks(entries) {
+		linkClient, err := client.ForLink(group.Options)
+		if err != nil {
+			return err
+		}
+		files, err := linkClient.Resolve(ctx, group.Links)
+		if err != nil {
+			return err
+		}
+		total += len(files)
+
+		err = linkClient.Verify(ctx, files, nil)
+		if err != nil && !errors.As(err, &verifyErr) {
+			return err
+		}
+		if verifyErr != nil {
+			failed = append(failed, verifyErr.Files...)
+			verifyErr = nil
+		}
+	}
+
+	for _, fileErr := range failed {
+		fmt.Printf("FAIL %s\n", fileErr.Error())
+	}
+	fmt.Printf("Verified files: %d, ok: %d, failed: %d\n", total, total-len(failed), len(failed))
+	if len(failed) > 0 {
+		return &cmrd.VerifyError{Files: failed}
+	}
+	return nil
 }
 
 func runServeGRPC(ctx context.Context, args []string) error {
@@ -154,9 +396,21 @@ func runServeGRPC(ctx context.Context, args []string) error {
 	downloadDir := fs.String("dir", "downloads", "Default download destination")
 	aria2Path := fs.String("aria2c", "", "Path to aria2c binary (or CMRD_ARIA2C_PATH)")
 	timeout := fs.Duration("timeout", 30*time.Second, "HTTP timeout")
-	proxy := fs.String("proxy", "", "Proxy host:port or URL")
-	proxyAuth := fs.String("proxy-auth", "", "Proxy auth in user:pass format")
-	keepInput := fs.Bool("keep-input", false, "Keep generated aria2 input file")
+	proxyOpts := addProxyFlags(fs)
+	sessionOpts := addSessionFlags(fs)
+	resolveWorkers := fs.Int("resolve-workers", 4, "Number of folders listed in parallel")
+	keepInput := fs.Bool("keep-input", false, "Keep generated aria2 input file (console mode)")
+	aria2Console := fs.Bool("aria2-console", false, "Read aria2c progress from its console output instead of JSON-RPC")
+	backend := fs.String("backend", cmrd.BackendAuto, "Download backend: auto, aria2 or native")
+	concurrency := fs.Int("concurrency", 10, "Number of files downloaded in parallel")
+	splits := fs.Int("split", 10, "Number of connections per file")
+	retries := fs.Int("retries", 5, "Number of retries for failed requests")
+	rateOpts := addRateFlags(fs)
+	urlRefreshes := fs.Int("url-refreshes", cmrd.DefaultURLRefreshes, "Number of times expired download URLs are refreshed")
+	verify := fs.Bool("verify", true, "Verify downloaded files against Cloud.Mail hash")
+	continueOnError := fs.Bool("continue-on-error", false, "Download resolved links when other links fail")
+	pathOpts := addPathFlags(fs, false)
+	cacheOpts := addCacheFlags(fs, true)
 
 	if err := fs.Parse(args); err != nil {
 		if errors.Is(err, flag.ErrHelp) {
@@ -170,11 +424,34 @@ func runServeGRPC(ctx context.Context, args []string) error {
 	cfg.Aria2Path = strings.TrimSpace(*aria2Path)
 	cfg.DownloadDir = strings.TrimSpace(*downloadDir)
 	cfg.HTTPTimeout = *timeout
-	cfg.Proxy = strings.TrimSpace(*proxy)
-	cfg.ProxyAuth = strings.TrimSpace(*proxyAuth)
+	if err := proxyOpts.apply(ctx, &cfg); err != nil {
+		return err
+	}
+	if err := sessionOpts.apply(&cfg); err != nil {
+		return err
+	}
+	cfg.ResolveWorkers = *resolveWorkers
 	cfg.DeleteInputAfterDone = !*keepInput
+	cfg.Aria2Console = *aria2Console
+	cfg.Backend = strings.TrimSpace(*backend)
+	cfg.Concurrency = *concurrency
+	cfg.Splits = *splits
+	cfg.Retries = *retries
+	rateOpts.apply(&cfg)
+	cfg.URLRefreshes = *urlRefreshes
+	cfg.VerifyHashes = *verify
+	cfg.ContinueOnError = *continueOnError
+	pathOpts.apply(&cfg)
+	cacheOpts.apply(&cfg)
+
+	if _, err := cmrd.New(cfg); err != nil {
+		return err
+	}
 
-	service := grpcapi.NewServer(cfg)
+	service, err := grpcapi.NewServer(cfg)
+	if err != nil {
+		return err
+	}
 	fmt.Printf("gRPC server listening on %s\n", *address)
 	return grpcapi.Serve(ctx, *address, service)
 }
@@ -191,6 +468,10 @@ func printDownloadHelp(w io.Writer) {
 	fmt.Fprint(w, downloadHelpText)
 }
 
+func printVerifyHelp(w io.Writer) {
+	fmt.Fprint(w, verifyHelpText)
+}
+
 func printServeGRPCHelp(w io.Writer) {
 	fmt.Fprint(w, serveGRPCHelpText)
 }
@@ -201,8 +482,10 @@ Usage:
   cmrd <command> [flags]
 
 Commands:
-  resolve      Resolve Cloud.Mail public links to direct file URLs
-  download     Resolve links and start download with aria2c
+  resolve      Resolve Cloud.Mail public or private links to direct file URLs
+  download     Resolve links and download them (aria2c or native engine)
+  verify       Check a download directory against Cloud.Mail hashes
+  cache        List or clear cached resolve results (ls, clear)
   serve-grpc   Start gRPC API server (experimental; not fully tested)
   version      Print version
   help         Show this help
@@ -210,35 +493,145 @@ Commands:
 Examples:
   cmrd resolve --links links.txt
   cmrd download --links links.txt --dir downloads --tui=true
+  cmrd download --dir downloads https://cloud.mail.ru/public/AbCd/EfGh
+  cat chat.txt | cmrd download --links -
+  cmrd download --session-file cookies.txt https://cloud.mail.ru/home/Photos
+  cmrd verify --links links.txt --dir downloads
+  cmrd cache ls
   cmrd serve-grpc --listen :50051
 
 Environment:
   CMRD_ARIA2C_PATH   Path to aria2c binary (used when --aria2c is not set)
+                     The native Go engine is used when aria2c cannot be found
+  CMRD_SESSION       Session cookies for private links (when --session-file is not set)
+  CMRD_SESSION_FILE  Path to a session cookies file (when --session-file is not set)
+
+Exit codes:
+  0 success, 1 other error, 2 link not found, 3 link blocked, 4 rate limited,
+  5 traffic quota exceeded, 6 anti-bot page, 7 disk full, 8 aria2c missing,
+  9 aria2c failed, 10 verification failed, 11 unsafe path, 12 network error,
+  13 authentication required, 130 interrupted
 `
 
 const resolveHelpText = `Usage:
-  cmrd resolve [flags]
+  cmrd resolve [flags] [links...]
+
+Links are read from arguments and from --links; the file is used when
+--links is set or no links are given. See docs for per-link options.
 
 Flags:
-  --links string       Path to links file (default "links.txt")
+  --links string       Path to links file, - for stdin (default "links.txt")
   --json               Print JSON output
   --timeout duration   HTTP timeout (default 30s)
-  --proxy string       Proxy host:port or URL
+  --proxy string       Proxy host:port or URL, http, https or socks5 (repeatable)
+  --proxy-file string  File with proxies, one per line
   --proxy-auth string  Proxy auth in user:pass format
+  --proxy-strategy s   Proxy selection: round-robin or least-failures (default "round-robin")
+  --proxy-check duration  Proxy health check interval, 0 to disable (default 1m0s)
+  --session-file file  Cookies file of a logged-in session for private /home/ links
+  --resolve-workers int  Number of folders listed in parallel (default 4)
+  --retries int        Number of retries for failed requests (default 5)
+  --rate-limit float   Maximum Cloud.Mail API requests per second, 0 for unlimited (default 0)
+  --rate-burst int     API requests allowed at once under --rate-limit (default 5)
+  --continue-on-error  Keep resolving other links when one fails; print per-link summary
+  --include pattern    Keep only files matching glob, e.g. "*.pdf" (repeatable)
+  --exclude pattern    Skip files and folders matching glob, e.g. "video/" (repeatable)
+  --include-regex re   Keep only paths matching regular expression (repeatable)
+  --exclude-regex re   Skip paths matching regular expression (repeatable)
+  --ext list           Keep only these extensions, e.g. pdf,djvu (repeatable)
+  --min-size size      Skip files smaller than size, e.g. 10M
+  --max-size size      Skip files larger than size, e.g. 2G
+  --max-depth int      Maximum folder depth, 0 for unlimited (default 0)
+  --path-policy name   Local name policy: windows, posix, portable or none (default "windows")
+  --path-substitute s  Replacement for forbidden characters (default "_")
+  --path-report file   Write JSON report of renamed paths
+  --cache-dir string   Resolve cache directory (default: user cache dir/cmrd/resolve)
+  --cache-ttl duration Lifetime of cached resolve results (default 1h0m0s)
+  --no-cache           Do not read or write the resolve cache
 `
 
 const downloadHelpText = `Usage:
-  cmrd download [flags]
+  cmrd download [flags] [links...]
+
+Links are read from arguments and from --links; the file is used when
+--links is set or no links are given. See docs for per-link options.
 
 Flags:
-  --links string       Path to links file (default "links.txt")
+  --links string       Path to links file, - for stdin (default "links.txt")
   --dir string         Download destination directory (default "downloads")
   --aria2c string      Path to aria2c binary (fallback: CMRD_ARIA2C_PATH or "aria2c")
   --timeout duration   HTTP timeout (default 30s)
-  --proxy string       Proxy host:port or URL
+  --proxy string       Proxy host:port or URL, http, https or socks5 (repeatable)
+  --proxy-file string  File with proxies, one per line
   --proxy-auth string  Proxy auth in user:pass format
+  --proxy-strategy s   Proxy selection: round-robin or least-failures (default "round-robin")
+  --proxy-check duration  Proxy health check interval, 0 to disable (default 1m0s)
+  --session-file file  Cookies file of a logged-in session for private /home/ links
+  --resolve-workers int  Number of folders listed in parallel (default 4)
   --tui bool           Enable Bubble Tea TUI (default true)
-  --keep-input         Keep generated aria2 input file
+  --keep-input         Keep generated aria2 input file (console mode)
+  --aria2-console      Read aria2c progress from its console output instead of JSON-RPC
+  --backend string     Download backend: auto, aria2 or native (default "auto")
+  --concurrency int    Number of files downloaded in parallel (default 10)
+  --split int          Number of connections per file (default 10)
+  --retries int        Number of retries for failed requests (default 5)
+  --rate-limit float   Maximum Cloud.Mail API requests per second, 0 for unlimited (default 0)
+  --rate-burst int     API requests allowed at once under --rate-limit (default 5)
+  --url-refreshes int  Times expired download URLs are refreshed, 0 to disable (default 3)
+  --verify bool        Verify downloaded files against Cloud.Mail hash (default true)
+  --continue-on-error  Download resolved links when other links fail; print failed links
+  --archive            Download each folder link as one ZIP archive packed by Cloud.Mail
+  --extract            Extract archives with the per-file layout and remove them (implies --archive)
+  --include pattern    Keep only files matching glob, e.g. "*.pdf" (repeatable)
+  --exclude pattern    Skip files and folders matching glob, e.g. "video/" (repeatable)
+  --include-regex re   Keep only paths matching regular expression (repeatable)
+  --exclude-regex re   Skip paths matching regular expression (repeatable)
+  --ext list           Keep only these extensions, e.g. pdf,djvu (repeatable)
+  --min-size size      Skip files smaller than size, e.g. 10M
+  --max-size size      Skip files larger than size, e.g. 2G
+  --max-depth int      Maximum folder depth, 0 for unlimited (default 0)
+  --path-policy name   Local name policy: windows, posix, portable or none (default "windows")
+  --path-substitute s  Replacement for forbidden characters (default "_")
+  --path-report file   Write JSON report of renamed paths
+  --cache-dir string   Resolve cache directory (default: user cache dir/cmrd/resolve)
+  --cache-ttl duration Lifetime of cached resolve results (default 1h0m0s)
+  --no-cache           Do not read or write the resolve cache
+`
+
+const verifyHelpText = `Usage:
+  cmrd verify [flags] [links...]
+
+Links are read from arguments and from --links; the file is used when
+--links is set or no links are given. See docs for per-link options.
+
+Resolves links and checks that every file exists in the download directory
+and matches the remote size and Cloud.Mail content hash. Use the filter and
+path policy flags of the download that is checked.
+
+Flags:
+  --links string       Path to links file, - for stdin (default "links.txt")
+  --dir string         Download directory to check (default "downloads")
+  --timeout duration   HTTP timeout (default 30s)
+  --proxy string       Proxy host:port or URL, http, https or socks5 (repeatable)
+  --proxy-file string  File with proxies, one per line
+  --proxy-auth string  Proxy auth in user:pass format
+  --proxy-strategy s   Proxy selection: round-robin or least-failures (default "round-robin")
+  --proxy-check duration  Proxy health check interval, 0 to disable (default 1m0s)
+  --session-file file  Cookies file of a logged-in session for private /home/ links
+  --resolve-workers int  Number of folders listed in parallel (default 4)
+  --retries int        Number of retries for failed requests (default 5)
+  --rate-limit float   Maximum Cloud.Mail API requests per second, 0 for unlimited (default 0)
+  --rate-burst int     API requests allowed at once under --rate-limit (default 5)
+  --include pattern    Keep only files matching glob, e.g. "*.pdf" (repeatable)
+  --exclude pattern    Skip files and folders matching glob, e.g. "video/" (repeatable)
+  --include-regex re   Keep only paths matching regular expression (repeatable)
+  --exclude-regex re   Skip paths matching regular expression (repeatable)
+  --ext list           Keep only these extensions, e.g. pdf,djvu (repeatable)
+  --min-size size      Skip files smaller than size, e.g. 10M
+  --max-size size      Skip files larger than size, e.g. 2G
+  --max-depth int      Maximum folder depth, 0 for unlimited (default 0)
+  --path-policy name   Local name policy: windows, posix, portable or none (default "windows")
+  --path-substitute s  Replacement for forbidden characters (default "_")
 `
 
 const serveGRPCHelpText = `Usage:
@@ -252,7 +645,27 @@ Flags:
   --dir string         Default download destination directory (default "downloads")
   --aria2c string      Path to aria2c binary (fallback: CMRD_ARIA2C_PATH or "aria2c")
   --timeout duration   HTTP timeout (default 30s)
-  --proxy string       Proxy host:port or URL
+  --proxy string       Proxy host:port or URL, http, https or socks5 (repeatable)
+  --proxy-file string  File with proxies, one per line
   --proxy-auth string  Proxy auth in user:pass format
-  --keep-input         Keep generated aria2 input file
+  --proxy-strategy s   Proxy selection: round-robin or least-failures (default "round-robin")
+  --proxy-check duration  Proxy health check interval, 0 to disable (default 1m0s)
+  --session-file file  Cookies file of a logged-in session for private /home/ links
+  --resolve-workers int  Number of folders listed in parallel (default 4)
+  --keep-input         Keep generated aria2 input file (console mode)
+  --aria2-console      Read aria2c progress from its console output instead of JSON-RPC
+  --backend string     Download backend: auto, aria2 or native (default "auto")
+  --concurrency int    Number of files downloaded in parallel (default 10)
+  --split int          Number of connections per file (default 10)
+  --retries int        Number of retries for failed requests (default 5)
+  --rate-limit float   Maximum Cloud.Mail API requests per second, 0 for unlimited (default 0)
+  --rate-burst int     API requests allowed at once under --rate-limit (default 5)
+  --url-refreshes int  Times expired download URLs are refreshed, 0 to disable (default 3)
+  --verify bool        Verify downloaded files against Cloud.Mail hash (default true)
+  --continue-on-error  Download resolved links when other links fail; print failed links
+  --path-policy name   Local name policy: windows, posix, portable or none (default "windows")
+  --path-substitute s  Replacement for forbidden characters (default "_")
+  --cache-dir string   Resolve cache directory (default: user cache dir/cmrd/resolve)
+  --cache-ttl duration Lifetime of cached resolve results (default 1h0m0s)
+  --no-cache           Do not read or write the resolve cache
 `
@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jhonroun/cmrd/pkg/cmrd"
+)
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// filterFlags holds include/exclude flags shared by resolve and download.
+type filterFlags struct {
+	include      stringList
+	exclude      stringList
+	includeRegex stringList
+	excludeRegex stringList
+	extensions   stringList
+	minSize      string
+	maxSize      string
+	maxDepth     int
+}
+
+func addFilterFlags(fs *flag.FlagSet) *filterFlags {
+	flags := &filterFlags{}
+	fs.Var(&flags.include, "include", "Glob of files to keep (repeatable)")
+	fs.Var(&flags.exclude, "exclude", "Glob of files or folders to skip (repeatable)")
+	fs.Var(&flags.includeRegex, "include-regex", "Regular expression of paths to keep (repeatable)")
+	fs.Var(&flags.excludeRegex, "exclude-regex", "Regular expression of paths to skip (repeatable)")
+	fs.Var(&flags.extensions, "ext", "Comma-separated file extensions to keep (repeatable)")
+	fs.StringVar(&flags.minSize, "min-size", "", "Skip files smaller than size, e.g. 10M")
+	fs.StringVar(&flags.maxSize, "max-size", "", "Skip files larger than size, e.g. 2G")
+	fs.IntVar(&flags.maxDepth, "max-depth", 0, "Maximum folder depth, 0 for unlimited")
+	return flags
+}
+
+func (f *filterFlags) filter() (cmrd.Filter, error) {
+	filter := cmrd.Filter{
+		Include:      f.include,
+		Exclude:      f.exclude,
+		IncludeRegex: f.includeRegex,
+		ExcludeRegex: f.excludeRegex,
+		MaxDepth:     f.maxDepth,
+	}
+	for _, value := range f.extensions {
+		for _, ext := range strings.Split(value, ",") {
+			if ext = strings.TrimSpace(ext); ext != "" {
+				filter.Extensions = append(filter.Extensions, ext)
+			}
+		}
+	}
+
+	var err error
+	if filter.MinSize, err = parseSize(f.minSize); err != nil {
+		return cmrd.Filter{}, fmt.Errorf("invalid --min-size: %w", err)
+	}
+	if filter.MaxSize, err = parseSize(f.maxSize); err != nil {
+		return cmrd.Filter{}, fmt.Errorf("invalid --max-size: %w", err)
+	}
+	if err := filter.Validate(); err != nil {
+		return cmrd.Filter{}, err
+	}
+	return filter, nil
+}
+
+// parseSize parses sizes like "1024", "500K", "10M" or "2G" (binary units).
+func parseSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	if value == "" {
+		return 0, nil
+	}
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "B"), "I")
+
+	multiplier := int64(1)
+	if index := strings.IndexAny(value, "KMGT"); index >= 0 && index == len(value)-1 {
+		multiplier = int64(1) << (10 * (strings.IndexByte("KMGT", value[index]) + 1))
+		value = value[:index]
+	}
+	number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("bad size %q", value)
+	}
+	return int64(number * float64(multiplier)), nil
+}
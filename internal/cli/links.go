@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jhonroun/cmrd/pkg/cmrd"
+)
+
+// linkFlags holds the links file flag; links may also be given as positional arguments.
+type linkFlags struct {
+	path string
+}
+
+func addLinkFlags(fs *flag.FlagSet) *linkFlags {
+	flags := &linkFlags{}
+	fs.StringVar(&flags.path, "links", "links.txt", "Path to file with public links, - for standard input")
+	return flags
+}
+
+// entries reads links from the positional arguments of fs and from the links file.
+// The file is read when --links is set or no links are given as arguments.
+// Arguments are parsed like lines of the file, so they may carry options or free text.
+func (f *linkFlags) entries(fs *flag.FlagSet) ([]cmrd.LinkEntry, error) {
+	explicit := false
+	fs.Visit(func(set *flag.Flag) {
+		explicit = explicit || set.Name == "links"
+	})
+
+	var inputs []io.Reader
+	if explicit || fs.NArg() == 0 {
+		if f.path == "-" {
+			inputs = append(inputs, os.Stdin, strings.NewReader("\n"))
+		} else {
+			file, err := os.Open(f.path)
+			if err != nil {
+				return nil, err
+			}
+			defer file.Close()
+			inputs = append(inputs, file, strings.NewReader("\n"))
+		}
+	}
+	if fs.NArg() > 0 {
+		inputs = append(inputs, strings.NewReader(strings.Join(fs.Args(), "\n")))
+	}
+
+	entries, err := cmrd.ParseLinks(io.MultiReader(inputs...))
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("no Cloud.Mail links found")
+	}
+	return entries, nil
+}
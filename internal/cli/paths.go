@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"strings"
+
+	"github.com/jhonroun/cmrd/pkg/cmrd"
+)
+
+// pathFlags holds local path policy flags shared by resolve, download and serve-grpc.
+type pathFlags struct {
+	policy     string
+	substitute string
+	report     string
+}
+
+func addPathFlags(fs *flag.FlagSet, withReport bool) *pathFlags {
+	flags := &pathFlags{}
+	fs.StringVar(&flags.policy, "path-policy", cmrd.PathPolicyWindows, "Local name policy: windows, posix, portable or none")
+	fs.StringVar(&flags.substitute, "path-substitute", "_", "Replacement for characters forbidden by the path policy")
+	if withReport {
+		fs.StringVar(&flags.report, "path-report", "", "Write JSON report of renamed paths to file")
+	}
+	return flags
+}
+
+func (f *pathFlags) apply(cfg *cmrd.Config) {
+	cfg.PathPolicy = strings.TrimSpace(f.policy)
+	cfg.PathSubstitute = f.substitute
+}
+
+// writeReport writes renamed paths as JSON when --path-report is set.
+func (f *pathFlags) writeReport(mappings []cmrd.PathMapping) error {
+	if f.report == "" {
+		return nil
+	}
+	if mappings == nil {
+		mappings = []cmrd.PathMapping{}
+	}
+	data, err := json.MarshalIndent(mappings, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(f.report, append(data, '\n'), 0o644)
+}
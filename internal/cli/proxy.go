@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"strings"
+	"time"
+
+	"github.com/jhonroun/cmrd/pkg/cmrd"
+)
+
+// proxyFlags holds proxy flags shared by all commands that talk to Cloud.Mail.
+type proxyFlags struct {
+	proxies       stringList
+	file          string
+	auth          string
+	strategy      string
+	checkInterval time.Duration
+}
+
+func addProxyFlags(fs *flag.FlagSet) *proxyFlags {
+	flags := &proxyFlags{}
+	fs.Var(&flags.proxies, "proxy", "Proxy host:port or URL, http, https or socks5 (repeatable)")
+	fs.StringVar(&flags.file, "proxy-file", "", "File with proxies, one per line")
+	fs.StringVar(&flags.auth, "proxy-auth", "", "Proxy auth in user:pass format")
+	fs.StringVar(&flags.strategy, "proxy-strategy", cmrd.ProxyRoundRobin, "Proxy selection: round-robin or least-failures")
+	fs.DurationVar(&flags.checkInterval, "proxy-check", time.Minute, "Proxy health check interval, 0 to disable")
+	return flags
+}
+
+// apply builds one proxy pool for the command and keeps checking it until ctx is done.
+func (f *proxyFlags) apply(ctx context.Context, cfg *cmrd.Config) error {
+	cfg.Proxies = nil
+	for _, proxy := range f.proxies {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			cfg.Proxies = append(cfg.Proxies, proxy)
+		}
+	}
+	if file := strings.TrimSpace(f.file); file != "" {
+		proxies, err := cmrd.ReadProxyFile(file)
+		if err != nil {
+			return err
+		}
+		cfg.Proxies = append(cfg.Proxies, proxies...)
+	}
+	cfg.ProxyAuth = strings.TrimSpace(f.auth)
+	cfg.ProxyStrategy = f.strategy
+
+	pool, err := cmrd.NewProxyPool(*cfg)
+	if err != nil || pool == nil {
+		return err
+	}
+	cfg.ProxyPool = pool
+	if f.checkInterval > 0 && pool.Len() > 1 {
+		go pool.Watch(ctx, f.checkInterval)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package cli
+
+import (
+	"flag"
+
+	"github.com/jhonroun/cmrd/pkg/cmrd"
+)
+
+// rateFlags holds API rate limit flags shared by all commands that resolve links.
+type rateFlags struct {
+	limit float64
+	burst int
+}
+
+func addRateFlags(fs *flag.FlagSet) *rateFlags {
+	flags := &rateFlags{}
+	fs.Float64Var(&flags.limit, "rate-limit", 0, "Maximum Cloud.Mail API requests per second, 0 for unlimited")
+	fs.IntVar(&flags.burst, "rate-burst", cmrd.DefaultRateBurst, "API requests allowed at once under --rate-limit")
+	return flags
+}
+
+func (f *rateFlags) apply(cfg *cmrd.Config) {
+	cfg.RateLimit = f.limit
+	cfg.RateBurst = f.burst
+}
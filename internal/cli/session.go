@@ -0,0 +1,31 @@
+package cli
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/jhonroun/cmrd/pkg/cmrd"
+)
+
+// sessionFlags holds the session flag shared by all commands that talk to Cloud.Mail.
+// Cookies are taken only from a file or the environment, never from arguments,
+// so they do not show up in the process list or shell history.
+type sessionFlags struct {
+	file string
+}
+
+func addSessionFlags(fs *flag.FlagSet) *sessionFlags {
+	flags := &sessionFlags{}
+	fs.StringVar(&flags.file, "session-file", "", "Cookies file of a logged-in session for private /home/ links (or CMRD_SESSION, CMRD_SESSION_FILE)")
+	return flags
+}
+
+func (f *sessionFlags) apply(cfg *cmrd.Config) error {
+	var err error
+	if file := strings.TrimSpace(f.file); file != "" {
+		cfg.Session, err = cmrd.LoadSession(file)
+	} else {
+		cfg.Session, err = cmrd.SessionFromEnv()
+	}
+	return err
+}
@@ -0,0 +1,98 @@
+package cloudmail
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Archive is a ZIP archive of one public folder.
+type Archive struct {
+	URL string
+	// Name is the folder name; files of the folder are resolved below it.
+	Name       string
+	RemotePath string
+}
+
+type zipAPIResponse struct {
+	// Body is the URL of the archive.
+	Body string `json:"body"`
+}
+
+// ResolveArchive asks Cloud.Mail to pack a public folder, or a subfolder of
+// a deep link, into one ZIP archive and returns its URL. The archive holds
+// every file of the folder; the filter is not applied.
+func (r *Resolver) ResolveArchive(ctx context.Context, link string) (Archive, error) {
+	link = strings.TrimSpace(link)
+	linkID, err := parsePublicLinkID(link)
+	if err != nil {
+		return Archive{}, err
+	}
+
+	pageID, err := r.getPageID(ctx, shareURL(link, linkID))
+	if err != nil {
+		return Archive{}, err
+	}
+
+	// One entry is enough to learn the folder name and type.
+	response, err := r.folderPage(ctx, linkID, folderQuery{pageID: pageID}, 0, 1)
+	if err != nil {
+		return Archive{}, err
+	}
+	header := response.header()
+	if header.Type == "file" {
+		return Archive{}, fmt.Errorf("zip archive: %s is a file, not a folder", linkID)
+	}
+	name := header.Name
+	if name == "" {
+		name = path.Base(linkID)
+	}
+
+	weblinks, err := json.Marshal([]string{linkID})
+	if err != nil {
+		return Archive{}, err
+	}
+	form := url.Values{}
+	form.Set("weblink_list", string(weblinks))
+	form.Set("name", name)
+	form.Set("x-page-id", pageID)
+	form.Set("x-email", "anonym")
+	body, err := r.doPost(ctx, r.apiBase+"/zip/weblink", form)
+	if err != nil {
+		return Archive{}, err
+	}
+
+	var zipResponse zipAPIResponse
+	if err := json.Unmarshal([]byte(body), &zipResponse); err != nil {
+		return Archive{}, fmt.Errorf("decode zip response: %w", err)
+	}
+	archiveURL := strings.TrimSpace(zipResponse.Body)
+	if archiveURL == "" {
+		return Archive{}, errors.New("zip URL not found")
+	}
+	return Archive{URL: archiveURL, Name: name, RemotePath: linkID}, nil
+}
+
+// Keep reports whether the filter keeps an entry given by its path relative
+// to the resolved folder, as a folder walk would: every parent folder must
+// pass as well.
+func (r *Resolver) Keep(rel string, size int64, dir bool) bool {
+	rel = strings.Trim(rel, "/")
+	if rel == "" {
+		return true
+	}
+	segments := strings.Split(rel, "/")
+	if !dir {
+		segments = segments[:len(segments)-1]
+	}
+	for index := range segments {
+		if r.filter.skipDir(strings.Join(segments[:index+1], "/")) {
+			return false
+		}
+	}
+	return dir || r.filter.keepFile(rel, size)
+}
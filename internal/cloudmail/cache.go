@@ -0,0 +1,228 @@
+package cloudmail
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// DefaultCacheTTL is used when a cache is created without a TTL.
+const DefaultCacheTTL = time.Hour
+
+// Cache stores resolved folder trees on disk, one JSON file per weblink.
+// Entries keep remote paths and metadata only: download URLs are rebuilt from
+// a fresh dispatcher shard on every hit, so they never go stale.
+// A nil *Cache disables caching.
+type Cache struct {
+	dir string
+	ttl time.Duration
+}
+
+// CacheEntry describes one cached weblink.
+type CacheEntry struct {
+	LinkID  string
+	Files   int
+	Size    int64
+	Created time.Time
+	Expired bool
+	Path    string
+}
+
+type cacheRecord struct {
+	LinkID  string       `json:"link_id"`
+	API     string       `json:"api"`
+	Filter  string       `json:"filter,omitempty"`
+	Created time.Time    `json:"created"`
+	Files   []cachedFile `json:"files"`
+	// Dirs lists folders, including empty ones; it is nil in records of older versions.
+	Dirs []cachedDir `json:"dirs"`
+}
+
+type cachedDir struct {
+	Output     string `json:"output"`
+	RemotePath string `json:"remote_path"`
+	Empty      bool   `json:"empty,omitempty"`
+}
+
+type cachedFile struct {
+	RemotePath string    `json:"remote_path"`
+	Output     string    `json:"output"`
+	Size       int64     `json:"size"`
+	Hash       string    `json:"hash,omitempty"`
+	ModTime    time.Time `json:"mtime,omitzero"`
+}
+
+// NewCache returns a cache in dir; a non-positive ttl selects DefaultCacheTTL.
+func NewCache(dir string, ttl time.Duration) *Cache {
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	return &Cache{dir: dir, ttl: ttl}
+}
+
+// Dir returns the cache directory.
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// List returns cached weblinks sorted by link ID, including expired ones.
+func (c *Cache) List() ([]CacheEntry, error) {
+	paths, err := c.files()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	entries := make([]CacheEntry, 0, len(paths))
+	for _, path := range paths {
+		record, err := readCacheRecord(path)
+		if err != nil {
+			// Foreign or truncated files are reported but not fatal.
+			entries = append(entries, CacheEntry{Path: path, Expired: true})
+			continue
+		}
+		entry := CacheEntry{
+			LinkID:  record.LinkID,
+			Files:   len(record.Files),
+			Created: record.Created,
+			Expired: c.expired(record, now),
+			Path:    path,
+		}
+		for _, file := range record.Files {
+			entry.Size += file.Size
+		}
+		entries = append(entries, entry)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].LinkID < entries[j].LinkID
+	})
+	return entries, nil
+}
+
+// Clear removes cached entries, only expired or unreadable ones when expiredOnly is set.
+// It returns the number of removed entries.
+func (c *Cache) Clear(expiredOnly bool) (int, error) {
+	paths, err := c.files()
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	removed := 0
+	for _, path := range paths {
+		if expiredOnly {
+			if record, err := readCacheRecord(path); err == nil && !c.expired(record, now) {
+				continue
+			}
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+func (c *Cache) files() ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(c.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
+func (c *Cache) expired(record *cacheRecord, now time.Time) bool {
+	return now.Sub(record.Created) > c.ttl
+}
+
+// cacheKey identifies a weblink resolved through one API endpoint with one filter.
+func cacheKey(api string, linkID string, filter string) string {
+	sum := sha256.Sum256([]byte(api + "\x00" + linkID + "\x00" + filter))
+	return hex.EncodeToString(sum[:16])
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
+
+// load returns a fresh record, treating missing, expired and broken entries as misses.
+func (c *Cache) load(key string) (*cacheRecord, bool) {
+	if c == nil {
+		return nil, false
+	}
+	record, err := readCacheRecord(c.path(key))
+	if err != nil || c.expired(record, time.Now()) {
+		return nil, false
+	}
+	return record, true
+}
+
+func (c *Cache) store(key string, record *cacheRecord) error {
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return fmt.Errorf("create cache dir: %w", err)
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so readers never see a partial entry.
+	temp, err := os.CreateTemp(c.dir, key+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		os.Remove(temp.Name())
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+	if err := os.Rename(temp.Name(), c.path(key)); err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+	return nil
+}
+
+func readCacheRecord(path string) (*cacheRecord, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var record cacheRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("decode cache entry %s: %w", path, err)
+	}
+	return &record, nil
+}
+
+func toCachedFile(file File) cachedFile {
+	return cachedFile{
+		RemotePath: file.RemotePath,
+		Output:     file.Output,
+		Size:       file.Size,
+		Hash:       file.Hash,
+		ModTime:    file.ModTime,
+	}
+}
+
+// file rebuilds a file; its download URLs are assigned from fresh dispatcher shards.
+func (f cachedFile) file() File {
+	return File{
+		Output:     f.Output,
+		RemotePath: f.RemotePath,
+		Size:       f.Size,
+		Hash:       f.Hash,
+		ModTime:    f.ModTime,
+	}
+}
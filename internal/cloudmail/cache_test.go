@@ -0,0 +1,129 @@
+package cloudmail
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestResolveCache(t *testing.T) {
+	var folderRequests, shard atomic.Int32
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/public/AbCd/EfGh":
+			fmt.Fprint(w, `<script>window.cloudSettings={"params":{"pageId":"page1"}}</script>`)
+		case "/dispatcher":
+			fmt.Fprintf(w, `{"body":{"weblink_get":[{"url":"%s/shard%d"}]}}`, server.URL, shard.Add(1))
+		case "/folder":
+			folderRequests.Add(1)
+			switch r.URL.Query().Get("weblink") {
+			case "AbCd/EfGh":
+				fmt.Fprint(w, `{"body":{"type":"folder","name":"root","list":[{"type":"folder","name":"docs"},{"type":"file","name":"a.txt","size":1,"hash":"H1","mtime":1700000000}]}}`)
+			case "AbCd/EfGh/docs":
+				fmt.Fprint(w, `{"body":{"type":"folder","name":"docs","list":[{"type":"file","name":"b.pdf","size":2}]}}`)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	dir := t.TempDir()
+	newResolver := func(cache *Cache, filter Filter) *Resolver {
+		resolver, err := NewResolver(Config{APIBaseURL: server.URL, Cache: cache, Filter: filter})
+		if err != nil {
+			t.Fatalf("new resolver: %v", err)
+		}
+		return resolver
+	}
+	resolve := func(resolver *Resolver) []File {
+		files, err := resolver.Resolve(context.Background(), []string{server.URL + "/public/AbCd/EfGh"})
+		if err != nil {
+			t.Fatalf("resolve: %v", err)
+		}
+		return files
+	}
+
+	cache := NewCache(dir, time.Hour)
+	first := resolve(newResolver(cache, Filter{}))
+	listed := folderRequests.Load()
+	if len(first) != 2 || listed != 2 {
+		t.Fatalf("unexpected first resolve: files=%d folder requests=%d", len(first), listed)
+	}
+
+	second := resolve(newResolver(cache, Filter{}))
+	if folderRequests.Load() != listed {
+		t.Fatalf("cached resolve listed folders again: %d requests", folderRequests.Load())
+	}
+	for index, file := range second {
+		want := first[index]
+		want.URL = strings.Replace(want.URL, "/shard1/", "/shard2/", 1)
+		if !reflect.DeepEqual(file, want) {
+			t.Fatalf("cached file mismatch: got=%+v want=%+v", file, want)
+		}
+	}
+
+	var dirs []Dir
+	err := newResolver(cache, Filter{}).WalkLink(context.Background(), server.URL+"/public/AbCd/EfGh",
+		func(File) bool { return true },
+		func(dir Dir) bool { dirs = append(dirs, dir); return true })
+	if err != nil {
+		t.Fatalf("walk link: %v", err)
+	}
+	wantDirs := []Dir{{Output: "root", RemotePath: "AbCd/EfGh"}, {Output: "root/docs", RemotePath: "AbCd/EfGh/docs"}}
+	if !reflect.DeepEqual(dirs, wantDirs) || folderRequests.Load() != listed {
+		t.Fatalf("cached walk mismatch: dirs=%+v folder requests=%d", dirs, folderRequests.Load())
+	}
+
+	resolve(newResolver(cache, Filter{Extensions: []string{"pdf"}}))
+	if folderRequests.Load() == listed {
+		t.Fatalf("filtered resolve reused unfiltered cache entry")
+	}
+
+	listed = folderRequests.Load()
+	resolve(newResolver(NewCache(dir, time.Nanosecond), Filter{}))
+	if folderRequests.Load() == listed {
+		t.Fatalf("expired entry was reused")
+	}
+
+	entries, err := cache.List()
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(entries) != 2 || entries[0].LinkID != "AbCd/EfGh" || entries[0].Expired {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+	removed, err := cache.Clear(false)
+	if err != nil || removed != 2 {
+		t.Fatalf("clear mismatch: removed=%d err=%v", removed, err)
+	}
+}
+
+func TestResolveCacheSkipsIncompleteWalk(t *testing.T) {
+	server := newShareServer(t)
+	cache := NewCache(t.TempDir(), time.Hour)
+	resolver, err := NewResolver(Config{APIBaseURL: server.URL, Cache: cache})
+	if err != nil {
+		t.Fatalf("new resolver: %v", err)
+	}
+
+	for range resolver.ResolveStream(context.Background(), []string{server.URL + "/public/AbCd/EfGh"}) {
+		break
+	}
+	entries, err := cache.List()
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("stopped walk was cached: %+v", entries)
+	}
+}
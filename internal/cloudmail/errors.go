@@ -0,0 +1,65 @@
+package cloudmail
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Failures recognized in Cloud.Mail and download host responses.
+// HTTPError and page errors wrap them, so they match with errors.Is.
+var (
+	ErrNotFound      = errors.New("link not found")
+	ErrBlocked       = errors.New("link blocked")
+	ErrRateLimited   = errors.New("rate limited")
+	ErrQuotaExceeded = errors.New("traffic quota exceeded")
+	ErrAntiBot       = errors.New("anti-bot page")
+	// ErrAuthRequired reports a private link without a session, or a session
+	// the server rejected.
+	ErrAuthRequired = errors.New("authentication required")
+)
+
+// ErrorForStatus returns the failure an HTTP status stands for, or nil.
+func ErrorForStatus(code int) error {
+	switch code {
+	case http.StatusNotFound, http.StatusGone:
+		return ErrNotFound
+	case http.StatusUnavailableForLegalReasons:
+		return ErrBlocked
+	case http.StatusUnauthorized:
+		return ErrAuthRequired
+	case http.StatusTooManyRequests:
+		return ErrRateLimited
+	case http.StatusPaymentRequired, 509: // 509 Bandwidth Limit Exceeded
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// pageMarkers recognize public pages served instead of the share, checked in order.
+var pageMarkers = []struct {
+	marker string
+	err    error
+}{
+	{marker: "captcha", err: ErrAntiBot},
+	{marker: "not a robot", err: ErrAntiBot},
+	{marker: "не робот", err: ErrAntiBot},
+	{marker: "blocked", err: ErrBlocked},
+	{marker: "заблокирован", err: ErrBlocked},
+	{marker: "доступ к файлу ограничен", err: ErrBlocked},
+	{marker: "not_exists", err: ErrNotFound},
+	{marker: "ссылка не найдена", err: ErrNotFound},
+	{marker: "overquota", err: ErrQuotaExceeded},
+	{marker: "превышен лимит", err: ErrQuotaExceeded},
+}
+
+// classifyPage returns the failure a public page without page id reports, or nil.
+func classifyPage(body string) error {
+	lower := strings.ToLower(body)
+	for _, page := range pageMarkers {
+		if strings.Contains(lower, page.marker) {
+			return page.err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package cloudmail
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Filter selects files during folder traversal.
+// Paths are matched relative to the resolved folder with "/" separators,
+// e.g. "video/2024/a.mp4". An empty Filter keeps every file.
+type Filter struct {
+	// Include keeps only files matching at least one glob pattern.
+	Include []string
+	// Exclude skips files and prunes folders matching any glob pattern.
+	Exclude []string
+	// IncludeRegex keeps only files matching at least one regular expression.
+	IncludeRegex []string
+	// ExcludeRegex skips files and prunes folders matching any regular expression.
+	ExcludeRegex []string
+	// Extensions keeps only files with one of the extensions, with or without the dot.
+	Extensions []string
+	// MinSize skips files smaller than MinSize bytes.
+	MinSize int64
+	// MaxSize skips files larger than MaxSize bytes; zero means no limit.
+	MaxSize int64
+	// MaxDepth limits traversal depth; files of the resolved folder have depth 1.
+	// Zero means no limit.
+	MaxDepth int
+}
+
+// Validate reports invalid patterns or bounds.
+func (f Filter) Validate() error {
+	_, err := f.compile()
+	return err
+}
+
+// IsZero reports whether the filter keeps every file.
+func (f Filter) IsZero() bool {
+	return len(f.Include) == 0 && len(f.Exclude) == 0 &&
+		len(f.IncludeRegex) == 0 && len(f.ExcludeRegex) == 0 &&
+		len(f.Extensions) == 0 && f.MinSize == 0 && f.MaxSize == 0 && f.MaxDepth == 0
+}
+
+// pathPattern is a compiled glob or regular expression.
+// Glob patterns without "/" match the base name at any depth, like .gitignore;
+// a trailing "/" restricts the pattern to folders.
+type pathPattern struct {
+	re       *regexp.Regexp
+	baseName bool
+	dirOnly  bool
+}
+
+func (p pathPattern) match(rel string, dir bool) bool {
+	if p.dirOnly && !dir {
+		return false
+	}
+	target := rel
+	if p.baseName {
+		target = path.Base(rel)
+	}
+	if p.re.MatchString(target) {
+		return true
+	}
+	// Lets "video/**" and "^video/" prune the "video" folder itself.
+	return dir && p.re.MatchString(target+"/")
+}
+
+type fileFilter struct {
+	include    []pathPattern
+	exclude    []pathPattern
+	extensions map[string]bool
+	minSize    int64
+	maxSize    int64
+	maxDepth   int
+}
+
+func (f Filter) compile() (*fileFilter, error) {
+	if f.IsZero() {
+		return nil, nil
+	}
+	if f.MinSize < 0 || f.MaxSize < 0 || f.MaxDepth < 0 {
+		return nil, errors.New("filter bounds must not be negative")
+	}
+	if f.MaxSize > 0 && f.MinSize > f.MaxSize {
+		return nil, fmt.Errorf("filter min size %d exceeds max size %d", f.MinSize, f.MaxSize)
+	}
+
+	compiled := &fileFilter{
+		minSize:  f.MinSize,
+		maxSize:  f.MaxSize,
+		maxDepth: f.MaxDepth,
+	}
+	for _, list := range []struct {
+		patterns []string
+		regex    bool
+		target   *[]pathPattern
+	}{
+		{f.Include, false, &compiled.include},
+		{f.IncludeRegex, true, &compiled.include},
+		{f.Exclude, false, &compiled.exclude},
+		{f.ExcludeRegex, true, &compiled.exclude},
+	} {
+		for _, raw := range list.patterns {
+			raw = strings.TrimSpace(raw)
+			if raw == "" {
+				continue
+			}
+			pattern, err := compilePattern(raw, list.regex)
+			if err != nil {
+				return nil, fmt.Errorf("invalid filter pattern %q: %w", raw, err)
+			}
+			*list.target = append(*list.target, pattern)
+		}
+	}
+	for _, ext := range f.Extensions {
+		ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))
+		if ext == "" {
+			continue
+		}
+		if compiled.extensions == nil {
+			compiled.extensions = make(map[string]bool)
+		}
+		compiled.extensions[ext] = true
+	}
+	return compiled, nil
+}
+
+func compilePattern(raw string, regex bool) (pathPattern, error) {
+	if regex {
+		re, err := regexp.Compile(raw)
+		return pathPattern{re: re}, err
+	}
+
+	pattern := pathPattern{}
+	if strings.HasSuffix(raw, "/") {
+		pattern.dirOnly = true
+		raw = strings.TrimRight(raw, "/")
+	}
+	raw = strings.TrimPrefix(raw, "/")
+	pattern.baseName = !strings.Contains(raw, "/")
+	re, err := regexp.Compile(globToRegexp(raw))
+	pattern.re = re
+	return pattern, err
+}
+
+// globToRegexp converts a glob with "*", "?", "[...]" and "**" into an anchored expression.
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+				if i+1 < len(glob) && glob[i+1] == '/' {
+					i++
+					b.WriteString("(?:.*/)?")
+					continue
+				}
+				b.WriteString(".*")
+				continue
+			}
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// skipDir reports whether a folder subtree can be pruned without listing it.
+func (f *fileFilter) skipDir(rel string) bool {
+	if f == nil {
+		return false
+	}
+	if f.maxDepth > 0 && pathDepth(rel) >= f.maxDepth {
+		return true
+	}
+	for _, pattern := range f.exclude {
+		if pattern.match(rel, true) {
+			return true
+		}
+	}
+	return false
+}
+
+// keepFile reports whether a file passes the filter.
+func (f *fileFilter) keepFile(rel string, size int64) bool {
+	if f == nil {
+		return true
+	}
+	if f.maxDepth > 0 && pathDepth(rel) > f.maxDepth {
+		return false
+	}
+	if size < f.minSize || (f.maxSize > 0 && size > f.maxSize) {
+		return false
+	}
+	if f.extensions != nil {
+		ext := strings.ToLower(strings.TrimPrefix(path.Ext(rel), "."))
+		if !f.extensions[ext] {
+			return false
+		}
+	}
+	for _, pattern := range f.exclude {
+		if pattern.match(rel, false) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, pattern := range f.include {
+		if pattern.match(rel, false) {
+			return true
+		}
+	}
+	return false
+}
+
+func pathDepth(rel string) int {
+	return strings.Count(rel, "/") + 1
+}
@@ -0,0 +1,172 @@
+package cloudmail
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestFilterKeepFile(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+		rel    string
+		size   int64
+		want   bool
+	}{
+		{name: "empty keeps all", filter: Filter{}, rel: "a/b.bin", want: true},
+		{name: "base glob any depth", filter: Filter{Include: []string{"*.pdf"}}, rel: "docs/2024/a.PDF", want: false},
+		{name: "base glob match", filter: Filter{Include: []string{"*.pdf"}}, rel: "docs/2024/a.pdf", want: true},
+		{name: "path glob", filter: Filter{Include: []string{"docs/*.txt"}}, rel: "docs/sub/a.txt", want: false},
+		{name: "double star", filter: Filter{Include: []string{"docs/**/*.txt"}}, rel: "docs/sub/a.txt", want: true},
+		{name: "double star root", filter: Filter{Include: []string{"docs/**/*.txt"}}, rel: "docs/a.txt", want: true},
+		{name: "exclude wins", filter: Filter{Include: []string{"*"}, Exclude: []string{"*.tmp"}}, rel: "a.tmp", want: false},
+		{name: "dir only pattern keeps files", filter: Filter{Exclude: []string{"video/"}}, rel: "video", want: true},
+		{name: "include regex", filter: Filter{IncludeRegex: []string{`^music/.*\.flac$`}}, rel: "music/x/a.flac", want: true},
+		{name: "exclude regex", filter: Filter{ExcludeRegex: []string{`(?i)sample`}}, rel: "Sample.mkv", want: false},
+		{name: "extension case", filter: Filter{Extensions: []string{".PDF", "djvu"}}, rel: "a.pdf", want: true},
+		{name: "extension miss", filter: Filter{Extensions: []string{"pdf"}}, rel: "a.txt", want: false},
+		{name: "under max size", filter: Filter{MaxSize: 10}, rel: "a", size: 10, want: true},
+		{name: "over max size", filter: Filter{MaxSize: 10}, rel: "a", size: 11, want: false},
+		{name: "under min size", filter: Filter{MinSize: 5}, rel: "a", size: 4, want: false},
+		{name: "max depth", filter: Filter{MaxDepth: 1}, rel: "sub/a", want: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			filter, err := tc.filter.compile()
+			if err != nil {
+				t.Fatalf("compile: %v", err)
+			}
+			if got := filter.keepFile(tc.rel, tc.size); got != tc.want {
+				t.Fatalf("keepFile(%q) got=%v want=%v", tc.rel, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFilterSkipDir(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+		rel    string
+		want   bool
+	}{
+		{name: "base name", filter: Filter{Exclude: []string{"video"}}, rel: "a/video", want: true},
+		{name: "dir only", filter: Filter{Exclude: []string{"video/"}}, rel: "video", want: true},
+		{name: "subtree glob", filter: Filter{Exclude: []string{"video/**"}}, rel: "video", want: true},
+		{name: "regex prefix", filter: Filter{ExcludeRegex: []string{"^video/"}}, rel: "video", want: true},
+		{name: "other folder", filter: Filter{Exclude: []string{"video/**"}}, rel: "music", want: false},
+		{name: "include never prunes", filter: Filter{Include: []string{"*.pdf"}}, rel: "docs", want: false},
+		{name: "max depth", filter: Filter{MaxDepth: 2}, rel: "a/b", want: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			filter, err := tc.filter.compile()
+			if err != nil {
+				t.Fatalf("compile: %v", err)
+			}
+			if got := filter.skipDir(tc.rel); got != tc.want {
+				t.Fatalf("skipDir(%q) got=%v want=%v", tc.rel, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestResolverKeep(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+		rel    string
+		dir    bool
+		want   bool
+	}{
+		{name: "empty keeps all", filter: Filter{}, rel: "a/b/c.txt", want: true},
+		{name: "excluded parent", filter: Filter{Exclude: []string{"b/"}}, rel: "a/b/c.txt", want: false},
+		{name: "excluded folder", filter: Filter{Exclude: []string{"b/"}}, rel: "a/b", dir: true, want: false},
+		{name: "include does not drop folders", filter: Filter{Include: []string{"*.md"}}, rel: "a/b", dir: true, want: true},
+		{name: "include drops files", filter: Filter{Include: []string{"*.md"}}, rel: "a/b/c.txt", want: false},
+		{name: "max depth folder", filter: Filter{MaxDepth: 2}, rel: "a/b", dir: true, want: false},
+		{name: "max depth file", filter: Filter{MaxDepth: 2}, rel: "a/c.txt", want: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resolver, err := NewResolver(Config{Filter: tc.filter})
+			if err != nil {
+				t.Fatalf("new resolver: %v", err)
+			}
+			if got := resolver.Keep(tc.rel, 0, tc.dir); got != tc.want {
+				t.Fatalf("keep %q mismatch: got=%v want=%v", tc.rel, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFilterValidate(t *testing.T) {
+	invalid := []Filter{
+		{IncludeRegex: []string{"("}},
+		{MinSize: 10, MaxSize: 5},
+		{MaxDepth: -1},
+	}
+	for _, filter := range invalid {
+		if err := filter.Validate(); err == nil {
+			t.Fatalf("expected error for %+v", filter)
+		}
+	}
+}
+
+func TestWalkFolderPrunesExcludedFolders(t *testing.T) {
+	tree := newTreeServer(t, 2, 0)
+	var (
+		mu     sync.Mutex
+		listed []string
+	)
+	counting := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		listed = append(listed, r.URL.Query().Get("weblink"))
+		mu.Unlock()
+		tree.Config.Handler.ServeHTTP(w, r)
+	})
+	server := httptest.NewServer(counting)
+	defer server.Close()
+
+	for _, workers := range []int{0, 4} {
+		listed = nil
+		resolver, err := NewResolver(Config{Workers: workers, Filter: Filter{
+			Exclude:    []string{"d1/"},
+			Extensions: []string{"txt"},
+			MinSize:    1,
+		}})
+		if err != nil {
+			t.Fatalf("new resolver: %v", err)
+		}
+		resolver.apiBase = server.URL
+
+		var files []File
+		err = resolver.walk(context.Background(), "AbCd/EfGh", folderQuery{pageID: "page"}, "https://cdn.example", func(file File) bool {
+			files = append(files, file)
+			return true
+		}, nil)
+		if err != nil {
+			t.Fatalf("walk: %v", err)
+		}
+
+		// Folders: root, d0, d0/d0 (d1 subtrees pruned); files f1 and f2 of each.
+		if len(files) != 6 {
+			t.Fatalf("workers=%d: unexpected files count: got=%d want=6", workers, len(files))
+		}
+		for _, link := range listed {
+			if strings.Contains(link, "/d1") {
+				t.Fatalf("workers=%d: excluded folder was listed: %s", workers, link)
+			}
+		}
+		if len(listed) != 3 {
+			t.Fatalf("workers=%d: unexpected listings: %v", workers, listed)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package cloudmail
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// HashSize is the size of Cloud.Mail content hash in bytes.
+const HashSize = 20
+
+const hashPrefix = "mrCloud"
+
+// contentHash implements Cloud.Mail content hash: files up to 20 bytes are
+// stored as zero-padded content, larger files as SHA1("mrCloud" + content + size).
+type contentHash struct {
+	sha   hash.Hash
+	small []byte
+	total int64
+}
+
+// NewHash returns hash.Hash computing Cloud.Mail content hash.
+func NewHash() hash.Hash {
+	h := &contentHash{sha: sha1.New()}
+	h.Reset()
+	return h
+}
+
+func (h *contentHash) Write(p []byte) (int, error) {
+	if h.total < HashSize {
+		rest := HashSize - int(h.total)
+		if rest > len(p) {
+			rest = len(p)
+		}
+		h.small = append(h.small, p[:rest]...)
+	}
+	h.total += int64(len(p))
+	return h.sha.Write(p)
+}
+
+func (h *contentHash) Sum(b []byte) []byte {
+	if h.total <= HashSize {
+		padded := make([]byte, HashSize)
+		copy(padded, h.small)
+		return append(b, padded...)
+	}
+
+	// Clone SHA1 state so that Sum does not change the running hash.
+	state, err := h.sha.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		panic(err)
+	}
+	clone := sha1.New()
+	if err := clone.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+		panic(err)
+	}
+	clone.Write([]byte(strconv.FormatInt(h.total, 10)))
+	return clone.Sum(b)
+}
+
+func (h *contentHash) Reset() {
+	h.sha.Reset()
+	h.sha.Write([]byte(hashPrefix))
+	h.small = h.small[:0]
+	h.total = 0
+}
+
+func (h *contentHash) Size() int {
+	return HashSize
+}
+
+func (h *contentHash) BlockSize() int {
+	return sha1.BlockSize
+}
+
+// HashReader returns Cloud.Mail content hash of reader data in upper-case hex.
+func HashReader(reader io.Reader) (string, error) {
+	h := NewHash()
+	if _, err := io.Copy(h, reader); err != nil {
+		return "", err
+	}
+	return strings.ToUpper(hex.EncodeToString(h.Sum(nil))), nil
+}
+
+// HashFile returns Cloud.Mail content hash of a local file in upper-case hex.
+// It stops with ctx.Err() when ctx is canceled.
+func HashFile(ctx context.Context, path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return HashReader(contextReader{ctx: ctx, reader: file})
+}
+
+// contextReader fails reads once ctx is canceled.
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(p)
+}
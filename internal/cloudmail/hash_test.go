@@ -0,0 +1,62 @@
+package cloudmail
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestHashReader(t *testing.T) {
+	large := strings.Repeat("cloud.mail content ", 8)
+	largeSum := sha1.Sum([]byte("mrCloud" + large + "152"))
+
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{
+			name: "empty",
+			data: "",
+			want: "0000000000000000000000000000000000000000",
+		},
+		{
+			name: "small padded",
+			data: "abc",
+			want: "6162630000000000000000000000000000000000",
+		},
+		{
+			name: "exactly hash size",
+			data: "0123456789abcdefghij",
+			want: strings.ToUpper(hex.EncodeToString([]byte("0123456789abcdefghij"))),
+		},
+		{
+			name: "large sha1",
+			data: large,
+			want: strings.ToUpper(hex.EncodeToString(largeSum[:])),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := HashReader(strings.NewReader(tc.data))
+			if err != nil {
+				t.Fatalf("HashReader returned error: %v", err)
+			}
+			if got != tc.want {
+				t.Fatalf("hash mismatch: got=%s want=%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestHashSumKeepsState(t *testing.T) {
+	h := NewHash()
+	h.Write([]byte(strings.Repeat("x", 32)))
+	first := h.Sum(nil)
+	second := h.Sum(nil)
+	if hex.EncodeToString(first) != hex.EncodeToString(second) {
+		t.Fatalf("Sum changed running state")
+	}
+}
@@ -0,0 +1,162 @@
+package cloudmail
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type csrfAPIResponse struct {
+	Body struct {
+		Token string `json:"token"`
+	} `json:"body"`
+}
+
+// IsPrivateLink reports whether link addresses a path of the logged-in
+// account, e.g. https://cloud.mail.ru/home/Photos, rather than a public share.
+func IsPrivateLink(link string) bool {
+	_, err := parsePrivatePath(link)
+	return err == nil
+}
+
+// parsePrivatePath returns the URL-decoded account path after /home,
+// without the leading "/"; the account root is "".
+func parsePrivatePath(link string) (string, error) {
+	parsed, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return "", fmt.Errorf("wrong private link: %s", link)
+	}
+	escaped := parsed.EscapedPath()
+	if escaped != "/home" && !strings.HasPrefix(escaped, "/home/") {
+		return "", fmt.Errorf("wrong private link: %s", link)
+	}
+
+	var segments []string
+	for _, part := range strings.Split(strings.TrimPrefix(escaped, "/home"), "/") {
+		if part == "" {
+			continue
+		}
+		decoded, err := url.PathUnescape(part)
+		if err != nil {
+			decoded = part
+		}
+		segments = append(segments, decoded)
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+// resolvePrivateLink walks a folder of the logged-in account. Remote paths of
+// its files and folders start with "/", which tells them from weblinks.
+// Private listings are not cached.
+func (r *Resolver) resolvePrivateLink(ctx context.Context, link string, emit func(File) bool, dir func(Dir) bool) error {
+	if r.session == nil {
+		return fmt.Errorf("%w: %s is a private link, a session is needed", ErrAuthRequired, link)
+	}
+	home, err := parsePrivatePath(link)
+	if err != nil {
+		return err
+	}
+
+	token, baseURLs, err := r.privateBaseURLs(ctx)
+	if err != nil {
+		return err
+	}
+
+	shards := newShardSet(baseURLs)
+	file := shards.emitter(func(file File) bool {
+		file.RemotePath = "/" + file.RemotePath
+		return emit(file)
+	})
+	var folder func(Dir) bool
+	if dir != nil {
+		folder = func(folder Dir) bool {
+			folder.RemotePath = "/" + folder.RemotePath
+			return dir(folder)
+		}
+	}
+	err = r.walk(ctx, home, folderQuery{home: true, token: token}, baseURLs[0], file, folder)
+	if tokenRejected(err) {
+		r.dropToken(token)
+	}
+	return err
+}
+
+// privateBaseURLs returns the session token and the download hosts of the
+// account. A token the API rejects is dropped and requested again once, so
+// a resolver that outlived its token keeps working while the session is valid.
+func (r *Resolver) privateBaseURLs(ctx context.Context) (string, []string, error) {
+	for retried := false; ; retried = true {
+		token, err := r.csrfToken(ctx)
+		if err != nil {
+			return "", nil, err
+		}
+		baseURLs, err := r.getPrivateBaseURLs(ctx, token)
+		if !tokenRejected(err) {
+			return token, baseURLs, err
+		}
+		r.dropToken(token)
+		if retried {
+			return "", nil, fmt.Errorf("%w: the session token was rejected: %w", ErrAuthRequired, err)
+		}
+	}
+}
+
+// csrfToken returns the API token of the session, requesting it when the
+// resolver has none yet or dropped a rejected one.
+func (r *Resolver) csrfToken(ctx context.Context) (string, error) {
+	r.tokenMu.Lock()
+	defer r.tokenMu.Unlock()
+	if r.token != "" {
+		return r.token, nil
+	}
+
+	body, err := r.doPost(ctx, r.apiBase+"/tokens/csrf", url.Values{})
+	if err != nil {
+		return "", fmt.Errorf("session token: %w", err)
+	}
+	var response csrfAPIResponse
+	if err := json.Unmarshal([]byte(body), &response); err != nil {
+		return "", fmt.Errorf("decode token response: %w", err)
+	}
+	if response.Body.Token == "" {
+		return "", fmt.Errorf("%w: no session token, the session may have expired", ErrAuthRequired)
+	}
+	r.token = response.Body.Token
+	return r.token, nil
+}
+
+// dropToken forgets token unless another caller has already replaced it.
+func (r *Resolver) dropToken(token string) {
+	r.tokenMu.Lock()
+	if r.token == token {
+		r.token = ""
+	}
+	r.tokenMu.Unlock()
+}
+
+// tokenRejected reports whether an account API call failed because of the
+// session token: Cloud.Mail answers a stale token with 401 or 403.
+func tokenRejected(err error) bool {
+	var httpErr *HTTPError
+	return errors.As(err, &httpErr) && (httpErr.StatusCode == http.StatusUnauthorized || httpErr.StatusCode == http.StatusForbidden)
+}
+
+// getPrivateBaseURLs returns the download hosts for files of the account.
+func (r *Resolver) getPrivateBaseURLs(ctx context.Context, token string) ([]string, error) {
+	values := url.Values{}
+	values.Set("token", token)
+	body, err := r.doGet(ctx, fmt.Sprintf("%s/dispatcher?%s", r.apiBase, values.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	var response dispatcherAPIResponse
+	if err := json.Unmarshal([]byte(body), &response); err != nil {
+		return nil, fmt.Errorf("decode dispatcher response: %w", err)
+	}
+	return shardURLs(response.Body.Get)
+}
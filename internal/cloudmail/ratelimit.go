@@ -0,0 +1,55 @@
+package cloudmail
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter is a token-bucket limiter for API requests: it allows Rate requests
+// per second on average and bursts of up to Burst requests.
+// One Limiter may be shared by several Resolvers; a nil Limiter does not limit.
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter returns a limiter for rate requests per second with the given burst.
+// A rate of zero or less disables limiting and returns nil; burst is at least 1.
+func NewLimiter(rate float64, burst int) *Limiter {
+	if rate <= 0 {
+		return nil
+	}
+	burst = max(burst, 1)
+	return &Limiter{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// Wait blocks until a request may be sent and returns how long it waited.
+func (l *Limiter) Wait(ctx context.Context) (time.Duration, error) {
+	if l == nil {
+		return 0, ctx.Err()
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens--
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return 0, ctx.Err()
+	}
+	if err := sleepContext(ctx, delay); err != nil {
+		// Give the reserved token back to the callers still waiting.
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return 0, err
+	}
+	return delay, nil
+}
@@ -0,0 +1,61 @@
+package cloudmail
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	if limiter := NewLimiter(0, 5); limiter != nil {
+		t.Fatalf("zero rate must disable limiting")
+	}
+	var unlimited *Limiter
+	if delay, err := unlimited.Wait(context.Background()); delay != 0 || err != nil {
+		t.Fatalf("nil limiter waited: delay=%s err=%v", delay, err)
+	}
+
+	limiter := NewLimiter(50, 2)
+	for i := range 2 {
+		if delay, err := limiter.Wait(context.Background()); delay != 0 || err != nil {
+			t.Fatalf("burst request %d waited: delay=%s err=%v", i, delay, err)
+		}
+	}
+	delay, err := limiter.Wait(context.Background())
+	if err != nil || delay <= 0 || delay > 20*time.Millisecond {
+		t.Fatalf("unexpected delay after burst: delay=%s err=%v", delay, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := limiter.Wait(ctx); err == nil {
+		t.Fatalf("expected error for canceled context")
+	}
+}
+
+func TestResolveReportsRateLimitWait(t *testing.T) {
+	server := newShareServer(t)
+	resolver, err := NewResolver(Config{APIBaseURL: server.URL, Limiter: NewLimiter(200, 1)})
+	if err != nil {
+		t.Fatalf("new resolver: %v", err)
+	}
+
+	var (
+		mu     sync.Mutex
+		events []Event
+	)
+	ctx := WithEvents(context.Background(), func(event Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		if event.Kind == "ratelimit" {
+			events = append(events, event)
+		}
+	})
+	if _, err := resolver.Resolve(ctx, []string{server.URL + "/public/AbCd/EfGh"}); err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if len(events) != 1 || events[0].RateLimitWait <= 0 {
+		t.Fatalf("unexpected rate limit events: %+v", events)
+	}
+}
@@ -6,45 +6,94 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"iter"
 	"net/http"
 	"net/url"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
-)
 
-const defaultAPIBaseURL = "https://cloud.mail.ru/api/v2"
+	"github.com/jhonroun/cmrd/internal/proxypool"
+)
 
-var (
-	publicLinkIDRE = regexp.MustCompile(`/public/([^/?#]+/[^/?#]+)`)
-	pageIDRE       = regexp.MustCompile(`pageId['"]*:\s*['"]*([^"'\\s,]+)`)
+const (
+	defaultAPIBaseURL = "https://cloud.mail.ru/api/v2"
+	defaultPageSize   = 500
 )
 
+// maxFolderPages bounds the pages of one folder listing.
+var maxFolderPages = 10000
+
+// ErrIncompleteListing reports a folder listing that ended before the reported entry count.
+var ErrIncompleteListing = errors.New("incomplete folder listing")
+
+var pageIDRE = regexp.MustCompile(`pageId['"]*:\s*['"]*([^"'\s,]+)`)
+
 type folderAPIResponse struct {
 	Body struct {
-		Name string `json:"name"`
-		List []struct {
-			Type string `json:"type"`
-			Name string `json:"name"`
-		} `json:"list"`
+		// Type, Size, Hash and MTime describe the weblink itself;
+		// Type is "file" when the weblink points at a single file.
+		Type  string `json:"type"`
+		Name  string `json:"name"`
+		Size  int64  `json:"size"`
+		Hash  string `json:"hash"`
+		MTime int64  `json:"mtime"`
+		Count struct {
+			Folders int `json:"folders"`
+			Files   int `json:"files"`
+		} `json:"count"`
+		List []folderItem `json:"list"`
 	} `json:"body"`
 }
 
+type folderItem struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Size  int64  `json:"size"`
+	Hash  string `json:"hash"`
+	MTime int64  `json:"mtime"`
+}
+
 type dispatcherAPIResponse struct {
 	Body struct {
-		WeblinkGet []struct {
-			URL string `json:"url"`
-		} `json:"weblink_get"`
+		// WeblinkGet serves public shares, Get serves files of the account.
+		WeblinkGet []dispatcherShard `json:"weblink_get"`
+		Get        []dispatcherShard `json:"get"`
 	} `json:"body"`
 }
 
+type dispatcherShard struct {
+	URL string `json:"url"`
+}
+
 // Config configures resolver network behavior.
 type Config struct {
 	Timeout   time.Duration
-	Proxy     string
-	ProxyAuth string
 	UserAgent string
+	// Proxies routes API requests through a proxy pool; nil connects directly.
+	Proxies *proxypool.Pool
+	// APIBaseURL overrides the Cloud.Mail API endpoint, e.g. for a fake server in tests.
+	APIBaseURL string
+	// HTTPClient overrides the HTTP client; Timeout and proxy settings are then ignored.
+	HTTPClient *http.Client
+	// PageSize is the number of entries requested per folder API page.
+	PageSize int
+	// Workers is the number of concurrent folder requests; values below 2 walk sequentially.
+	Workers int
+	// Retry configures retries of transient API failures.
+	Retry RetryPolicy
+	// Filter selects files during traversal; excluded folders are not listed.
+	Filter Filter
+	// Cache reuses resolved trees between runs; nil disables caching.
+	Cache *Cache
+	// Limiter throttles every API request of the resolver; nil does not limit.
+	Limiter *Limiter
+	// Session authenticates API requests and enables private links; nil stays anonymous.
+	Session *Session
 }
 
 // Resolver resolves Cloud.Mail public links into direct file links.
@@ -52,106 +101,366 @@ type Resolver struct {
 	client    *http.Client
 	apiBase   string
 	userAgent string
+	pageSize  int
+	workers   int
+	retry     RetryPolicy
+	filter    *fileFilter
+	cache     *Cache
+	// filterKey separates cache entries resolved with different filters.
+	filterKey string
+	limiter   *Limiter
+	// waited is the total time spent on the limiter; reported is the unix
+	// time in nanoseconds of the last rate limit event.
+	waited   atomic.Int64
+	reported atomic.Int64
+	session  *Session
+	// token is the API token of the session, requested on first use.
+	tokenMu sync.Mutex
+	token   string
 }
 
 // NewResolver creates a new resolver instance.
 func NewResolver(cfg Config) (*Resolver, error) {
-	timeout := cfg.Timeout
-	if timeout <= 0 {
-		timeout = 30 * time.Second
+	client := cfg.HTTPClient
+	if client == nil {
+		var err error
+		if client, err = newHTTPClient(cfg); err != nil {
+			return nil, err
+		}
 	}
 
-	transport, ok := http.DefaultTransport.(*http.Transport)
-	if !ok {
-		return nil, errors.New("unexpected default transport type")
+	userAgent := strings.TrimSpace(cfg.UserAgent)
+	if userAgent == "" {
+		userAgent = "cmrd/0.1"
+	}
+
+	apiBase := strings.TrimRight(strings.TrimSpace(cfg.APIBaseURL), "/")
+	if apiBase == "" {
+		apiBase = defaultAPIBaseURL
 	}
-	cloned := transport.Clone()
 
-	if strings.TrimSpace(cfg.Proxy) != "" {
-		proxyURL, err := buildProxyURL(cfg.Proxy, cfg.ProxyAuth)
+	filter, err := cfg.Filter.compile()
+	if err != nil {
+		return nil, err
+	}
+	var filterKey string
+	if !cfg.Filter.IsZero() {
+		data, err := json.Marshal(cfg.Filter)
 		if err != nil {
-			return nil, fmt.Errorf("invalid proxy config: %w", err)
+			return nil, err
 		}
-		cloned.Proxy = http.ProxyURL(proxyURL)
+		filterKey = string(data)
 	}
 
-	userAgent := strings.TrimSpace(cfg.UserAgent)
-	if userAgent == "" {
-		userAgent = "cmrd/0.1"
+	pageSize := cfg.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
 	}
 
 	return &Resolver{
-		client: &http.Client{
-			Timeout:   timeout,
-			Transport: cloned,
-		},
-		apiBase:   defaultAPIBaseURL,
+		client:    client,
+		apiBase:   apiBase,
 		userAgent: userAgent,
+		pageSize:  pageSize,
+		workers:   cfg.Workers,
+		retry:     cfg.Retry.normalized(),
+		filter:    filter,
+		cache:     cfg.Cache,
+		filterKey: filterKey,
+		limiter:   cfg.Limiter,
+		session:   cfg.Session,
 	}, nil
 }
 
-func buildProxyURL(proxyValue string, proxyAuth string) (*url.URL, error) {
-	proxyValue = strings.TrimSpace(proxyValue)
-	if !strings.Contains(proxyValue, "://") {
-		proxyValue = "http://" + proxyValue
+func newHTTPClient(cfg Config) (*http.Client, error) {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
 	}
-	parsed, err := url.Parse(proxyValue)
-	if err != nil {
-		return nil, err
+
+	transport, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return nil, errors.New("unexpected default transport type")
 	}
-	if strings.TrimSpace(proxyAuth) != "" {
-		parts := strings.SplitN(proxyAuth, ":", 2)
-		if len(parts) == 2 {
-			parsed.User = url.UserPassword(parts[0], parts[1])
-		} else {
-			parsed.User = url.User(parts[0])
-		}
+	cloned := transport.Clone()
+
+	var roundTripper http.RoundTripper = cloned
+	if cfg.Proxies != nil {
+		roundTripper = cfg.Proxies.Transport(cloned)
 	}
-	return parsed, nil
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: roundTripper,
+	}, nil
 }
 
 // Resolve resolves a list of public links.
 func (r *Resolver) Resolve(ctx context.Context, links []string) ([]File, error) {
 	var all []File
+	for file, err := range r.ResolveStream(ctx, links) {
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, file)
+	}
+	return all, nil
+}
+
+// ResolveStream yields files as soon as they are discovered, in the same order as Resolve.
+// An error is yielded inline and ends the stream.
+func (r *Resolver) ResolveStream(ctx context.Context, links []string) iter.Seq2[File, error] {
+	return func(yield func(File, error) bool) {
+		for _, raw := range links {
+			link := strings.TrimSpace(raw)
+			if link == "" {
+				continue
+			}
+			for file, err := range r.ResolveLinkStream(ctx, link) {
+				if err != nil {
+					yield(File{}, fmt.Errorf("resolve %q: %w", link, err))
+					return
+				}
+				if !yield(file, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// ResolveLinkStream yields files of one public or private link as soon as they are discovered.
+// An error is yielded inline and ends the stream.
+func (r *Resolver) ResolveLinkStream(ctx context.Context, link string) iter.Seq2[File, error] {
+	return func(yield func(File, error) bool) {
+		err := r.resolveLink(ctx, strings.TrimSpace(link), func(file File) bool {
+			return yield(file, nil)
+		}, nil)
+		if err != nil && !errors.Is(err, errStopWalk) {
+			yield(File{}, err)
+		}
+	}
+}
+
+// ResolveAll resolves every link independently, so one dead link does not abort the batch.
+// Results keep the order of the input links; blank lines are skipped.
+func (r *Resolver) ResolveAll(ctx context.Context, links []string) []LinkResult {
+	var results []LinkResult
 	for _, raw := range links {
 		link := strings.TrimSpace(raw)
 		if link == "" {
 			continue
 		}
-		files, err := r.resolvePublicLink(ctx, link)
+		results = append(results, r.ResolveLink(ctx, link))
+	}
+	return results
+}
+
+// ResolveLink resolves one public link and reports its files, error and timing.
+func (r *Resolver) ResolveLink(ctx context.Context, link string) LinkResult {
+	result := LinkResult{Link: link}
+	started := time.Now()
+	for file, err := range r.ResolveLinkStream(ctx, link) {
 		if err != nil {
-			return nil, fmt.Errorf("resolve %q: %w", link, err)
+			result.Files = nil
+			result.Err = err
+			break
 		}
-		all = append(all, files...)
+		result.Files = append(result.Files, file)
 	}
-	return all, nil
+	result.Duration = time.Since(started)
+	return result
+}
+
+// errStopWalk is returned by folder walks when the consumer stops early.
+var errStopWalk = errors.New("walk stopped")
+
+// WalkLink resolves one public link like ResolveLinkStream and also reports
+// every folder, including empty ones, to dir before the folder contents.
+// Folders pruned by the filter are not reported.
+func (r *Resolver) WalkLink(ctx context.Context, link string, file func(File) bool, dir func(Dir) bool) error {
+	err := r.resolveLink(ctx, strings.TrimSpace(link), file, dir)
+	if errors.Is(err, errStopWalk) {
+		return nil
+	}
+	return err
+}
+
+func (r *Resolver) resolveLink(ctx context.Context, link string, emit func(File) bool, dir func(Dir) bool) error {
+	if IsPrivateLink(link) {
+		return r.resolvePrivateLink(ctx, link, emit, dir)
+	}
+	return r.resolvePublicLink(ctx, link, emit, dir)
 }
 
-func (r *Resolver) resolvePublicLink(ctx context.Context, link string) ([]File, error) {
+func (r *Resolver) resolvePublicLink(ctx context.Context, link string, emit func(File) bool, dir func(Dir) bool) error {
 	linkID, err := parsePublicLinkID(link)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	pageID, err := r.getPageID(ctx, link)
+	pageID, err := r.getPageID(ctx, shareURL(link, linkID))
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	baseURL, err := r.getBaseURL(ctx, pageID)
+	baseURLs, err := r.getBaseURLs(ctx, pageID)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	// Walkers build URLs on the first shard; the shard set spreads files over all of them.
+	baseURL := baseURLs[0]
+	shards := newShardSet(baseURLs)
+	emit = shards.emitter(emit)
+
+	if r.cache == nil {
+		return r.walk(ctx, linkID, folderQuery{pageID: pageID}, baseURL, emit, dir)
+	}
+
+	key := cacheKey(r.apiBase, linkID, r.filterKey)
+	// Records written before folders were cached cannot answer folder walks.
+	if record, ok := r.cache.load(key); ok && (dir == nil || record.Dirs != nil) {
+		notify(ctx, Event{
+			Kind:    "cache",
+			Message: fmt.Sprintf("using cached listing of %s from %s", linkID, record.Created.Local().Format(time.DateTime)),
+		})
+		for _, cached := range record.Dirs {
+			if dir != nil && !dir(Dir(cached)) {
+				return errStopWalk
+			}
+		}
+		for _, file := range record.Files {
+			if !emit(file.file()) {
+				return errStopWalk
+			}
+		}
+		return nil
 	}
 
-	return r.walkFolder(ctx, linkID, "", pageID, baseURL)
+	record := &cacheRecord{LinkID: linkID, API: r.apiBase, Filter: r.filterKey, Created: time.Now().UTC(), Dirs: []cachedDir{}}
+	err = r.walk(ctx, linkID, folderQuery{pageID: pageID}, baseURL, func(file File) bool {
+		record.Files = append(record.Files, toCachedFile(file))
+		return emit(file)
+	}, func(folder Dir) bool {
+		record.Dirs = append(record.Dirs, cachedDir(folder))
+		return dir == nil || dir(folder)
+	})
+	if err != nil {
+		return err
+	}
+	// Only complete walks are cached; a failed write just means a miss next time.
+	if err := r.cache.store(key, record); err != nil {
+		notify(ctx, Event{Kind: "cache", Message: fmt.Sprintf("cache write failed: %v", err), Err: err})
+	}
+	return nil
 }
 
+func (r *Resolver) walk(ctx context.Context, linkID string, query folderQuery, baseURL string, emit func(File) bool, dir func(Dir) bool) error {
+	return r.runWalk(ctx, &folderWalker{
+		resolver: r,
+		root:     linkID,
+		query:    query,
+		baseURL:  baseURL,
+		workers:  r.workers,
+		emit:     emit,
+		dir:      dir,
+	})
+}
+
+// RefreshURLs requests a fresh page ID and dispatcher shards for the shares of
+// files and returns copies with rebuilt URLs and mirrors, in the same order.
+// Share pages are requested from the host of the API endpoint. Files of
+// private links get fresh shards of the session.
+func (r *Resolver) RefreshURLs(ctx context.Context, files []File) ([]File, error) {
+	refreshed := make([]File, len(files))
+	shards := make(map[string]*shardSet)
+	for index, file := range files {
+		if strings.HasPrefix(file.RemotePath, "/") {
+			set, ok := shards["/"]
+			if !ok {
+				if r.session == nil {
+					return nil, fmt.Errorf("refresh %s: %w: private file without a session", file.Output, ErrAuthRequired)
+				}
+				_, baseURLs, err := r.privateBaseURLs(ctx)
+				if err != nil {
+					return nil, fmt.Errorf("refresh %s: %w", file.Output, err)
+				}
+				set = newShardSet(baseURLs)
+				shards["/"] = set
+			}
+			refreshed[index] = set.assign(file)
+			continue
+		}
+
+		segments := strings.SplitN(file.RemotePath, "/", 3)
+		if len(segments) < 2 {
+			return nil, fmt.Errorf("refresh %s: remote path has no share id", file.Output)
+		}
+		share := segments[0] + "/" + segments[1]
+
+		set, ok := shards[share]
+		if !ok {
+			pageID, err := r.getPageID(ctx, shareURL(r.apiBase, share))
+			if err != nil {
+				return nil, fmt.Errorf("refresh %s: %w", share, err)
+			}
+			baseURLs, err := r.getBaseURLs(ctx, pageID)
+			if err != nil {
+				return nil, fmt.Errorf("refresh %s: %w", share, err)
+			}
+			set = newShardSet(baseURLs)
+			shards[share] = set
+		}
+		refreshed[index] = set.assign(file)
+	}
+	return refreshed, nil
+}
+
+// LinkID returns the weblink of a public link: the URL-decoded path after /public/.
+// Links that point to the same share item have the same ID.
+func LinkID(link string) (string, error) {
+	return parsePublicLinkID(link)
+}
+
+// parsePublicLinkID returns the URL-decoded weblink path after /public/,
+// including subfolders and file names of deep links.
 func parsePublicLinkID(link string) (string, error) {
-	matches := publicLinkIDRE.FindStringSubmatch(link)
-	if len(matches) < 2 {
+	parsed, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
 		return "", fmt.Errorf("wrong public link: %s", link)
 	}
-	return matches[1], nil
+	escaped := parsed.EscapedPath()
+	index := strings.Index(escaped, "/public/")
+	if index < 0 {
+		return "", fmt.Errorf("wrong public link: %s", link)
+	}
+
+	var segments []string
+	for _, part := range strings.Split(escaped[index+len("/public/"):], "/") {
+		if part == "" {
+			continue
+		}
+		decoded, err := url.PathUnescape(part)
+		if err != nil {
+			decoded = part
+		}
+		segments = append(segments, decoded)
+	}
+	if len(segments) < 2 {
+		return "", fmt.Errorf("wrong public link: %s", link)
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+// shareURL returns the page of the public share that contains linkID.
+func shareURL(link string, linkID string) string {
+	parsed, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return link
+	}
+	segments := strings.SplitN(linkID, "/", 3)
+	share := &url.URL{Scheme: parsed.Scheme, Host: parsed.Host}
+	return share.JoinPath(append([]string{"public"}, segments[:2]...)...).String()
 }
 
 func (r *Resolver) getPageID(ctx context.Context, link string) (string, error) {
@@ -161,35 +470,123 @@ func (r *Resolver) getPageID(ctx context.Context, link string) (string, error) {
 	}
 	matches := pageIDRE.FindStringSubmatch(body)
 	if len(matches) < 2 {
+		if err := classifyPage(body); err != nil {
+			return "", fmt.Errorf("page id not found: %w", err)
+		}
 		return "", errors.New("page id not found")
 	}
 	return matches[1], nil
 }
 
-func (r *Resolver) getBaseURL(ctx context.Context, pageID string) (string, error) {
+// getBaseURLs returns the download hosts offered by the dispatcher, in its order.
+func (r *Resolver) getBaseURLs(ctx context.Context, pageID string) ([]string, error) {
 	values := url.Values{}
 	values.Set("x-page-id", pageID)
 	endpoint := fmt.Sprintf("%s/dispatcher?%s", r.apiBase, values.Encode())
 
 	body, err := r.doGet(ctx, endpoint)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	var response dispatcherAPIResponse
 	if err := json.Unmarshal([]byte(body), &response); err != nil {
-		return "", fmt.Errorf("decode dispatcher response: %w", err)
+		return nil, fmt.Errorf("decode dispatcher response: %w", err)
+	}
+	return shardURLs(response.Body.WeblinkGet)
+}
+
+// shardURLs returns the distinct host URLs of dispatcher shards, in their order.
+func shardURLs(shards []dispatcherShard) ([]string, error) {
+	var urls []string
+	for _, shard := range shards {
+		shardURL := strings.TrimSpace(shard.URL)
+		if shardURL != "" && !slices.Contains(urls, shardURL) {
+			urls = append(urls, shardURL)
+		}
 	}
-	if len(response.Body.WeblinkGet) == 0 || strings.TrimSpace(response.Body.WeblinkGet[0].URL) == "" {
-		return "", errors.New("base URL not found")
+	if len(urls) == 0 {
+		return nil, errors.New("base URL not found")
 	}
-	return response.Body.WeblinkGet[0].URL, nil
+	return urls, nil
+}
+
+// folderQuery addresses folders of a public share by weblink or, with home
+// set, folders of the logged-in account by path.
+type folderQuery struct {
+	home   bool
+	pageID string
+	token  string
 }
 
-func (r *Resolver) walkFolder(ctx context.Context, linkID string, parentFolder string, pageID string, baseURL string) ([]File, error) {
+func (q folderQuery) values(id string) url.Values {
 	values := url.Values{}
-	values.Set("weblink", linkID)
-	values.Set("x-page-id", pageID)
+	if q.home {
+		values.Set("home", "/"+id)
+		values.Set("token", q.token)
+	} else {
+		values.Set("weblink", id)
+		values.Set("x-page-id", q.pageID)
+	}
+	return values
+}
+
+// list pages through the folder API until the reported entry count is reached.
+// The returned header describes the weblink itself; for a single file it has type "file".
+func (r *Resolver) list(ctx context.Context, linkID string, query folderQuery) (folderItem, []folderItem, error) {
+	var (
+		header folderItem
+		items  []folderItem
+	)
+	seen := make(map[string]bool)
+	for offset, pages := 0, 0; ; pages++ {
+		if pages == maxFolderPages {
+			return folderItem{}, nil, fmt.Errorf("%w: %s: more than %d pages", ErrIncompleteListing, linkID, maxFolderPages)
+		}
+		response, err := r.folderPage(ctx, linkID, query, offset, r.pageSize)
+		if err != nil {
+			return folderItem{}, nil, err
+		}
+
+		header = response.header()
+		if header.Type == "file" {
+			return header, nil, nil
+		}
+		page := response.Body.List
+		added := 0
+		for _, item := range page {
+			// Names are unique within a folder, a repeated one means a repeated page.
+			if !seen[item.Name] {
+				seen[item.Name] = true
+				items = append(items, item)
+				added++
+			}
+		}
+		offset += len(page)
+
+		total := response.Body.Count.Folders + response.Body.Count.Files
+		if total == 0 {
+			// No count reported: a short page or a page without new entries
+			// (a server that ignores offset) marks the end of the listing.
+			if len(page) < r.pageSize || added == 0 {
+				return header, items, nil
+			}
+			continue
+		}
+		if len(items) >= total {
+			return header, items, nil
+		}
+		if added == 0 {
+			return folderItem{}, nil, fmt.Errorf("%w: %s: got %d of %d entries", ErrIncompleteListing, linkID, len(items), total)
+		}
+	}
+}
+
+// folderPage requests one page of the folder API.
+func (r *Resolver) folderPage(ctx context.Context, linkID string, query folderQuery, offset int, limit int) (*folderAPIResponse, error) {
+	values := query.values(linkID)
+	values.Set("offset", strconv.Itoa(offset))
+	values.Set("limit", strconv.Itoa(limit))
 	endpoint := fmt.Sprintf("%s/folder?%s", r.apiBase, values.Encode())
 
 	body, err := r.doGet(ctx, endpoint)
@@ -201,38 +598,91 @@ func (r *Resolver) walkFolder(ctx context.Context, linkID string, parentFolder s
 	if err := json.Unmarshal([]byte(body), &response); err != nil {
 		return nil, fmt.Errorf("decode folder response: %w", err)
 	}
+	return &response, nil
+}
 
-	currentFolder := joinPath(parentFolder, response.Body.Name)
-	var files []File
-
-	for _, item := range response.Body.List {
-		switch item.Type {
-		case "folder":
-			childLink := joinPath(linkID, item.Name)
-			childFiles, err := r.walkFolder(ctx, childLink, currentFolder, pageID, baseURL)
-			if err != nil {
-				return nil, err
-			}
-			files = append(files, childFiles...)
-		default:
-			outputPath := sanitizeWindowsPath(joinPath(currentFolder, item.Name))
-			directURL := strings.TrimRight(baseURL, "/") + "/" + encodeURLPath(joinPath(linkID, item.Name))
-			files = append(files, File{
-				URL:    directURL,
-				Output: outputPath,
-			})
-		}
+// header describes the weblink of a folder API response.
+func (response *folderAPIResponse) header() folderItem {
+	return folderItem{
+		Type:  response.Body.Type,
+		Name:  response.Body.Name,
+		Size:  response.Body.Size,
+		Hash:  response.Body.Hash,
+		MTime: response.Body.MTime,
 	}
+}
 
-	return files, nil
+func newFile(item folderItem, linkID string, currentFolder string, baseURL string) File {
+	remotePath := joinPath(linkID, item.Name)
+	file := File{
+		URL:        fileURL(baseURL, remotePath),
+		Output:     joinPath(currentFolder, item.Name),
+		RemotePath: remotePath,
+		Size:       item.Size,
+		Hash:       item.Hash,
+	}
+	if item.MTime > 0 {
+		file.ModTime = time.Unix(item.MTime, 0).UTC()
+	}
+	return file
 }
 
 func (r *Resolver) doGet(ctx context.Context, endpoint string) (string, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	return r.do(ctx, http.MethodGet, endpoint, nil)
+}
+
+// doPost sends form values; like doGet it waits for the limiter and retries transient failures.
+func (r *Resolver) doPost(ctx context.Context, endpoint string, form url.Values) (string, error) {
+	return r.do(ctx, http.MethodPost, endpoint, form)
+}
+
+func (r *Resolver) do(ctx context.Context, method string, endpoint string, form url.Values) (string, error) {
+	for attempt := 1; ; attempt++ {
+		body, err := r.doOnce(ctx, method, endpoint, form)
+		if err == nil {
+			return body, nil
+		}
+		if ctx.Err() != nil || attempt >= r.retry.MaxAttempts || !isRetryable(err) {
+			return "", err
+		}
+
+		var retryAfter time.Duration
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) {
+			retryAfter = httpErr.RetryAfter
+		}
+		delay := r.retry.delay(attempt, retryAfter)
+		notify(ctx, Event{
+			Kind:    "retry",
+			Message: fmt.Sprintf("request failed (%v), retry %d/%d in %s", err, attempt, r.retry.MaxAttempts-1, delay.Round(time.Millisecond)),
+			Attempt: attempt,
+			Delay:   delay,
+			Err:     err,
+		})
+		if err := sleepContext(ctx, delay); err != nil {
+			return "", err
+		}
+	}
+}
+
+func (r *Resolver) doOnce(ctx context.Context, method string, endpoint string, form url.Values) (string, error) {
+	if err := r.waitLimiter(ctx); err != nil {
+		return "", err
+	}
+
+	var payload io.Reader
+	if form != nil {
+		payload = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, payload)
 	if err != nil {
 		return "", err
 	}
 	req.Header.Set("User-Agent", r.userAgent)
+	r.session.Apply(req)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
 
 	resp, err := r.client.Do(req)
 	if err != nil {
@@ -241,7 +691,7 @@ func (r *Resolver) doGet(ctx context.Context, endpoint string) (string, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return "", fmt.Errorf("http status %d", resp.StatusCode)
+		return "", NewHTTPError(resp)
 	}
 
 	body, err := io.ReadAll(resp.Body)
@@ -251,6 +701,30 @@ func (r *Resolver) doGet(ctx context.Context, endpoint string) (string, error) {
 	return string(body), nil
 }
 
+// rateLimitReportInterval keeps rate limit events from flooding progress output.
+const rateLimitReportInterval = time.Second
+
+// waitLimiter waits for the limiter and reports the total wait at most once per interval.
+func (r *Resolver) waitLimiter(ctx context.Context) error {
+	delay, err := r.limiter.Wait(ctx)
+	if err != nil || delay <= 0 {
+		return err
+	}
+	total := time.Duration(r.waited.Add(int64(delay)))
+
+	now := time.Now().UnixNano()
+	last := r.reported.Load()
+	if now-last >= int64(rateLimitReportInterval) && r.reported.CompareAndSwap(last, now) {
+		notify(ctx, Event{
+			Kind:          "ratelimit",
+			Message:       fmt.Sprintf("rate limit: waited %s for API requests", total.Round(time.Millisecond)),
+			Delay:         delay,
+			RateLimitWait: total,
+		})
+	}
+	return nil
+}
+
 func joinPath(parts ...string) string {
 	normalized := make([]string, 0, len(parts))
 	for _, part := range parts {
@@ -262,6 +736,11 @@ func joinPath(parts ...string) string {
 	return strings.Join(normalized, "/")
 }
 
+// fileURL returns the download URL of a remote path on a dispatcher shard.
+func fileURL(baseURL string, remotePath string) string {
+	return strings.TrimRight(baseURL, "/") + "/" + encodeURLPath(remotePath)
+}
+
 func encodeURLPath(path string) string {
 	parts := strings.Split(path, "/")
 	encoded := make([]string, 0, len(parts))
@@ -274,23 +753,6 @@ func encodeURLPath(path string) string {
 	return strings.Join(encoded, "/")
 }
 
-func sanitizeWindowsPath(value string) string {
-	var builder strings.Builder
-	builder.Grow(len(value))
-	for _, r := range value {
-		if r >= 0 && r <= 31 {
-			continue
-		}
-		switch r {
-		case '<', '>', ':', '"', '|', '?', '*':
-			continue
-		default:
-			builder.WriteRune(r)
-		}
-	}
-	return builder.String()
-}
-
 // ParsePercent extracts percentage from aria2-like text output.
 func ParsePercent(line string) (float64, bool) {
 	for i := 0; i < len(line); i++ {
@@ -1,6 +1,17 @@
 package cloudmail
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
 
 func TestParsePublicLinkID(t *testing.T) {
 	tests := []struct {
@@ -14,11 +25,31 @@ func TestParsePublicLinkID(t *testing.T) {
 			link:   "https://cloud.mail.ru/public/9bFs/gVzxjU5uC",
 			wantID: "9bFs/gVzxjU5uC",
 		},
+		{
+			name:   "deep folder link",
+			link:   "https://cloud.mail.ru/public/AbCd/EfGh/Season%202/",
+			wantID: "AbCd/EfGh/Season 2",
+		},
+		{
+			name:   "deep file link with raw spaces",
+			link:   "https://cloud.mail.ru/public/AbCd/EfGh/Season 2/ep01.mkv",
+			wantID: "AbCd/EfGh/Season 2/ep01.mkv",
+		},
+		{
+			name:   "encoded cyrillic with query",
+			link:   "https://cloud.mail.ru/public/AbCd/EfGh/%D0%A4%D0%B8%D0%BB%D1%8C%D0%BC/a+b.txt?x=1#top",
+			wantID: "AbCd/EfGh/Фильм/a+b.txt",
+		},
 		{
 			name:    "invalid link",
 			link:    "https://example.com/file",
 			wantErr: true,
 		},
+		{
+			name:    "share id too short",
+			link:    "https://cloud.mail.ru/public/AbCd",
+			wantErr: true,
+		},
 	}
 
 	for _, tc := range tests {
@@ -56,10 +87,286 @@ func TestEncodeURLPath(t *testing.T) {
 	}
 }
 
-func TestSanitizeWindowsPath(t *testing.T) {
-	got := sanitizeWindowsPath(`folder<bad>|name:?.txt`)
-	want := "folderbadname.txt"
-	if got != want {
-		t.Fatalf("sanitizeWindowsPath mismatch: got=%q want=%q", got, want)
+func collectFiles(walk func(emit func(File) bool) error) ([]File, error) {
+	var files []File
+	err := walk(func(file File) bool {
+		files = append(files, file)
+		return true
+	})
+	return files, err
+}
+
+func TestWalkFolderKeepsMetadata(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("weblink") {
+		case "AbCd/EfGh":
+			fmt.Fprint(w, `{"body":{"name":"root","list":[
+				{"type":"folder","name":"sub"},
+				{"type":"file","name":"a.txt","size":12,"hash":"C172C6E2FF47284FF33F348FEA7EECE532F6C051","mtime":1700000000}
+			]}}`)
+		case "AbCd/EfGh/sub":
+			fmt.Fprint(w, `{"body":{"name":"sub","list":[{"type":"file","name":"b.bin","size":3}]}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	resolver, err := NewResolver(Config{})
+	if err != nil {
+		t.Fatalf("new resolver: %v", err)
+	}
+	resolver.apiBase = server.URL
+
+	files, err := collectFiles(func(emit func(File) bool) error {
+		return resolver.walk(context.Background(), "AbCd/EfGh", folderQuery{pageID: "page"}, "https://cdn.example/weblink/get", emit, nil)
+	})
+	if err != nil {
+		t.Fatalf("walk: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("unexpected files count: got=%d want=2", len(files))
+	}
+
+	sub := files[0]
+	if sub.Output != "root/sub/b.bin" || sub.RemotePath != "AbCd/EfGh/sub/b.bin" || sub.Size != 3 {
+		t.Fatalf("unexpected nested file: %+v", sub)
+	}
+	file := files[1]
+	if file.Size != 12 || file.Hash != "C172C6E2FF47284FF33F348FEA7EECE532F6C051" {
+		t.Fatalf("unexpected size/hash: %+v", file)
+	}
+	if !file.ModTime.Equal(time.Unix(1700000000, 0)) {
+		t.Fatalf("unexpected mtime: %v", file.ModTime)
+	}
+	if file.URL != "https://cdn.example/weblink/get/AbCd/EfGh/a.txt" {
+		t.Fatalf("unexpected url: %q", file.URL)
+	}
+}
+
+func newPagedFolderServer(t *testing.T, total int, served int) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		end := offset + limit
+		if end > served {
+			end = served
+		}
+
+		var list []string
+		for i := offset; i < end; i++ {
+			list = append(list, fmt.Sprintf(`{"type":"file","name":"f%05d.txt","size":1}`, i))
+		}
+		fmt.Fprintf(w, `{"body":{"name":"big","count":{"folders":0,"files":%d},"list":[%s]}}`, total, strings.Join(list, ","))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestListFolderPagination(t *testing.T) {
+	server := newPagedFolderServer(t, 1203, 1203)
+
+	resolver, err := NewResolver(Config{PageSize: 100})
+	if err != nil {
+		t.Fatalf("new resolver: %v", err)
+	}
+	resolver.apiBase = server.URL
+
+	header, items, err := resolver.list(context.Background(), "AbCd/EfGh", folderQuery{pageID: "page"})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if header.Name != "big" || len(items) != 1203 {
+		t.Fatalf("unexpected listing: name=%q count=%d", header.Name, len(items))
+	}
+	if items[1202].Name != "f01202.txt" {
+		t.Fatalf("unexpected last item: %q", items[1202].Name)
+	}
+}
+
+func TestListFolderIncomplete(t *testing.T) {
+	server := newPagedFolderServer(t, 1000, 250)
+
+	resolver, err := NewResolver(Config{PageSize: 100})
+	if err != nil {
+		t.Fatalf("new resolver: %v", err)
+	}
+	resolver.apiBase = server.URL
+
+	_, _, err = resolver.list(context.Background(), "AbCd/EfGh", folderQuery{pageID: "page"})
+	if !errors.Is(err, ErrIncompleteListing) {
+		t.Fatalf("expected ErrIncompleteListing, got %v", err)
+	}
+}
+
+func TestResolveAllKeepsGoingAfterDeadLink(t *testing.T) {
+	server := newShareServer(t)
+
+	resolver, err := NewResolver(Config{})
+	if err != nil {
+		t.Fatalf("new resolver: %v", err)
+	}
+	resolver.apiBase = server.URL
+
+	dead := server.URL + "/public/Dead/Link"
+	alive := server.URL + "/public/AbCd/EfGh"
+	results := resolver.ResolveAll(context.Background(), []string{dead, "  ", alive})
+	if len(results) != 2 {
+		t.Fatalf("unexpected results count: got=%d want=2", len(results))
+	}
+
+	var httpErr *HTTPError
+	if results[0].Link != dead || !errors.As(results[0].Err, &httpErr) || httpErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("unexpected dead link result: %+v", results[0])
+	}
+	if len(results[0].Files) != 0 {
+		t.Fatalf("dead link returned files: %+v", results[0].Files)
+	}
+	if results[1].Err != nil || len(results[1].Files) != 2 || results[1].Files[1].Output != "root/a.txt" {
+		t.Fatalf("unexpected alive link result: %+v", results[1])
+	}
+	if results[1].Duration <= 0 {
+		t.Fatalf("duration is not measured: %v", results[1].Duration)
+	}
+}
+
+func newShareServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/public/AbCd/EfGh":
+			fmt.Fprint(w, `<script>window.cloudSettings={"params":{"pageId":"page1"}}</script>`)
+		case "/dispatcher":
+			fmt.Fprintf(w, `{"body":{"weblink_get":[{"url":%q}]}}`, server.URL+"/get")
+		case "/folder":
+			switch r.URL.Query().Get("weblink") {
+			case "AbCd/EfGh":
+				fmt.Fprint(w, `{"body":{"type":"folder","name":"root","list":[{"type":"folder","name":"Season 2"},{"type":"file","name":"a.txt","size":1}]}}`)
+			case "AbCd/EfGh/Season 2":
+				fmt.Fprint(w, `{"body":{"type":"folder","name":"Season 2","list":[{"type":"file","name":"ep01.mkv","size":7}]}}`)
+			case "AbCd/EfGh/Season 2/ep01.mkv":
+				fmt.Fprint(w, `{"body":{"type":"file","name":"ep01.mkv","size":7,"hash":"ABC","mtime":1700000000}}`)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestResolveDeepLinks(t *testing.T) {
+	server := newShareServer(t)
+
+	resolver, err := NewResolver(Config{})
+	if err != nil {
+		t.Fatalf("new resolver: %v", err)
+	}
+	resolver.apiBase = server.URL
+
+	tests := []struct {
+		name       string
+		link       string
+		wantOutput string
+		wantRemote string
+	}{
+		{
+			name:       "subfolder",
+			link:       server.URL + "/public/AbCd/EfGh/Season%202",
+			wantOutput: "Season 2/ep01.mkv",
+			wantRemote: "AbCd/EfGh/Season 2/ep01.mkv",
+		},
+		{
+			name:       "single file",
+			link:       server.URL + "/public/AbCd/EfGh/Season%202/ep01.mkv",
+			wantOutput: "ep01.mkv",
+			wantRemote: "AbCd/EfGh/Season 2/ep01.mkv",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			files, err := resolver.Resolve(context.Background(), []string{tc.link})
+			if err != nil {
+				t.Fatalf("resolve: %v", err)
+			}
+			if len(files) != 1 {
+				t.Fatalf("unexpected files count: got=%d want=1", len(files))
+			}
+			file := files[0]
+			if file.Output != tc.wantOutput || file.RemotePath != tc.wantRemote || file.Size != 7 {
+				t.Fatalf("unexpected file: %+v", file)
+			}
+			if file.URL != server.URL+"/get/AbCd/EfGh/Season%202/ep01.mkv" {
+				t.Fatalf("unexpected url: %q", file.URL)
+			}
+		})
+	}
+}
+
+func TestPageIDRegexp(t *testing.T) {
+	body := `window.cloudSettings = {"params": {"pageId": "s3ssion-page", "x": 1}}`
+	matches := pageIDRE.FindStringSubmatch(body)
+	if len(matches) < 2 || matches[1] != "s3ssion-page" {
+		t.Fatalf("unexpected page id: %v", matches)
+	}
+}
+
+func TestListFolderIgnoredOffset(t *testing.T) {
+	var requests atomic.Int32
+	var withoutCount atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		count := ""
+		if !withoutCount.Load() {
+			count = `"count":{"folders":0,"files":10},`
+		}
+		// Every request returns the first page, whatever the offset.
+		fmt.Fprintf(w, `{"body":{"name":"big",%s"list":[{"type":"file","name":"a"},{"type":"file","name":"b"}]}}`, count)
+	}))
+	t.Cleanup(server.Close)
+
+	resolver, err := NewResolver(Config{PageSize: 2})
+	if err != nil {
+		t.Fatalf("new resolver: %v", err)
+	}
+	resolver.apiBase = server.URL
+
+	_, _, err = resolver.list(context.Background(), "AbCd/EfGh", folderQuery{pageID: "page"})
+	if !errors.Is(err, ErrIncompleteListing) || requests.Load() != 2 {
+		t.Fatalf("expected ErrIncompleteListing after 2 requests, got %v after %d", err, requests.Load())
+	}
+
+	withoutCount.Store(true)
+	requests.Store(0)
+	_, items, err := resolver.list(context.Background(), "AbCd/EfGh", folderQuery{pageID: "page"})
+	if err != nil || len(items) != 2 || requests.Load() != 2 {
+		t.Fatalf("expected 2 unique items after 2 requests, got %d, %v after %d", len(items), err, requests.Load())
+	}
+}
+
+func TestListFolderPageCap(t *testing.T) {
+	defer func(pages int) { maxFolderPages = pages }(maxFolderPages)
+	maxFolderPages = 5
+
+	// Full pages of new entries without a count never end on their own.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"body":{"name":"endless","list":[{"type":"file","name":"f%s"}]}}`, r.URL.Query().Get("offset"))
+	}))
+	t.Cleanup(server.Close)
+
+	resolver, err := NewResolver(Config{PageSize: 1})
+	if err != nil {
+		t.Fatalf("new resolver: %v", err)
+	}
+	resolver.apiBase = server.URL
+
+	_, _, err = resolver.list(context.Background(), "AbCd/EfGh", folderQuery{pageID: "page"})
+	if !errors.Is(err, ErrIncompleteListing) {
+		t.Fatalf("expected ErrIncompleteListing, got %v", err)
 	}
 }
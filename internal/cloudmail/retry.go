@@ -0,0 +1,174 @@
+package cloudmail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy configures retries of failed API requests.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts per request, including the first one.
+	MaxAttempts int
+	// BaseDelay is the backoff delay before the first retry; it doubles on every retry.
+	BaseDelay time.Duration
+	// MaxDelay caps both the backoff delay and the server Retry-After value.
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy returns the policy used when Config.Retry is empty.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 4,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    30 * time.Second,
+	}
+}
+
+func (p RetryPolicy) normalized() RetryPolicy {
+	defaults := DefaultRetryPolicy()
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = defaults.MaxAttempts
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = defaults.BaseDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = defaults.MaxDelay
+	}
+	if p.MaxDelay < p.BaseDelay {
+		p.MaxDelay = p.BaseDelay
+	}
+	return p
+}
+
+// delay returns exponential backoff with jitter, or the server hint when present.
+func (p RetryPolicy) delay(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		if retryAfter > p.MaxDelay {
+			return p.MaxDelay
+		}
+		return retryAfter
+	}
+
+	backoff := p.BaseDelay << (attempt - 1)
+	if backoff <= 0 || backoff > p.MaxDelay {
+		backoff = p.MaxDelay
+	}
+	half := backoff / 2
+	return half + rand.N(half+1)
+}
+
+// HTTPError reports an unexpected HTTP status from Cloud.Mail API or another link provider.
+type HTTPError struct {
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("http status %d", e.StatusCode)
+}
+
+// Unwrap returns the failure the status stands for, e.g. ErrNotFound for 404.
+func (e *HTTPError) Unwrap() error {
+	return ErrorForStatus(e.StatusCode)
+}
+
+// NewHTTPError returns the error for a response with an unexpected status.
+func NewHTTPError(resp *http.Response) *HTTPError {
+	return &HTTPError{
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if delay := at.Sub(now); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
+
+// isRetryable reports whether a request failure is likely transient.
+// Cancellation of the caller context must be checked separately.
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		// Per-request client timeout.
+		return true
+	}
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == http.StatusTooManyRequests || httpErr.StatusCode >= 500
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return false
+}
+
+// Event describes resolver activity such as request retries.
+type Event struct {
+	Kind    string
+	Message string
+	Attempt int
+	Delay   time.Duration
+	// RateLimitWait is the total time the resolver has waited on its Limiter.
+	RateLimitWait time.Duration
+	Err           error
+}
+
+type eventsKey struct{}
+
+// WithEvents returns a context that delivers resolver events to fn.
+// fn may be called from several goroutines.
+func WithEvents(ctx context.Context, fn func(Event)) context.Context {
+	return context.WithValue(ctx, eventsKey{}, fn)
+}
+
+func notify(ctx context.Context, event Event) {
+	if fn, ok := ctx.Value(eventsKey{}).(func(Event)); ok && fn != nil {
+		fn(event)
+	}
+}
+
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,130 @@
+package cloudmail
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDoGetRetriesTransientErrors(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch calls.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusBadGateway)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer server.Close()
+
+	resolver, err := NewResolver(Config{Retry: RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}})
+	if err != nil {
+		t.Fatalf("new resolver: %v", err)
+	}
+
+	var events []Event
+	ctx := WithEvents(context.Background(), func(event Event) {
+		events = append(events, event)
+	})
+
+	body, err := resolver.doGet(ctx, server.URL)
+	if err != nil {
+		t.Fatalf("doGet: %v", err)
+	}
+	if body != "ok" {
+		t.Fatalf("unexpected body: %q", body)
+	}
+	if len(events) != 2 || events[0].Kind != "retry" || events[1].Attempt != 2 {
+		t.Fatalf("unexpected retry events: %+v", events)
+	}
+}
+
+func TestDoGetStopsOnPermanentError(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	resolver, err := NewResolver(Config{Retry: RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond}})
+	if err != nil {
+		t.Fatalf("new resolver: %v", err)
+	}
+
+	_, err = resolver.doGet(context.Background(), server.URL)
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 HTTPError, got %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("unexpected attempts: %d", calls.Load())
+	}
+}
+
+func TestDoGetGivesUpAfterMaxAttempts(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	resolver, err := NewResolver(Config{Retry: RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}})
+	if err != nil {
+		t.Fatalf("new resolver: %v", err)
+	}
+
+	if _, err := resolver.doGet(context.Background(), server.URL); err == nil {
+		t.Fatalf("expected error")
+	}
+	if calls.Load() != 3 {
+		t.Fatalf("unexpected attempts: got=%d want=3", calls.Load())
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{value: "", want: 0},
+		{value: "7", want: 7 * time.Second},
+		{value: "-1", want: 0},
+		{value: now.Add(90 * time.Second).Format(http.TimeFormat), want: 90 * time.Second},
+		{value: "garbage", want: 0},
+	}
+
+	for _, tc := range tests {
+		if got := parseRetryAfter(tc.value, now); got != tc.want {
+			t.Fatalf("parseRetryAfter(%q) = %s, want %s", tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	for attempt := 1; attempt <= 6; attempt++ {
+		delay := policy.delay(attempt, 0)
+		backoff := policy.BaseDelay << (attempt - 1)
+		if backoff > policy.MaxDelay {
+			backoff = policy.MaxDelay
+		}
+		if delay < backoff/2 || delay > backoff {
+			t.Fatalf("attempt %d delay %s outside [%s, %s]", attempt, delay, backoff/2, backoff)
+		}
+	}
+	if got := policy.delay(1, 5*time.Second); got != time.Second {
+		t.Fatalf("Retry-After not capped: %s", got)
+	}
+}
@@ -0,0 +1,136 @@
+package cloudmail
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// defaultSessionDomain receives cookies given as a Cookie header line.
+const defaultSessionDomain = "mail.ru"
+
+// Session holds the cookies of a logged-in Cloud.Mail browser session.
+// Cookies are sent only to hosts of their domain, and the session never
+// prints them.
+type Session struct {
+	cookies []sessionCookie
+}
+
+type sessionCookie struct {
+	domain string
+	// subdomains sends the cookie to hosts below domain as well.
+	subdomains bool
+	name       string
+	value      string
+}
+
+// ParseSession reads cookies in the Netscape cookies.txt format exported by
+// browsers and curl, or one "name=value; name2=value2" Cookie header line,
+// which applies to mail.ru hosts.
+func ParseSession(text string) (*Session, error) {
+	session := &Session{}
+	var header []string
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		// curl marks HttpOnly cookies with a prefix that looks like a comment.
+		line = strings.TrimPrefix(line, "#HttpOnly_")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 7 {
+			header = append(header, line)
+			continue
+		}
+		domain := strings.ToLower(strings.TrimPrefix(fields[0], "."))
+		if domain == "" || fields[5] == "" {
+			return nil, fmt.Errorf("session line %d: missing domain or cookie name", number)
+		}
+		session.cookies = append(session.cookies, sessionCookie{
+			domain:     domain,
+			subdomains: strings.EqualFold(fields[1], "TRUE"),
+			name:       fields[5],
+			value:      fields[6],
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, line := range header {
+		line = strings.TrimSpace(strings.TrimPrefix(line, "Cookie:"))
+		for _, cookie := range strings.Split(line, ";") {
+			name, value, ok := strings.Cut(strings.TrimSpace(cookie), "=")
+			if !ok || strings.TrimSpace(name) == "" {
+				return nil, errors.New("session: expected name=value cookies or a cookies.txt file")
+			}
+			session.cookies = append(session.cookies, sessionCookie{
+				domain:     defaultSessionDomain,
+				subdomains: true,
+				name:       strings.TrimSpace(name),
+				value:      strings.TrimSpace(value),
+			})
+		}
+	}
+	if len(session.cookies) == 0 {
+		return nil, errors.New("session: no cookies found")
+	}
+	return session, nil
+}
+
+// Apply adds the cookies that belong to the request host; a nil session does nothing.
+func (s *Session) Apply(req *http.Request) {
+	if s == nil {
+		return
+	}
+	host := strings.ToLower(req.URL.Hostname())
+	for _, cookie := range s.cookies {
+		if cookie.matches(host) {
+			req.AddCookie(&http.Cookie{Name: cookie.name, Value: cookie.value})
+		}
+	}
+}
+
+func (c sessionCookie) matches(host string) bool {
+	if host == c.domain {
+		return true
+	}
+	// Cookies never spread from an IP address to other hosts.
+	return c.subdomains && net.ParseIP(c.domain) == nil && strings.HasSuffix(host, "."+c.domain)
+}
+
+// WriteCookies writes the cookies in the Netscape cookies.txt format, e.g. for aria2c --load-cookies.
+func (s *Session) WriteCookies(w io.Writer) error {
+	if s == nil {
+		return nil
+	}
+	for _, cookie := range s.cookies {
+		domain, subdomains := cookie.domain, "FALSE"
+		if cookie.subdomains {
+			domain, subdomains = "."+domain, "TRUE"
+		}
+		if _, err := fmt.Fprintf(w, "%s\t%s\t/\tFALSE\t0\t%s\t%s\n", domain, subdomains, cookie.name, cookie.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// String hides the cookie values.
+func (s *Session) String() string {
+	if s == nil {
+		return "session(none)"
+	}
+	return fmt.Sprintf("session(%d cookies)", len(s.cookies))
+}
+
+// GoString hides the cookie values from %#v.
+func (s *Session) GoString() string {
+	return s.String()
+}
@@ -0,0 +1,73 @@
+package cloudmail
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseSession(t *testing.T) {
+	cookiesTxt := "# Netscape HTTP Cookie File\n" +
+		".mail.ru\tTRUE\t/\tTRUE\t0\tsdcs\tsecret1\n" +
+		"#HttpOnly_cloud.mail.ru\tFALSE\t/\tTRUE\t0\tMpop\tsecret2\n"
+	tests := []struct {
+		name string
+		text string
+		url  string
+		want string
+	}{
+		{name: "cookies.txt subdomain", text: cookiesTxt, url: "https://cloclo1.datacloudmail.ru/x", want: ""},
+		{name: "cookies.txt api", text: cookiesTxt, url: "https://cloud.mail.ru/api/v2/folder", want: "sdcs=secret1; Mpop=secret2"},
+		{name: "cookies.txt other host", text: cookiesTxt, url: "https://mail.ru.evil.example/", want: ""},
+		{name: "cookies.txt exact host", text: cookiesTxt, url: "https://e.mail.ru/", want: "sdcs=secret1"},
+		{name: "header line", text: "Cookie: sdcs=secret1; Mpop=secret2\n", url: "https://cloud.mail.ru/", want: "sdcs=secret1; Mpop=secret2"},
+		{name: "ip domain", text: "127.0.0.1\tTRUE\t/\tFALSE\t0\tsdcs\tsecret1", url: "http://127.0.0.1:8080/", want: "sdcs=secret1"},
+	}
+	for _, test := range tests {
+		session, err := ParseSession(test.text)
+		if err != nil {
+			t.Fatalf("%s: parse: %v", test.name, err)
+		}
+		req, err := http.NewRequest(http.MethodGet, test.url, nil)
+		if err != nil {
+			t.Fatalf("%s: new request: %v", test.name, err)
+		}
+		session.Apply(req)
+		if got := req.Header.Get("Cookie"); got != test.want {
+			t.Fatalf("%s: cookie mismatch: got=%q want=%q", test.name, got, test.want)
+		}
+	}
+
+	for _, text := range []string{"", "# only comments\n", "not a cookie"} {
+		if _, err := ParseSession(text); err == nil {
+			t.Fatalf("expected error for %q", text)
+		}
+	}
+}
+
+func TestSessionHidesCookies(t *testing.T) {
+	session, err := ParseSession("sdcs=secret1")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+		if got := fmt.Sprintf(format, session); strings.Contains(got, "secret1") {
+			t.Fatalf("%s printed the cookie: %q", format, got)
+		}
+	}
+
+	var out strings.Builder
+	if err := session.WriteCookies(&out); err != nil {
+		t.Fatalf("write cookies: %v", err)
+	}
+	written, err := ParseSession(out.String())
+	if err != nil {
+		t.Fatalf("parse written cookies: %v", err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, "https://cloud.mail.ru/", nil)
+	written.Apply(req)
+	if got := req.Header.Get("Cookie"); got != "sdcs=secret1" {
+		t.Fatalf("written cookies mismatch: got=%q", got)
+	}
+}
@@ -0,0 +1,32 @@
+package cloudmail
+
+// shardSet spreads files of one link across the dispatcher download hosts.
+type shardSet struct {
+	urls []string
+	next int
+}
+
+func newShardSet(urls []string) *shardSet {
+	return &shardSet{urls: urls}
+}
+
+// assign picks the primary host round-robin in emit order and lists the
+// remaining hosts as mirrors, so the download URLs of a file are deterministic.
+func (s *shardSet) assign(file File) File {
+	start := s.next % len(s.urls)
+	s.next++
+
+	file.URL = fileURL(s.urls[start], file.RemotePath)
+	file.Mirrors = nil
+	for offset := 1; offset < len(s.urls); offset++ {
+		file.Mirrors = append(file.Mirrors, fileURL(s.urls[(start+offset)%len(s.urls)], file.RemotePath))
+	}
+	return file
+}
+
+// emitter wraps emit so every file gets its shard URLs first.
+func (s *shardSet) emitter(emit func(File) bool) func(File) bool {
+	return func(file File) bool {
+		return emit(s.assign(file))
+	}
+}
@@ -0,0 +1,52 @@
+package cloudmail
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestResolveSpreadsFilesAcrossShards(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/public/AbCd/EfGh":
+			fmt.Fprint(w, `<script>window.cloudSettings={"params":{"pageId":"page1"}}</script>`)
+		case "/dispatcher":
+			fmt.Fprint(w, `{"body":{"weblink_get":[{"url":"https://s1.example/get"},{"url":" "},{"url":"https://s2.example/get"},{"url":"https://s1.example/get"}]}}`)
+		case "/folder":
+			fmt.Fprint(w, `{"body":{"type":"folder","name":"root","list":[{"type":"file","name":"a.txt"},{"type":"file","name":"b.txt"},{"type":"file","name":"c.txt"}]}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	resolver, err := NewResolver(Config{APIBaseURL: server.URL})
+	if err != nil {
+		t.Fatalf("new resolver: %v", err)
+	}
+	files, err := resolver.Resolve(context.Background(), []string{server.URL + "/public/AbCd/EfGh"})
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+
+	want := []struct {
+		url    string
+		mirror string
+	}{
+		{url: "https://s1.example/get/AbCd/EfGh/a.txt", mirror: "https://s2.example/get/AbCd/EfGh/a.txt"},
+		{url: "https://s2.example/get/AbCd/EfGh/b.txt", mirror: "https://s1.example/get/AbCd/EfGh/b.txt"},
+		{url: "https://s1.example/get/AbCd/EfGh/c.txt", mirror: "https://s2.example/get/AbCd/EfGh/c.txt"},
+	}
+	if len(files) != len(want) {
+		t.Fatalf("unexpected files count: got=%d want=%d", len(files), len(want))
+	}
+	for index, file := range files {
+		if file.URL != want[index].url || !slices.Equal(file.Mirrors, []string{want[index].mirror}) {
+			t.Fatalf("shard mismatch for %s: url=%q mirrors=%q", file.Output, file.URL, file.Mirrors)
+		}
+	}
+}
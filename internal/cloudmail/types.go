@@ -1,7 +1,31 @@
 package cloudmail
 
+import "time"
+
 // File describes one file that can be downloaded via aria2c.
 type File struct {
-	URL    string
-	Output string
+	URL        string
+	Output     string
+	RemotePath string
+	Size       int64
+	Hash       string
+	ModTime    time.Time
+	// Mirrors are URLs of the same file on other dispatcher shards, tried when URL fails.
+	Mirrors []string
+}
+
+// Dir describes one folder of a public link.
+type Dir struct {
+	Output     string
+	RemotePath string
+	// Empty reports that the folder has no entries on the remote side.
+	Empty bool
+}
+
+// LinkResult is the outcome of resolving one public link.
+type LinkResult struct {
+	Link     string
+	Files    []File
+	Err      error
+	Duration time.Duration
 }
@@ -0,0 +1,208 @@
+package cloudmail
+
+import (
+	"context"
+	"path"
+	"strings"
+	"sync"
+)
+
+// folderListing is a folder page set, listed ahead of the ordered walk by the
+// worker pool or on demand.
+type folderListing struct {
+	linkID string
+	done   chan struct{}
+	header folderItem
+	items  []folderItem
+	// children maps item indexes to the listings of subfolders kept by the filter.
+	children map[int]*folderListing
+	err      error
+}
+
+// folderWalker walks a folder tree and emits files in sequential walk order.
+// With more than one worker a pool lists every discovered folder ahead of the
+// walk with at most workers requests in flight; otherwise folders are listed
+// on demand.
+type folderWalker struct {
+	resolver *Resolver
+	root     string
+	query    folderQuery
+	baseURL  string
+	workers  int
+	pool     *folderPool
+	emit     func(File) bool
+	// dir, when set, receives every folder before its contents.
+	dir func(Dir) bool
+}
+
+// folderPool is a stack of folders waiting to be listed. Subfolders are
+// pushed in reverse order, so listings follow the walk order depth first.
+type folderPool struct {
+	mu     sync.Mutex
+	wake   *sync.Cond
+	stack  []*folderListing
+	closed bool
+	wg     sync.WaitGroup
+}
+
+func (p *folderPool) push(listing *folderListing) {
+	p.mu.Lock()
+	if !p.closed {
+		p.stack = append(p.stack, listing)
+	}
+	p.mu.Unlock()
+	p.wake.Signal()
+}
+
+func (p *folderPool) pop() (*folderListing, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.stack) == 0 && !p.closed {
+		p.wake.Wait()
+	}
+	if p.closed {
+		return nil, false
+	}
+	listing := p.stack[len(p.stack)-1]
+	p.stack = p.stack[:len(p.stack)-1]
+	return listing, true
+}
+
+// close stops the workers and waits until they return.
+func (p *folderPool) close() {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+	p.wake.Broadcast()
+	p.wg.Wait()
+}
+
+func (r *Resolver) runWalk(ctx context.Context, walker *folderWalker) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	root := &folderListing{linkID: walker.root, done: make(chan struct{})}
+	if walker.workers > 1 {
+		walker.pool = &folderPool{}
+		walker.pool.wake = sync.NewCond(&walker.pool.mu)
+		for range walker.workers {
+			walker.pool.wg.Add(1)
+			go walker.work(ctx)
+		}
+		walker.pool.push(root)
+	}
+	err := walker.walk(ctx, "", root)
+	if walker.pool != nil {
+		// Stop outstanding listings before returning, so no request outlives the walk.
+		cancel()
+		walker.pool.close()
+	}
+	return err
+}
+
+// work lists folders from the pool until it is closed.
+func (w *folderWalker) work(ctx context.Context) {
+	defer w.pool.wg.Done()
+	for {
+		listing, ok := w.pool.pop()
+		if !ok {
+			return
+		}
+		w.fetch(ctx, listing)
+		close(listing.done)
+		for index := len(listing.items) - 1; index >= 0; index-- {
+			if child, ok := listing.children[index]; ok {
+				w.pool.push(child)
+			}
+		}
+	}
+}
+
+// fetch lists a folder and prepares the listings of its subfolders.
+func (w *folderWalker) fetch(ctx context.Context, listing *folderListing) {
+	listing.header, listing.items, listing.err = w.resolver.list(ctx, listing.linkID, w.query)
+	if listing.err != nil || listing.header.Type == "file" {
+		return
+	}
+	listing.children = make(map[int]*folderListing)
+	for index, item := range listing.items {
+		if item.Type != "folder" {
+			continue
+		}
+		childID := joinPath(listing.linkID, item.Name)
+		if w.resolver.filter.skipDir(w.relative(childID)) {
+			continue
+		}
+		listing.children[index] = &folderListing{linkID: childID, done: make(chan struct{})}
+	}
+}
+
+func (w *folderWalker) wait(ctx context.Context, listing *folderListing) error {
+	if w.pool == nil {
+		w.fetch(ctx, listing)
+		return listing.err
+	}
+	select {
+	case <-listing.done:
+		return listing.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// relative returns the path of a remote entry relative to the walk root.
+func (w *folderWalker) relative(linkID string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(linkID, w.root), "/")
+}
+
+func (w *folderWalker) walk(ctx context.Context, parentFolder string, listing *folderListing) error {
+	if err := w.wait(ctx, listing); err != nil {
+		return err
+	}
+
+	linkID := listing.linkID
+	filter := w.resolver.filter
+	if listing.header.Type == "file" {
+		// The weblink points at a single file rather than a folder.
+		return w.emitSingleFile(linkID, listing.header)
+	}
+
+	currentFolder := joinPath(parentFolder, listing.header.Name)
+	if w.dir != nil && !w.dir(Dir{Output: currentFolder, RemotePath: linkID, Empty: len(listing.items) == 0}) {
+		return errStopWalk
+	}
+	for index, item := range listing.items {
+		switch item.Type {
+		case "folder":
+			child, ok := listing.children[index]
+			if !ok {
+				continue
+			}
+			if err := w.walk(ctx, currentFolder, child); err != nil {
+				return err
+			}
+		default:
+			if !filter.keepFile(w.relative(joinPath(linkID, item.Name)), item.Size) {
+				continue
+			}
+			if !w.emit(newFile(item, linkID, currentFolder, w.baseURL)) {
+				return errStopWalk
+			}
+		}
+	}
+	return nil
+}
+
+// emitSingleFile emits a file weblink under its own name.
+func (w *folderWalker) emitSingleFile(linkID string, item folderItem) error {
+	parent, name := path.Split(linkID)
+	if item.Name == "" {
+		item.Name = name
+	}
+	if !w.resolver.filter.keepFile(item.Name, item.Size) {
+		return nil
+	}
+	if !w.emit(newFile(item, parent, "", w.baseURL)) {
+		return errStopWalk
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package cloudmail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTreeServer serves a folder tree where every folder has two subfolders
+// down to the given depth and three files per folder.
+func newTreeServer(t *testing.T, depth int, delay time.Duration) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if delay > 0 {
+			time.Sleep(delay)
+		}
+		weblink := r.URL.Query().Get("weblink")
+		level := strings.Count(weblink, "/") - 1
+		name := weblink[strings.LastIndex(weblink, "/")+1:]
+
+		var list []string
+		if level < depth {
+			list = append(list, `{"type":"folder","name":"d0"}`, `{"type":"folder","name":"d1"}`)
+		}
+		for i := 0; i < 3; i++ {
+			list = append(list, fmt.Sprintf(`{"type":"file","name":"f%d.txt","size":%d}`, i, i))
+		}
+		fmt.Fprintf(w, `{"body":{"name":%q,"list":[%s]}}`, name, strings.Join(list, ","))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestWalkFolderConcurrentMatchesSequential(t *testing.T) {
+	server := newTreeServer(t, 4, 0)
+
+	sequential, err := NewResolver(Config{})
+	if err != nil {
+		t.Fatalf("new resolver: %v", err)
+	}
+	sequential.apiBase = server.URL
+
+	concurrent, err := NewResolver(Config{Workers: 8})
+	if err != nil {
+		t.Fatalf("new resolver: %v", err)
+	}
+	concurrent.apiBase = server.URL
+
+	want, err := collectFiles(func(emit func(File) bool) error {
+		return sequential.walk(context.Background(), "AbCd/EfGh", folderQuery{pageID: "page"}, "https://cdn.example", emit, nil)
+	})
+	if err != nil {
+		t.Fatalf("sequential walk: %v", err)
+	}
+	got, err := collectFiles(func(emit func(File) bool) error {
+		return concurrent.walk(context.Background(), "AbCd/EfGh", folderQuery{pageID: "page"}, "https://cdn.example", emit, nil)
+	})
+	if err != nil {
+		t.Fatalf("concurrent walk: %v", err)
+	}
+
+	if len(want) != 93 {
+		t.Fatalf("unexpected sequential count: %d", len(want))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("concurrent walk differs from sequential walk")
+	}
+}
+
+func TestWalkFolderConcurrentCancel(t *testing.T) {
+	server := newTreeServer(t, 6, 20*time.Millisecond)
+
+	resolver, err := NewResolver(Config{Workers: 2})
+	if err != nil {
+		t.Fatalf("new resolver: %v", err)
+	}
+	resolver.apiBase = server.URL
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = collectFiles(func(emit func(File) bool) error {
+		return resolver.walk(ctx, "AbCd/EfGh", folderQuery{pageID: "page"}, "https://cdn.example", emit, nil)
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline error, got %v", err)
+	}
+}
+
+func TestWalkFolderConcurrentStopsEarly(t *testing.T) {
+	server := newTreeServer(t, 5, 0)
+
+	resolver, err := NewResolver(Config{Workers: 4})
+	if err != nil {
+		t.Fatalf("new resolver: %v", err)
+	}
+	resolver.apiBase = server.URL
+
+	var got []File
+	err = resolver.walk(context.Background(), "AbCd/EfGh", folderQuery{pageID: "page"}, "https://cdn.example", func(file File) bool {
+		got = append(got, file)
+		return len(got) < 5
+	}, nil)
+	if !errors.Is(err, errStopWalk) {
+		t.Fatalf("expected errStopWalk, got %v", err)
+	}
+	if len(got) != 5 || got[0].Output != "EfGh/d0/d0/d0/d0/d0/f0.txt" {
+		t.Fatalf("unexpected streamed files: %d first=%q", len(got), got[0].Output)
+	}
+}
+
+func TestWalkFolderPoolListsAhead(t *testing.T) {
+	tree := newTreeServer(t, 4, 20*time.Millisecond)
+	var inFlight, peak atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			old := peak.Load()
+			if current <= old || peak.CompareAndSwap(old, current) {
+				break
+			}
+		}
+		tree.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	resolver, err := NewResolver(Config{Workers: 4})
+	if err != nil {
+		t.Fatalf("new resolver: %v", err)
+	}
+	resolver.apiBase = server.URL
+
+	files, err := collectFiles(func(emit func(File) bool) error {
+		return resolver.walk(context.Background(), "AbCd/EfGh", folderQuery{pageID: "page"}, "https://cdn.example", emit, nil)
+	})
+	if err != nil || len(files) != 93 {
+		t.Fatalf("walk: %d files, %v", len(files), err)
+	}
+	// Grandchildren are listed before the walk reaches their parents.
+	if got := peak.Load(); got != 4 {
+		t.Fatalf("unexpected peak of parallel listings: got=%d want=4", got)
+	}
+}
+
+// countingTransport counts requests started through it.
+type countingTransport struct {
+	started atomic.Int32
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.started.Add(1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestWalkFolderPoolStopsWithWalk(t *testing.T) {
+	server := newTreeServer(t, 6, 5*time.Millisecond)
+	transport := &countingTransport{}
+	resolver, err := NewResolver(Config{Workers: 4, HTTPClient: &http.Client{Transport: transport}})
+	if err != nil {
+		t.Fatalf("new resolver: %v", err)
+	}
+	resolver.apiBase = server.URL
+
+	err = resolver.walk(context.Background(), "AbCd/EfGh", folderQuery{pageID: "page"}, "https://cdn.example", func(File) bool {
+		return false
+	}, nil)
+	if !errors.Is(err, errStopWalk) {
+		t.Fatalf("expected errStopWalk, got %v", err)
+	}
+	started := transport.started.Load()
+	time.Sleep(50 * time.Millisecond)
+	if got := transport.started.Load(); got != started {
+		t.Fatalf("listings continued after the walk returned: %d requests, then %d", started, got)
+	}
+}
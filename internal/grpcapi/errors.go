@@ -0,0 +1,66 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/jhonroun/cmrd/pkg/cmrd"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// errorDomain is the ErrorInfo domain of cmrd errors.
+const errorDomain = "cmrd"
+
+// grpcCodes maps cmrd error codes to gRPC status codes; other errors are Internal.
+var grpcCodes = map[string]codes.Code{
+	cmrd.CodeLinkNotFound:  codes.NotFound,
+	cmrd.CodeLinkBlocked:   codes.PermissionDenied,
+	cmrd.CodeRateLimited:   codes.ResourceExhausted,
+	cmrd.CodeQuotaExceeded: codes.ResourceExhausted,
+	cmrd.CodeAntiBot:       codes.Unavailable,
+	cmrd.CodeAuthRequired:  codes.Unauthenticated,
+	cmrd.CodeDiskFull:      codes.ResourceExhausted,
+	cmrd.CodeAria2Missing:  codes.FailedPrecondition,
+	cmrd.CodeAria2Failed:   codes.Aborted,
+	cmrd.CodeVerifyFailed:  codes.DataLoss,
+	cmrd.CodeUnsafePath:    codes.InvalidArgument,
+	cmrd.CodeNetwork:       codes.Unavailable,
+	cmrd.CodeCanceled:      codes.Canceled,
+}
+
+// statusError converts err to a gRPC status with an ErrorInfo detail carrying
+// the cmrd error code, and a RetryInfo detail when Cloud.Mail asked to wait.
+func statusError(prefix string, err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+	reason := cmrd.Code(err)
+	code, ok := grpcCodes[reason]
+	if !ok {
+		code = codes.Internal
+	}
+
+	st := status.New(code, prefix+": "+err.Error())
+	info := &errdetails.ErrorInfo{
+		Reason: reason,
+		Domain: errorDomain,
+		Metadata: map[string]string{
+			"exit_code": strconv.Itoa(cmrd.ExitCode(err)),
+			"retryable": strconv.FormatBool(cmrd.Retryable(err)),
+		},
+	}
+	detailed, detailErr := st.WithDetails(info)
+	if detailErr != nil {
+		return st.Err()
+	}
+	if delay := cmrd.RetryAfter(err); delay > 0 {
+		if withRetry, err := detailed.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(delay)}); err == nil {
+			detailed = withRetry
+		}
+	}
+	return detailed.Err()
+}
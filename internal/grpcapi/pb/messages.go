@@ -2,8 +2,25 @@ package pb
 
 import "github.com/golang/protobuf/proto"
 
+type FileFilter struct {
+	Include      []string `protobuf:"bytes,1,rep,name=include,proto3" json:"include,omitempty"`
+	Exclude      []string `protobuf:"bytes,2,rep,name=exclude,proto3" json:"exclude,omitempty"`
+	IncludeRegex []string `protobuf:"bytes,3,rep,name=include_regex,json=includeRegex,proto3" json:"include_regex,omitempty"`
+	ExcludeRegex []string `protobuf:"bytes,4,rep,name=exclude_regex,json=excludeRegex,proto3" json:"exclude_regex,omitempty"`
+	Extensions   []string `protobuf:"bytes,5,rep,name=extensions,proto3" json:"extensions,omitempty"`
+	MinSize      int64    `protobuf:"varint,6,opt,name=min_size,json=minSize,proto3" json:"min_size,omitempty"`
+	MaxSize      int64    `protobuf:"varint,7,opt,name=max_size,json=maxSize,proto3" json:"max_size,omitempty"`
+	MaxDepth     int32    `protobuf:"varint,8,opt,name=max_depth,json=maxDepth,proto3" json:"max_depth,omitempty"`
+}
+
+func (m *FileFilter) Reset()         { *m = FileFilter{} }
+func (m *FileFilter) String() string { return proto.CompactTextString(m) }
+func (*FileFilter) ProtoMessage()    {}
+
 type ResolveLinksRequest struct {
-	Links []string `protobuf:"bytes,1,rep,name=links,proto3" json:"links,omitempty"`
+	Links   []string    `protobuf:"bytes,1,rep,name=links,proto3" json:"links,omitempty"`
+	Filter  *FileFilter `protobuf:"bytes,2,opt,name=filter,proto3" json:"filter,omitempty"`
+	NoCache bool        `protobuf:"varint,3,opt,name=no_cache,json=noCache,proto3" json:"no_cache,omitempty"`
 }
 
 func (m *ResolveLinksRequest) Reset()         { *m = ResolveLinksRequest{} }
@@ -11,25 +28,71 @@ func (m *ResolveLinksRequest) String() string { return proto.CompactTextString(m
 func (*ResolveLinksRequest) ProtoMessage()    {}
 
 type ResolvedFile struct {
-	URL    string `protobuf:"bytes,1,opt,name=url,proto3" json:"url,omitempty"`
-	Output string `protobuf:"bytes,2,opt,name=output,proto3" json:"output,omitempty"`
+	URL            string   `protobuf:"bytes,1,opt,name=url,proto3" json:"url,omitempty"`
+	Output         string   `protobuf:"bytes,2,opt,name=output,proto3" json:"output,omitempty"`
+	Size           int64    `protobuf:"varint,3,opt,name=size,proto3" json:"size,omitempty"`
+	Hash           string   `protobuf:"bytes,4,opt,name=hash,proto3" json:"hash,omitempty"`
+	Mtime          int64    `protobuf:"varint,5,opt,name=mtime,proto3" json:"mtime,omitempty"`
+	RemotePath     string   `protobuf:"bytes,6,opt,name=remote_path,json=remotePath,proto3" json:"remote_path,omitempty"`
+	OriginalOutput string   `protobuf:"bytes,7,opt,name=original_output,json=originalOutput,proto3" json:"original_output,omitempty"`
+	Mirrors        []string `protobuf:"bytes,8,rep,name=mirrors,proto3" json:"mirrors,omitempty"`
+	Provider       string   `protobuf:"bytes,9,opt,name=provider,proto3" json:"provider,omitempty"`
 }
 
 func (m *ResolvedFile) Reset()         { *m = ResolvedFile{} }
 func (m *ResolvedFile) String() string { return proto.CompactTextString(m) }
 func (*ResolvedFile) ProtoMessage()    {}
 
+type LinkResult struct {
+	Link       string `protobuf:"bytes,1,opt,name=link,proto3" json:"link,omitempty"`
+	Error      string `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+	FileCount  int32  `protobuf:"varint,3,opt,name=file_count,json=fileCount,proto3" json:"file_count,omitempty"`
+	DurationMs int64  `protobuf:"varint,4,opt,name=duration_ms,json=durationMs,proto3" json:"duration_ms,omitempty"`
+	ErrorCode  string `protobuf:"bytes,5,opt,name=error_code,json=errorCode,proto3" json:"error_code,omitempty"`
+}
+
+func (m *LinkResult) Reset()         { *m = LinkResult{} }
+func (m *LinkResult) String() string { return proto.CompactTextString(m) }
+func (*LinkResult) ProtoMessage()    {}
+
 type ResolveLinksResponse struct {
 	Files []*ResolvedFile `protobuf:"bytes,1,rep,name=files,proto3" json:"files,omitempty"`
+	Links []*LinkResult   `protobuf:"bytes,2,rep,name=links,proto3" json:"links,omitempty"`
 }
 
 func (m *ResolveLinksResponse) Reset()         { *m = ResolveLinksResponse{} }
 func (m *ResolveLinksResponse) String() string { return proto.CompactTextString(m) }
 func (*ResolveLinksResponse) ProtoMessage()    {}
 
+type TreeNode struct {
+	Name       string        `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Path       string        `protobuf:"bytes,2,opt,name=path,proto3" json:"path,omitempty"`
+	RemotePath string        `protobuf:"bytes,3,opt,name=remote_path,json=remotePath,proto3" json:"remote_path,omitempty"`
+	Dir        bool          `protobuf:"varint,4,opt,name=dir,proto3" json:"dir,omitempty"`
+	Size       int64         `protobuf:"varint,5,opt,name=size,proto3" json:"size,omitempty"`
+	Files      int32         `protobuf:"varint,6,opt,name=files,proto3" json:"files,omitempty"`
+	Folders    int32         `protobuf:"varint,7,opt,name=folders,proto3" json:"folders,omitempty"`
+	File       *ResolvedFile `protobuf:"bytes,8,opt,name=file,proto3" json:"file,omitempty"`
+	Children   []*TreeNode   `protobuf:"bytes,9,rep,name=children,proto3" json:"children,omitempty"`
+}
+
+func (m *TreeNode) Reset()         { *m = TreeNode{} }
+func (m *TreeNode) String() string { return proto.CompactTextString(m) }
+func (*TreeNode) ProtoMessage()    {}
+
+type ResolveTreeResponse struct {
+	Root *TreeNode `protobuf:"bytes,1,opt,name=root,proto3" json:"root,omitempty"`
+}
+
+func (m *ResolveTreeResponse) Reset()         { *m = ResolveTreeResponse{} }
+func (m *ResolveTreeResponse) String() string { return proto.CompactTextString(m) }
+func (*ResolveTreeResponse) ProtoMessage()    {}
+
 type StartDownloadRequest struct {
-	Links       []string `protobuf:"bytes,1,rep,name=links,proto3" json:"links,omitempty"`
-	DownloadDir string   `protobuf:"bytes,2,opt,name=download_dir,json=downloadDir,proto3" json:"download_dir,omitempty"`
+	Links           []string    `protobuf:"bytes,1,rep,name=links,proto3" json:"links,omitempty"`
+	DownloadDir     string      `protobuf:"bytes,2,opt,name=download_dir,json=downloadDir,proto3" json:"download_dir,omitempty"`
+	ContinueOnError bool        `protobuf:"varint,3,opt,name=continue_on_error,json=continueOnError,proto3" json:"continue_on_error,omitempty"`
+	Filter          *FileFilter `protobuf:"bytes,4,opt,name=filter,proto3" json:"filter,omitempty"`
 }
 
 func (m *StartDownloadRequest) Reset()         { *m = StartDownloadRequest{} }
@@ -53,12 +116,14 @@ func (m *GetProgressRequest) String() string { return proto.CompactTextString(m)
 func (*GetProgressRequest) ProtoMessage()    {}
 
 type GetProgressResponse struct {
-	JobID   string  `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
-	Phase   string  `protobuf:"bytes,2,opt,name=phase,proto3" json:"phase,omitempty"`
-	Percent float32 `protobuf:"fixed32,3,opt,name=percent,proto3" json:"percent,omitempty"`
-	Message string  `protobuf:"bytes,4,opt,name=message,proto3" json:"message,omitempty"`
-	Done    bool    `protobuf:"varint,5,opt,name=done,proto3" json:"done,omitempty"`
-	Error   string  `protobuf:"bytes,6,opt,name=error,proto3" json:"error,omitempty"`
+	JobID           string  `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	Phase           string  `protobuf:"bytes,2,opt,name=phase,proto3" json:"phase,omitempty"`
+	Percent         float32 `protobuf:"fixed32,3,opt,name=percent,proto3" json:"percent,omitempty"`
+	Message         string  `protobuf:"bytes,4,opt,name=message,proto3" json:"message,omitempty"`
+	Done            bool    `protobuf:"varint,5,opt,name=done,proto3" json:"done,omitempty"`
+	Error           string  `protobuf:"bytes,6,opt,name=error,proto3" json:"error,omitempty"`
+	RateLimitWaitMs int64   `protobuf:"varint,7,opt,name=rate_limit_wait_ms,json=rateLimitWaitMs,proto3" json:"rate_limit_wait_ms,omitempty"`
+	ErrorCode       string  `protobuf:"bytes,8,opt,name=error_code,json=errorCode,proto3" json:"error_code,omitempty"`
 }
 
 func (m *GetProgressResponse) Reset()         { *m = GetProgressResponse{} }
@@ -88,12 +153,14 @@ func (m *ListJobsRequest) String() string { return proto.CompactTextString(m) }
 func (*ListJobsRequest) ProtoMessage()    {}
 
 type JobInfo struct {
-	JobID   string  `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
-	Phase   string  `protobuf:"bytes,2,opt,name=phase,proto3" json:"phase,omitempty"`
-	Percent float32 `protobuf:"fixed32,3,opt,name=percent,proto3" json:"percent,omitempty"`
-	Message string  `protobuf:"bytes,4,opt,name=message,proto3" json:"message,omitempty"`
-	Done    bool    `protobuf:"varint,5,opt,name=done,proto3" json:"done,omitempty"`
-	Error   string  `protobuf:"bytes,6,opt,name=error,proto3" json:"error,omitempty"`
+	JobID           string  `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	Phase           string  `protobuf:"bytes,2,opt,name=phase,proto3" json:"phase,omitempty"`
+	Percent         float32 `protobuf:"fixed32,3,opt,name=percent,proto3" json:"percent,omitempty"`
+	Message         string  `protobuf:"bytes,4,opt,name=message,proto3" json:"message,omitempty"`
+	Done            bool    `protobuf:"varint,5,opt,name=done,proto3" json:"done,omitempty"`
+	Error           string  `protobuf:"bytes,6,opt,name=error,proto3" json:"error,omitempty"`
+	RateLimitWaitMs int64   `protobuf:"varint,7,opt,name=rate_limit_wait_ms,json=rateLimitWaitMs,proto3" json:"rate_limit_wait_ms,omitempty"`
+	ErrorCode       string  `protobuf:"bytes,8,opt,name=error_code,json=errorCode,proto3" json:"error_code,omitempty"`
 }
 
 func (m *JobInfo) Reset()         { *m = JobInfo{} }
@@ -109,8 +176,12 @@ func (m *ListJobsResponse) String() string { return proto.CompactTextString(m) }
 func (*ListJobsResponse) ProtoMessage()    {}
 
 var (
+	_ proto.Message = (*FileFilter)(nil)
 	_ proto.Message = (*ResolveLinksRequest)(nil)
+	_ proto.Message = (*LinkResult)(nil)
 	_ proto.Message = (*ResolveLinksResponse)(nil)
+	_ proto.Message = (*TreeNode)(nil)
+	_ proto.Message = (*ResolveTreeResponse)(nil)
 	_ proto.Message = (*StartDownloadRequest)(nil)
 	_ proto.Message = (*StartDownloadResponse)(nil)
 	_ proto.Message = (*GetProgressRequest)(nil)
@@ -13,6 +13,7 @@ const CMRDServiceServiceName = "cmrd.v1.CMRDService"
 
 type CMRDServiceClient interface {
 	ResolveLinks(ctx context.Context, in *ResolveLinksRequest, opts ...grpc.CallOption) (*ResolveLinksResponse, error)
+	ResolveTree(ctx context.Context, in *ResolveLinksRequest, opts ...grpc.CallOption) (*ResolveTreeResponse, error)
 	StartDownload(ctx context.Context, in *StartDownloadRequest, opts ...grpc.CallOption) (*StartDownloadResponse, error)
 	GetProgress(ctx context.Context, in *GetProgressRequest, opts ...grpc.CallOption) (*GetProgressResponse, error)
 	SubscribeProgress(ctx context.Context, in *GetProgressRequest, opts ...grpc.CallOption) (CMRDService_SubscribeProgressClient, error)
@@ -37,6 +38,15 @@ func (c *cmrdServiceClient) ResolveLinks(ctx context.Context, in *ResolveLinksRe
 	return out, nil
 }
 
+func (c *cmrdServiceClient) ResolveTree(ctx context.Context, in *ResolveLinksRequest, opts ...grpc.CallOption) (*ResolveTreeResponse, error) {
+	out := new(ResolveTreeResponse)
+	err := c.cc.Invoke(ctx, "/"+CMRDServiceServiceName+"/ResolveTree", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *cmrdServiceClient) StartDownload(ctx context.Context, in *StartDownloadRequest, opts ...grpc.CallOption) (*StartDownloadResponse, error) {
 	out := new(StartDownloadResponse)
 	err := c.cc.Invoke(ctx, "/"+CMRDServiceServiceName+"/StartDownload", in, out, opts...)
@@ -107,6 +117,7 @@ func (c *cmrdServiceClient) ListJobs(ctx context.Context, in *ListJobsRequest, o
 
 type CMRDServiceServer interface {
 	ResolveLinks(context.Context, *ResolveLinksRequest) (*ResolveLinksResponse, error)
+	ResolveTree(context.Context, *ResolveLinksRequest) (*ResolveTreeResponse, error)
 	StartDownload(context.Context, *StartDownloadRequest) (*StartDownloadResponse, error)
 	GetProgress(context.Context, *GetProgressRequest) (*GetProgressResponse, error)
 	SubscribeProgress(*GetProgressRequest, CMRDService_SubscribeProgressServer) error
@@ -121,6 +132,10 @@ func (UnimplementedCMRDServiceServer) ResolveLinks(context.Context, *ResolveLink
 	return nil, status.Errorf(codes.Unimplemented, "method ResolveLinks not implemented")
 }
 
+func (UnimplementedCMRDServiceServer) ResolveTree(context.Context, *ResolveLinksRequest) (*ResolveTreeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResolveTree not implemented")
+}
+
 func (UnimplementedCMRDServiceServer) StartDownload(context.Context, *StartDownloadRequest) (*StartDownloadResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method StartDownload not implemented")
 }
@@ -165,6 +180,24 @@ func _CMRDService_ResolveLinks_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
+func _CMRDService_ResolveTree_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResolveLinksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CMRDServiceServer).ResolveTree(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + CMRDServiceServiceName + "/ResolveTree",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CMRDServiceServer).ResolveTree(ctx, req.(*ResolveLinksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _CMRDService_StartDownload_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(StartDownloadRequest)
 	if err := dec(in); err != nil {
@@ -269,6 +302,10 @@ var CMRDServiceServiceDesc = grpc.ServiceDesc{
 			MethodName: "ResolveLinks",
 			Handler:    _CMRDService_ResolveLinks_Handler,
 		},
+		{
+			MethodName: "ResolveTree",
+			Handler:    _CMRDService_ResolveTree_Handler,
+		},
 		{
 			MethodName: "StartDownload",
 			Handler:    _CMRDService_StartDownload_Handler,
@@ -16,20 +16,25 @@ import (
 )
 
 type serviceClient interface {
-	Resolve(ctx context.Context, links []string) ([]cmrd.FileTask, error)
+	ResolveAll(ctx context.Context, links []string) []cmrd.LinkResult
+	ResolveTree(ctx context.Context, links []string) (*cmrd.Tree, error)
 	Download(ctx context.Context, links []string, onProgress cmrd.ProgressHandler) error
 }
 
 type jobState struct {
-	JobID    string
-	Phase    string
-	Percent  float64
-	Message  string
-	Done     bool
-	ErrText  string
+	JobID   string
+	Phase   string
+	Percent float64
+	Message string
+	Done    bool
+	ErrText string
+	// ErrCode is the cmrd error code of ErrText, e.g. LINK_NOT_FOUND.
+	ErrCode  string
 	Cancel   context.CancelFunc
 	Started  time.Time
 	Finished time.Time
+	// RateLimitWait is the time the job has waited on the shared API rate limiter.
+	RateLimitWait time.Duration
 }
 
 // Server implements CMRD gRPC service.
@@ -49,48 +54,106 @@ var (
 	subCounter atomic.Uint64
 )
 
-// NewServer creates gRPC service instance.
-func NewServer(cfg cmrd.Config) *Server {
+// NewServer creates gRPC service instance. It fails on an invalid proxy list.
+func NewServer(cfg cmrd.Config) (*Server, error) {
 	return NewServerWithFactory(cfg, func(config cmrd.Config) (serviceClient, error) {
 		return cmrd.New(config)
 	})
 }
 
 // NewServerWithFactory creates gRPC server with custom client factory.
-func NewServerWithFactory(cfg cmrd.Config, factory func(cmrd.Config) (serviceClient, error)) *Server {
+// The API rate limit and proxy pool of cfg are shared by all requests and jobs of the server.
+func NewServerWithFactory(cfg cmrd.Config, factory func(cmrd.Config) (serviceClient, error)) (*Server, error) {
+	if cfg.RateLimiter == nil {
+		cfg.RateLimiter = cmrd.NewRateLimiter(cfg.RateLimit, cfg.RateBurst)
+	}
+	if cfg.ProxyPool == nil {
+		pool, err := cmrd.NewProxyPool(cfg)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ProxyPool = pool
+	}
 	return &Server{
 		baseConfig:    cfg,
 		clientFactory: factory,
 		jobs:          make(map[string]*jobState),
 		subs:          make(map[string]map[uint64]chan jobState),
-	}
+	}, nil
 }
 
 func (s *Server) ResolveLinks(ctx context.Context, req *pb.ResolveLinksRequest) (*pb.ResolveLinksResponse, error) {
-	if req == nil || len(req.Links) == 0 {
-		return nil, status.Error(codes.InvalidArgument, "links are required")
+	client, err := s.resolveClient(req)
+	if err != nil {
+		return nil, err
+	}
+
+	results := client.ResolveAll(ctx, req.Links)
+	if err := ctx.Err(); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+
+	// Partial failures are reported per link; the call fails only when nothing resolved.
+	var (
+		response = &pb.ResolveLinksResponse{}
+		firstErr error
+		resolved int
+	)
+	for _, result := range results {
+		response.Links = append(response.Links, toLinkResult(result))
+		if result.Err != nil {
+			if firstErr == nil {
+				firstErr = result.Err
+			}
+			continue
+		}
+		resolved++
+		for _, file := range result.Files {
+			response.Files = append(response.Files, toResolvedFile(file))
+		}
+	}
+	if resolved == 0 && firstErr != nil {
+		return nil, statusError("resolve", firstErr)
 	}
+	return response, nil
+}
 
-	client, err := s.clientFactory(s.baseConfig)
+// ResolveTree resolves links into a folder tree; unlike ResolveLinks it fails on the first failed link.
+func (s *Server) ResolveTree(ctx context.Context, req *pb.ResolveLinksRequest) (*pb.ResolveTreeResponse, error) {
+	client, err := s.resolveClient(req)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "create client: %v", err)
+		return nil, err
 	}
 
-	files, err := client.Resolve(ctx, req.Links)
+	tree, err := client.ResolveTree(ctx, req.Links)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, status.FromContextError(ctxErr).Err()
+	}
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "resolve: %v", err)
+		return nil, statusError("resolve", err)
+	}
+	return &pb.ResolveTreeResponse{Root: toTreeNode(tree.Root)}, nil
+}
+
+// resolveClient validates a resolve request and creates a client for it.
+func (s *Server) resolveClient(req *pb.ResolveLinksRequest) (serviceClient, error) {
+	if req == nil || len(req.Links) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "links are required")
 	}
 
-	response := &pb.ResolveLinksResponse{
-		Files: make([]*pb.ResolvedFile, 0, len(files)),
+	cfg := s.baseConfig
+	if err := applyFilter(&cfg, req.Filter); err != nil {
+		return nil, err
 	}
-	for _, file := range files {
-		response.Files = append(response.Files, &pb.ResolvedFile{
-			URL:    file.URL,
-			Output: file.Output,
-		})
+	if req.NoCache {
+		cfg.CacheDir = ""
 	}
-	return response, nil
+
+	client, err := s.clientFactory(cfg)
+	if err != nil {
+		return nil, statusError("create client", err)
+	}
+	return client, nil
 }
 
 func (s *Server) StartDownload(_ context.Context, req *pb.StartDownloadRequest) (*pb.StartDownloadResponse, error) {
@@ -102,10 +165,16 @@ func (s *Server) StartDownload(_ context.Context, req *pb.StartDownloadRequest)
 	if strings.TrimSpace(req.DownloadDir) != "" {
 		cfg.DownloadDir = strings.TrimSpace(req.DownloadDir)
 	}
+	if req.ContinueOnError {
+		cfg.ContinueOnError = true
+	}
+	if err := applyFilter(&cfg, req.Filter); err != nil {
+		return nil, err
+	}
 
 	client, err := s.clientFactory(cfg)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "create client: %v", err)
+		return nil, statusError("create client", err)
 	}
 
 	jobID := nextJobID()
@@ -125,11 +194,13 @@ func (s *Server) StartDownload(_ context.Context, req *pb.StartDownloadRequest)
 				state.Percent = event.Percent
 				state.Message = fallback(event.Message, state.Message)
 				state.Done = event.Done
+				state.RateLimitWait = max(state.RateLimitWait, event.RateLimitWait)
 				if event.Done && state.Finished.IsZero() {
 					state.Finished = time.Now()
 				}
 				if event.Err != nil {
 					state.ErrText = event.Err.Error()
+					state.ErrCode = cmrd.Code(event.Err)
 					state.Done = true
 					state.Finished = time.Now()
 				}
@@ -147,6 +218,7 @@ func (s *Server) StartDownload(_ context.Context, req *pb.StartDownloadRequest)
 				state.Phase = "failed"
 				state.Done = true
 				state.ErrText = err.Error()
+				state.ErrCode = cmrd.Code(err)
 				state.Message = "download failed"
 				state.Finished = time.Now()
 			})
@@ -242,12 +314,14 @@ func (s *Server) ListJobs(_ context.Context, _ *pb.ListJobsRequest) (*pb.ListJob
 	}
 	for _, state := range s.jobs {
 		response.Jobs = append(response.Jobs, &pb.JobInfo{
-			JobID:   state.JobID,
-			Phase:   state.Phase,
-			Percent: float32(state.Percent),
-			Message: state.Message,
-			Done:    state.Done,
-			Error:   state.ErrText,
+			JobID:           state.JobID,
+			Phase:           state.Phase,
+			Percent:         float32(state.Percent),
+			Message:         state.Message,
+			Done:            state.Done,
+			Error:           state.ErrText,
+			RateLimitWaitMs: state.RateLimitWait.Milliseconds(),
+			ErrorCode:       state.ErrCode,
 		})
 	}
 	return response, nil
@@ -286,18 +360,15 @@ func (s *Server) updateJob(jobID string, update func(*jobState)) {
 	}
 	update(state)
 	snapshot := *state
-	subscribers := make([]chan jobState, 0, len(s.subs[jobID]))
+	// Sends happen under the lock, so unsubscribe cannot close a channel in
+	// between; they never block, slow subscribers just miss updates.
 	for _, ch := range s.subs[jobID] {
-		subscribers = append(subscribers, ch)
-	}
-	s.mu.Unlock()
-
-	for _, ch := range subscribers {
 		select {
 		case ch <- snapshot:
 		default:
 		}
 	}
+	s.mu.Unlock()
 }
 
 func (s *Server) subscribe(jobID string) (uint64, <-chan jobState, error) {
@@ -338,14 +409,90 @@ func (s *Server) unsubscribe(jobID string, subID uint64) {
 	}
 }
 
+func toResolvedFile(file cmrd.FileTask) *pb.ResolvedFile {
+	resolved := &pb.ResolvedFile{
+		URL:            file.URL,
+		Output:         file.Output,
+		Size:           file.Size,
+		Hash:           file.Hash,
+		RemotePath:     file.RemotePath,
+		OriginalOutput: file.OriginalOutput,
+		Mirrors:        file.Mirrors,
+		Provider:       file.Provider,
+	}
+	if !file.ModTime.IsZero() {
+		resolved.Mtime = file.ModTime.Unix()
+	}
+	return resolved
+}
+
+func toTreeNode(node *cmrd.Node) *pb.TreeNode {
+	converted := &pb.TreeNode{
+		Name:       node.Name,
+		Path:       node.Path,
+		RemotePath: node.RemotePath,
+		Dir:        node.Dir,
+		Size:       node.Size,
+		Files:      int32(node.Files),
+		Folders:    int32(node.Folders),
+	}
+	if node.File != nil {
+		converted.File = toResolvedFile(*node.File)
+	}
+	for _, child := range node.Children {
+		converted.Children = append(converted.Children, toTreeNode(child))
+	}
+	return converted
+}
+
+// applyFilter sets a request filter on cfg; an empty filter keeps the server default.
+func applyFilter(cfg *cmrd.Config, filter *pb.FileFilter) error {
+	if filter == nil {
+		return nil
+	}
+	converted := cmrd.Filter{
+		Include:      filter.Include,
+		Exclude:      filter.Exclude,
+		IncludeRegex: filter.IncludeRegex,
+		ExcludeRegex: filter.ExcludeRegex,
+		Extensions:   filter.Extensions,
+		MinSize:      filter.MinSize,
+		MaxSize:      filter.MaxSize,
+		MaxDepth:     int(filter.MaxDepth),
+	}
+	if converted.IsZero() {
+		return nil
+	}
+	if err := converted.Validate(); err != nil {
+		return status.Errorf(codes.InvalidArgument, "filter: %v", err)
+	}
+	cfg.Filter = converted
+	return nil
+}
+
+func toLinkResult(result cmrd.LinkResult) *pb.LinkResult {
+	converted := &pb.LinkResult{
+		Link:       result.Link,
+		FileCount:  int32(len(result.Files)),
+		DurationMs: result.Duration.Milliseconds(),
+	}
+	if result.Err != nil {
+		converted.Error = result.Err.Error()
+		converted.ErrorCode = cmrd.Code(result.Err)
+	}
+	return converted
+}
+
 func toProgressResponse(state *jobState) *pb.GetProgressResponse {
 	return &pb.GetProgressResponse{
-		JobID:   state.JobID,
-		Phase:   state.Phase,
-		Percent: float32(state.Percent),
-		Message: state.Message,
-		Done:    state.Done,
-		Error:   state.ErrText,
+		JobID:           state.JobID,
+		Phase:           state.Phase,
+		Percent:         float32(state.Percent),
+		Message:         state.Message,
+		Done:            state.Done,
+		Error:           state.ErrText,
+		RateLimitWaitMs: state.RateLimitWait.Milliseconds(),
+		ErrorCode:       state.ErrCode,
 	}
 }
 
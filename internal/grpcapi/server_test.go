@@ -3,12 +3,16 @@ package grpcapi
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"testing"
 	"time"
 
+	"github.com/golang/protobuf/proto"
+	"github.com/jhonroun/cmrd/internal/cloudmail"
 	"github.com/jhonroun/cmrd/internal/grpcapi/pb"
 	"github.com/jhonroun/cmrd/pkg/cmrd"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
@@ -17,15 +21,28 @@ import (
 type mockServiceClient struct {
 	resolveResult []cmrd.FileTask
 	resolveErr    error
+	resolveAll    func([]string) []cmrd.LinkResult
 	downloadErr   error
 	downloadFn    func(context.Context, []string, cmrd.ProgressHandler) error
+	resolveTree   func([]string) (*cmrd.Tree, error)
 }
 
-func (m *mockServiceClient) Resolve(_ context.Context, _ []string) ([]cmrd.FileTask, error) {
-	if m.resolveErr != nil {
-		return nil, m.resolveErr
+func (m *mockServiceClient) ResolveAll(_ context.Context, links []string) []cmrd.LinkResult {
+	if m.resolveAll != nil {
+		return m.resolveAll(links)
 	}
-	return m.resolveResult, nil
+	results := make([]cmrd.LinkResult, 0, len(links))
+	for _, link := range links {
+		results = append(results, cmrd.LinkResult{Link: link, Files: m.resolveResult, Err: m.resolveErr})
+	}
+	return results
+}
+
+func (m *mockServiceClient) ResolveTree(_ context.Context, links []string) (*cmrd.Tree, error) {
+	if m.resolveTree != nil {
+		return m.resolveTree(links)
+	}
+	return nil, m.resolveErr
 }
 
 func (m *mockServiceClient) Download(ctx context.Context, links []string, onProgress cmrd.ProgressHandler) error {
@@ -35,6 +52,15 @@ func (m *mockServiceClient) Download(ctx context.Context, links []string, onProg
 	return m.downloadErr
 }
 
+func newTestServer(t *testing.T, cfg cmrd.Config, factory func(cmrd.Config) (serviceClient, error)) *Server {
+	t.Helper()
+	server, err := NewServerWithFactory(cfg, factory)
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	return server
+}
+
 type progressStreamStub struct {
 	ctx      context.Context
 	messages []*pb.GetProgressResponse
@@ -57,7 +83,7 @@ func (s *progressStreamStub) SendMsg(interface{}) error    { return nil }
 func (s *progressStreamStub) RecvMsg(interface{}) error    { return io.EOF }
 
 func TestResolveLinksInvalidArgument(t *testing.T) {
-	server := NewServerWithFactory(cmrd.DefaultConfig(), func(cmrd.Config) (serviceClient, error) {
+	server := newTestServer(t, cmrd.DefaultConfig(), func(cmrd.Config) (serviceClient, error) {
 		return &mockServiceClient{}, nil
 	})
 
@@ -71,7 +97,7 @@ func TestResolveLinksInvalidArgument(t *testing.T) {
 }
 
 func TestStartDownloadAndSubscribeProgress(t *testing.T) {
-	server := NewServerWithFactory(cmrd.DefaultConfig(), func(cmrd.Config) (serviceClient, error) {
+	server := newTestServer(t, cmrd.DefaultConfig(), func(cmrd.Config) (serviceClient, error) {
 		return &mockServiceClient{
 			downloadFn: func(ctx context.Context, _ []string, onProgress cmrd.ProgressHandler) error {
 				onProgress(cmrd.ProgressEvent{Phase: "resolve", Message: "resolve complete", TotalFiles: 2})
@@ -107,7 +133,7 @@ func TestStartDownloadAndSubscribeProgress(t *testing.T) {
 }
 
 func TestStopJob(t *testing.T) {
-	server := NewServerWithFactory(cmrd.DefaultConfig(), func(cmrd.Config) (serviceClient, error) {
+	server := newTestServer(t, cmrd.DefaultConfig(), func(cmrd.Config) (serviceClient, error) {
 		return &mockServiceClient{
 			downloadFn: func(ctx context.Context, _ []string, _ cmrd.ProgressHandler) error {
 				<-ctx.Done()
@@ -151,7 +177,7 @@ func TestStopJob(t *testing.T) {
 }
 
 func TestResolveLinksInternalError(t *testing.T) {
-	server := NewServerWithFactory(cmrd.DefaultConfig(), func(cmrd.Config) (serviceClient, error) {
+	server := newTestServer(t, cmrd.DefaultConfig(), func(cmrd.Config) (serviceClient, error) {
 		return &mockServiceClient{
 			resolveErr: errors.New("resolve failure"),
 		}, nil
@@ -167,3 +193,291 @@ func TestResolveLinksInternalError(t *testing.T) {
 		t.Fatalf("expected Internal, got %s", status.Code(err))
 	}
 }
+
+func TestResolveLinksFileMetadata(t *testing.T) {
+	mtime := time.Unix(1700000000, 0).UTC()
+	server := newTestServer(t, cmrd.DefaultConfig(), func(cmrd.Config) (serviceClient, error) {
+		return &mockServiceClient{
+			resolveResult: []cmrd.FileTask{{
+				URL:        "https://cdn.example/AbCd/EfGh/a.txt",
+				Output:     "root/a.txt",
+				RemotePath: "AbCd/EfGh/a.txt",
+				Size:       12,
+				Hash:       "C172C6E2FF47284FF33F348FEA7EECE532F6C051",
+				ModTime:    mtime,
+			}},
+		}, nil
+	})
+
+	response, err := server.ResolveLinks(context.Background(), &pb.ResolveLinksRequest{
+		Links: []string{"https://cloud.mail.ru/public/AbCd/EfGh"},
+	})
+	if err != nil {
+		t.Fatalf("resolve links: %v", err)
+	}
+	if len(response.Files) != 1 {
+		t.Fatalf("unexpected files count: %d", len(response.Files))
+	}
+	file := response.Files[0]
+	if file.Size != 12 || file.Hash == "" || file.Mtime != mtime.Unix() || file.RemotePath != "AbCd/EfGh/a.txt" {
+		t.Fatalf("unexpected resolved file: %+v", file)
+	}
+}
+
+func TestResolveLinksReportsPerLinkErrors(t *testing.T) {
+	server := newTestServer(t, cmrd.DefaultConfig(), func(cmrd.Config) (serviceClient, error) {
+		return &mockServiceClient{
+			resolveAll: func(links []string) []cmrd.LinkResult {
+				return []cmrd.LinkResult{
+					{Link: links[0], Err: errors.New("http status 404"), Duration: 15 * time.Millisecond},
+					{Link: links[1], Files: []cmrd.FileTask{{URL: "https://cdn.example/a", Output: "a.txt"}}},
+				}
+			},
+		}, nil
+	})
+
+	response, err := server.ResolveLinks(context.Background(), &pb.ResolveLinksRequest{
+		Links: []string{"https://cloud.mail.ru/public/Dead/Link", "https://cloud.mail.ru/public/AbCd/EfGh"},
+	})
+	if err != nil {
+		t.Fatalf("resolve links: %v", err)
+	}
+	if len(response.Files) != 1 || len(response.Links) != 2 {
+		t.Fatalf("unexpected response: files=%d links=%d", len(response.Files), len(response.Links))
+	}
+	dead := response.Links[0]
+	if dead.Error != "http status 404" || dead.FileCount != 0 || dead.DurationMs != 15 {
+		t.Fatalf("unexpected dead link result: %+v", dead)
+	}
+	if alive := response.Links[1]; alive.Error != "" || alive.FileCount != 1 {
+		t.Fatalf("unexpected alive link result: %+v", alive)
+	}
+}
+
+func TestResolveLinksFilter(t *testing.T) {
+	var got cmrd.Filter
+	server := newTestServer(t, cmrd.DefaultConfig(), func(cfg cmrd.Config) (serviceClient, error) {
+		got = cfg.Filter
+		return &mockServiceClient{}, nil
+	})
+
+	_, err := server.ResolveLinks(context.Background(), &pb.ResolveLinksRequest{
+		Links:  []string{"https://cloud.mail.ru/public/AbCd/EfGh"},
+		Filter: &pb.FileFilter{Include: []string{"*.pdf"}, Exclude: []string{"video/"}, MaxSize: 2 << 30, MaxDepth: 3},
+	})
+	if err != nil {
+		t.Fatalf("resolve links: %v", err)
+	}
+	if len(got.Include) != 1 || got.Include[0] != "*.pdf" || got.Exclude[0] != "video/" || got.MaxSize != 2<<30 || got.MaxDepth != 3 {
+		t.Fatalf("filter was not passed to client config: %+v", got)
+	}
+
+	_, err = server.ResolveLinks(context.Background(), &pb.ResolveLinksRequest{
+		Links:  []string{"https://cloud.mail.ru/public/AbCd/EfGh"},
+		Filter: &pb.FileFilter{IncludeRegex: []string{"("}},
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument, got %v", err)
+	}
+}
+
+func TestResolveLinksCache(t *testing.T) {
+	base := cmrd.DefaultConfig()
+	base.CacheDir = t.TempDir()
+
+	var got string
+	server := newTestServer(t, base, func(cfg cmrd.Config) (serviceClient, error) {
+		got = cfg.CacheDir
+		return &mockServiceClient{}, nil
+	})
+
+	for _, noCache := range []bool{false, true} {
+		_, err := server.ResolveLinks(context.Background(), &pb.ResolveLinksRequest{
+			Links:   []string{"https://cloud.mail.ru/public/AbCd/EfGh"},
+			NoCache: noCache,
+		})
+		if err != nil {
+			t.Fatalf("resolve links: %v", err)
+		}
+		want := base.CacheDir
+		if noCache {
+			want = ""
+		}
+		if got != want {
+			t.Fatalf("cache dir mismatch: got=%q want=%q", got, want)
+		}
+	}
+}
+
+func TestRateLimiterSharedByJobs(t *testing.T) {
+	cfg := cmrd.DefaultConfig()
+	cfg.RateLimit = 2
+	var limiters []*cmrd.RateLimiter
+	server := newTestServer(t, cfg, func(config cmrd.Config) (serviceClient, error) {
+		limiters = append(limiters, config.RateLimiter)
+		return &mockServiceClient{
+			downloadFn: func(_ context.Context, _ []string, onProgress cmrd.ProgressHandler) error {
+				onProgress(cmrd.ProgressEvent{Phase: "resolve", Message: "rate limit", RateLimitWait: 1500 * time.Millisecond})
+				return nil
+			},
+		}, nil
+	})
+
+	var jobs []string
+	for range 2 {
+		started, err := server.StartDownload(context.Background(), &pb.StartDownloadRequest{
+			Links: []string{"https://cloud.mail.ru/public/9bFs/gVzxjU5uC"},
+		})
+		if err != nil {
+			t.Fatalf("start download: %v", err)
+		}
+		jobs = append(jobs, started.JobID)
+	}
+	if len(limiters) != 2 || limiters[0] == nil || limiters[0] != limiters[1] {
+		t.Fatalf("jobs do not share one rate limiter: %v", limiters)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		progress, err := server.GetProgress(context.Background(), &pb.GetProgressRequest{JobID: jobs[0]})
+		if err != nil {
+			t.Fatalf("get progress: %v", err)
+		}
+		if progress.Done {
+			if progress.RateLimitWaitMs != 1500 {
+				t.Fatalf("rate limit wait mismatch: got=%d want=1500", progress.RateLimitWaitMs)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job did not finish: %+v", progress)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestResolveLinksErrorDetails(t *testing.T) {
+	server := newTestServer(t, cmrd.DefaultConfig(), func(cmrd.Config) (serviceClient, error) {
+		return &mockServiceClient{
+			resolveErr: fmt.Errorf("folder: %w", &cloudmail.HTTPError{StatusCode: 429, RetryAfter: 2 * time.Second}),
+		}, nil
+	})
+
+	_, err := server.ResolveLinks(context.Background(), &pb.ResolveLinksRequest{
+		Links: []string{"https://cloud.mail.ru/public/9bFs/gVzxjU5uC"},
+	})
+	st := status.Convert(err)
+	if st.Code() != codes.ResourceExhausted {
+		t.Fatalf("expected ResourceExhausted, got %s", st.Code())
+	}
+	var (
+		info  *errdetails.ErrorInfo
+		retry *errdetails.RetryInfo
+	)
+	for _, detail := range st.Details() {
+		switch typed := detail.(type) {
+		case *errdetails.ErrorInfo:
+			info = typed
+		case *errdetails.RetryInfo:
+			retry = typed
+		}
+	}
+	if info == nil || info.Reason != cmrd.CodeRateLimited || info.Metadata["retryable"] != "true" || info.Metadata["exit_code"] != "4" {
+		t.Fatalf("unexpected error info: %v", info)
+	}
+	if retry == nil || retry.RetryDelay.AsDuration() != 2*time.Second {
+		t.Fatalf("unexpected retry info: %v", retry)
+	}
+}
+
+func TestDownloadJobErrorCode(t *testing.T) {
+	server := newTestServer(t, cmrd.DefaultConfig(), func(cmrd.Config) (serviceClient, error) {
+		return &mockServiceClient{downloadErr: fmt.Errorf("write: %w", cmrd.ErrDiskFull)}, nil
+	})
+
+	start, err := server.StartDownload(context.Background(), &pb.StartDownloadRequest{
+		Links: []string{"https://cloud.mail.ru/public/9bFs/gVzxjU5uC"},
+	})
+	if err != nil {
+		t.Fatalf("start download: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		progress, err := server.GetProgress(context.Background(), &pb.GetProgressRequest{JobID: start.JobID})
+		if err != nil {
+			t.Fatalf("get progress: %v", err)
+		}
+		if progress.Done {
+			if progress.ErrorCode != cmrd.CodeDiskFull {
+				t.Fatalf("unexpected error code: got=%q want=%q", progress.ErrorCode, cmrd.CodeDiskFull)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job did not finish")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestResolveTree(t *testing.T) {
+	file := cmrd.FileTask{URL: "https://cdn.example/a.txt", Output: "share/docs/a.txt", Size: 5}
+	server := newTestServer(t, cmrd.DefaultConfig(), func(cmrd.Config) (serviceClient, error) {
+		return &mockServiceClient{
+			resolveTree: func([]string) (*cmrd.Tree, error) {
+				return &cmrd.Tree{Root: &cmrd.Node{Dir: true, Size: 5, Files: 1, Folders: 3, Children: []*cmrd.Node{{
+					Name: "share", Path: "share", Dir: true, Size: 5, Files: 1, Folders: 2, Children: []*cmrd.Node{
+						{Name: "docs", Path: "share/docs", Dir: true, Size: 5, Files: 1, Children: []*cmrd.Node{
+							{Name: "a.txt", Path: file.Output, Size: 5, File: &file},
+						}},
+						{Name: "empty", Path: "share/empty", Dir: true},
+					},
+				}}}}, nil
+			},
+		}, nil
+	})
+
+	response, err := server.ResolveTree(context.Background(), &pb.ResolveLinksRequest{
+		Links: []string{"https://cloud.mail.ru/public/AbCd/EfGh"},
+	})
+	if err != nil {
+		t.Fatalf("resolve tree: %v", err)
+	}
+
+	// The recursive message must survive the wire encoding.
+	encoded, err := proto.Marshal(response)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	decoded := &pb.ResolveTreeResponse{}
+	if err := proto.Unmarshal(encoded, decoded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	share := decoded.Root.Children[0]
+	if share.Files != 1 || share.Folders != 2 || len(share.Children) != 2 {
+		t.Fatalf("unexpected share node: %+v", share)
+	}
+	docs, empty := share.Children[0], share.Children[1]
+	if len(docs.Children) != 1 || docs.Children[0].File == nil || docs.Children[0].File.URL != file.URL {
+		t.Fatalf("unexpected docs node: %+v", docs)
+	}
+	if !empty.Dir || empty.Path != "share/empty" || len(empty.Children) != 0 {
+		t.Fatalf("unexpected empty node: %+v", empty)
+	}
+
+	server = newTestServer(t, cmrd.DefaultConfig(), func(cmrd.Config) (serviceClient, error) {
+		return &mockServiceClient{resolveErr: fmt.Errorf("resolve: %w", cloudmail.ErrNotFound)}, nil
+	})
+	_, err = server.ResolveTree(context.Background(), &pb.ResolveLinksRequest{Links: []string{"https://cloud.mail.ru/public/Dead/Link"}})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("unexpected status: %v", err)
+	}
+}
+
+func TestNewServerRejectsInvalidProxy(t *testing.T) {
+	cfg := cmrd.DefaultConfig()
+	cfg.Proxy = "ftp://proxy.example:21"
+	if _, err := NewServer(cfg); err == nil {
+		t.Fatal("expected an error for an invalid proxy")
+	}
+}
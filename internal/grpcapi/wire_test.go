@@ -19,7 +19,7 @@ func TestGRPCWireSubscribeProgress(t *testing.T) {
 	listener := bufconn.Listen(bufferSize)
 	server := grpc.NewServer()
 
-	service := NewServerWithFactory(cmrd.DefaultConfig(), func(cmrd.Config) (serviceClient, error) {
+	service := newTestServer(t, cmrd.DefaultConfig(), func(cmrd.Config) (serviceClient, error) {
 		return &mockServiceClient{
 			downloadFn: func(ctx context.Context, _ []string, onProgress cmrd.ProgressHandler) error {
 				onProgress(cmrd.ProgressEvent{Phase: "resolve", Message: "resolve complete", TotalFiles: 1})
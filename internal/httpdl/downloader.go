@@ -0,0 +1,675 @@
+package httpdl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jhonroun/cmrd/internal/cloudmail"
+	"github.com/jhonroun/cmrd/internal/proxypool"
+)
+
+const (
+	partSuffix    = ".part"
+	controlSuffix = ".cmrd"
+
+	defaultUserAgent    = "Mozilla/5.0 (compatible; Firefox/3.6; Linux)"
+	defaultMinSplitSize = 20 << 20
+	saveEveryBytes      = 4 << 20
+	bufferSize          = 64 << 10
+)
+
+var contentRangeRE = regexp.MustCompile(`^bytes\s+(?:\d+-\d+|\*)/(\d+)$`)
+
+// ProgressEvent represents one native downloader progress update.
+type ProgressEvent struct {
+	Phase      string
+	Percent    float64
+	Message    string
+	File       string
+	DoneFiles  int
+	TotalFiles int
+	Done       bool
+	Err        error
+}
+
+// Config configures native downloader behavior.
+type Config struct {
+	Timeout   time.Duration
+	UserAgent string
+	// Proxies routes downloads through a proxy pool; nil connects directly.
+	Proxies      *proxypool.Pool
+	Concurrency  int
+	Splits       int
+	MinSplitSize int64
+	Retries      int
+	RetryDelay   time.Duration
+	// Session sends account cookies to the download hosts of private files; nil stays anonymous.
+	Session *cloudmail.Session
+}
+
+// Downloader downloads files over HTTP with segmented Range requests and resume.
+type Downloader struct {
+	client *http.Client
+	cfg    Config
+}
+
+// NewDownloader creates a new native downloader.
+func NewDownloader(cfg Config) (*Downloader, error) {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 10
+	}
+	if cfg.Splits <= 0 {
+		cfg.Splits = 10
+	}
+	if cfg.MinSplitSize <= 0 {
+		cfg.MinSplitSize = defaultMinSplitSize
+	}
+	if cfg.Retries < 0 {
+		cfg.Retries = 0
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = time.Second
+	}
+	if strings.TrimSpace(cfg.UserAgent) == "" {
+		cfg.UserAgent = defaultUserAgent
+	}
+
+	transport, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return nil, errors.New("unexpected default transport type")
+	}
+	cloned := transport.Clone()
+	cloned.ResponseHeaderTimeout = cfg.Timeout
+	cloned.MaxIdleConnsPerHost = cfg.Concurrency * cfg.Splits
+
+	var roundTripper http.RoundTripper = cloned
+	if cfg.Proxies != nil {
+		roundTripper = cfg.Proxies.Transport(cloned)
+	}
+
+	return &Downloader{
+		client: &http.Client{Transport: roundTripper},
+		cfg:    cfg,
+	}, nil
+}
+
+// Download fetches all files into downloadDir and reports progress.
+// Failed files do not stop the others; their errors are joined into the result.
+func (d *Downloader) Download(ctx context.Context, files []cloudmail.File, downloadDir string, onUpdate func(ProgressEvent)) error {
+	source := make(chan cloudmail.File)
+	go func() {
+		defer close(source)
+		for _, file := range files {
+			select {
+			case source <- file:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return d.DownloadStream(ctx, source, downloadDir, onUpdate)
+}
+
+// DownloadStream downloads files as they arrive on source until it is closed.
+// The caller must stop sending once ctx is done.
+func (d *Downloader) DownloadStream(ctx context.Context, source <-chan cloudmail.File, downloadDir string, onUpdate func(ProgressEvent)) error {
+	var emitMu sync.Mutex
+	emit := func(event ProgressEvent) {
+		if onUpdate == nil {
+			return
+		}
+		emitMu.Lock()
+		defer emitMu.Unlock()
+		onUpdate(event)
+	}
+	emit(ProgressEvent{Phase: "download", Message: "native downloader started"})
+
+	type job struct {
+		index int
+		file  cloudmail.File
+	}
+
+	tracker := newTracker()
+	jobs := make(chan job)
+
+	var (
+		errMu  sync.Mutex
+		failed []error
+	)
+
+	var wg sync.WaitGroup
+	wg.Add(d.cfg.Concurrency)
+	for i := 0; i < d.cfg.Concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			for next := range jobs {
+				file := next.file
+				err := d.downloadFile(ctx, file, downloadDir, tracker.file(next.index))
+				doneFiles, totalFiles, percent := tracker.finish(next.index, err == nil)
+				if err != nil {
+					errMu.Lock()
+					failed = append(failed, fmt.Errorf("%s: %w", file.Output, err))
+					errMu.Unlock()
+					emit(ProgressEvent{
+						Phase:      "download",
+						Percent:    percent,
+						Message:    fmt.Sprintf("download failed: %s: %v", file.Output, err),
+						File:       file.Output,
+						DoneFiles:  doneFiles,
+						TotalFiles: totalFiles,
+					})
+					continue
+				}
+				emit(ProgressEvent{
+					Phase:      "download",
+					Percent:    percent,
+					Message:    "download complete: " + file.Output,
+					File:       file.Output,
+					DoneFiles:  doneFiles,
+					TotalFiles: totalFiles,
+				})
+			}
+		}()
+	}
+
+	stopTicker := make(chan struct{})
+	tickerDone := make(chan struct{})
+	go func() {
+		defer close(tickerDone)
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopTicker:
+				return
+			case <-ticker.C:
+				doneFiles, totalFiles, percent, current := tracker.snapshot()
+				emit(ProgressEvent{
+					Phase:      "download",
+					Percent:    percent,
+					Message:    fmt.Sprintf("downloading: %d/%d files", doneFiles, totalFiles),
+					File:       current,
+					DoneFiles:  doneFiles,
+					TotalFiles: totalFiles,
+				})
+			}
+		}
+	}()
+
+feed:
+	for {
+		select {
+		case file, ok := <-source:
+			if !ok {
+				break feed
+			}
+			index := tracker.add(file.Output)
+			select {
+			case jobs <- job{index: index, file: file}:
+			case <-ctx.Done():
+				break feed
+			}
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	close(stopTicker)
+	<-tickerDone
+
+	doneFiles, totalFiles, percent, _ := tracker.snapshot()
+	err := ctx.Err()
+	if err == nil && len(failed) > 0 {
+		err = fmt.Errorf("%d of %d files failed: %w", len(failed), totalFiles, errors.Join(failed...))
+	}
+
+	if err != nil {
+		emit(ProgressEvent{
+			Phase:      "download",
+			Percent:    percent,
+			Message:    err.Error(),
+			DoneFiles:  doneFiles,
+			TotalFiles: totalFiles,
+			Done:       true,
+			Err:        err,
+		})
+		return err
+	}
+
+	emit(ProgressEvent{
+		Phase:      "download",
+		Percent:    100,
+		Message:    "native downloader finished",
+		DoneFiles:  doneFiles,
+		TotalFiles: totalFiles,
+		Done:       true,
+	})
+	return nil
+}
+
+type remoteInfo struct {
+	size   int64
+	ranged bool
+}
+
+type segment struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+	Next  int64 `json:"next"`
+}
+
+func (s segment) complete() bool {
+	return s.End >= 0 && s.Next > s.End
+}
+
+type controlState struct {
+	Size     int64     `json:"size"`
+	Segments []segment `json:"segments"`
+
+	mu        sync.Mutex
+	path      string
+	unsavedAt int64
+}
+
+func (d *Downloader) downloadFile(ctx context.Context, file cloudmail.File, downloadDir string, progress *fileProgress) error {
+	target := filepath.Join(downloadDir, filepath.FromSlash(file.Output))
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	partPath := target + partSuffix
+	controlPath := target + controlSuffix
+
+	// Attempts rotate over the file URL and its mirrors, so a dead shard only
+	// costs one attempt. Segments start on different shards to spread the load.
+	urls := append([]string{file.URL}, file.Mirrors...)
+	var info remoteInfo
+	err := d.retry(ctx, len(urls)-1, func(attempt int) error {
+		var probeErr error
+		info, probeErr = d.probe(ctx, urls[attempt%len(urls)])
+		return probeErr
+	})
+	if err != nil {
+		return err
+	}
+	progress.setSize(info.size)
+
+	if !fileExists(partPath) {
+		if stat, statErr := os.Stat(target); statErr == nil {
+			if info.size >= 0 && stat.Size() == info.size {
+				progress.add(info.size)
+				return nil
+			}
+			if err := os.Rename(target, partPath); err != nil {
+				return err
+			}
+		}
+	}
+
+	state := d.loadOrPlan(info, partPath, controlPath)
+	for _, seg := range state.Segments {
+		progress.add(seg.Next - seg.Start)
+	}
+
+	out, err := os.OpenFile(partPath, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if info.size >= 0 {
+		if err := out.Truncate(info.size); err != nil {
+			return err
+		}
+	}
+
+	segCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	segErrs := make([]error, len(state.Segments))
+	var wg sync.WaitGroup
+	for index := range state.Segments {
+		if state.Segments[index].complete() {
+			continue
+		}
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			err := d.retry(segCtx, len(urls)-1, func(attempt int) error {
+				return d.fetchSegment(segCtx, urls[(index+attempt)%len(urls)], out, state, index, info.ranged, progress)
+			})
+			if err != nil {
+				if !errors.Is(err, context.Canceled) {
+					segErrs[index] = err
+				}
+				cancel()
+			}
+		}(index)
+	}
+	wg.Wait()
+
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		state.save()
+		return ctxErr
+	}
+	if err := errors.Join(segErrs...); err != nil {
+		state.save()
+		return err
+	}
+
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(partPath, target); err != nil {
+		return err
+	}
+	if err := os.Remove(controlPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// probe requests the first byte to learn file size and Range support.
+func (d *Downloader) probe(ctx context.Context, rawURL string) (remoteInfo, error) {
+	req, err := d.newRequest(ctx, rawURL)
+	if err != nil {
+		return remoteInfo{}, err
+	}
+	req.Header.Set("Range", "bytes=0-0")
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return remoteInfo{}, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, bufferSize))
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		size, ok := parseContentRangeSize(resp.Header.Get("Content-Range"))
+		if !ok {
+			return remoteInfo{size: -1}, nil
+		}
+		return remoteInfo{size: size, ranged: true}, nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		size, ok := parseContentRangeSize(resp.Header.Get("Content-Range"))
+		if ok && size == 0 {
+			return remoteInfo{size: 0}, nil
+		}
+		return remoteInfo{}, &StatusError{Code: resp.StatusCode}
+	case http.StatusOK:
+		return remoteInfo{size: resp.ContentLength}, nil
+	default:
+		return remoteInfo{}, &StatusError{Code: resp.StatusCode}
+	}
+}
+
+func (d *Downloader) loadOrPlan(info remoteInfo, partPath string, controlPath string) *controlState {
+	if info.ranged {
+		if state, err := loadControl(controlPath); err == nil && state.Size == info.size && fileExists(partPath) {
+			return state
+		}
+	}
+
+	state := &controlState{Size: info.size, path: controlPath}
+	if info.size == 0 {
+		return state
+	}
+	if !info.ranged {
+		_ = os.Remove(partPath)
+		end := info.size - 1
+		if info.size < 0 {
+			end = -1
+		}
+		state.Segments = []segment{{Start: 0, End: end}}
+		return state
+	}
+
+	// A part file without control data is resumed as a single tail segment.
+	if stat, err := os.Stat(partPath); err == nil && stat.Size() > 0 && stat.Size() < info.size {
+		state.Segments = []segment{{Start: 0, End: info.size - 1, Next: stat.Size()}}
+		return state
+	}
+
+	splits := int64(d.cfg.Splits)
+	if maxSplits := info.size / d.cfg.MinSplitSize; maxSplits < splits {
+		splits = maxSplits
+	}
+	if splits < 1 {
+		splits = 1
+	}
+	chunk := info.size / splits
+	for i := int64(0); i < splits; i++ {
+		start := i * chunk
+		end := start + chunk - 1
+		if i == splits-1 {
+			end = info.size - 1
+		}
+		state.Segments = append(state.Segments, segment{Start: start, End: end, Next: start})
+	}
+	return state
+}
+
+func (d *Downloader) fetchSegment(ctx context.Context, rawURL string, out *os.File, state *controlState, index int, ranged bool, progress *fileProgress) error {
+	state.mu.Lock()
+	seg := state.Segments[index]
+	state.mu.Unlock()
+
+	if !ranged && seg.Next > seg.Start {
+		// Without Range support a retry has to start over.
+		progress.add(seg.Start - seg.Next)
+		seg.Next = seg.Start
+		state.advance(index, seg.Next)
+	}
+
+	req, err := d.newRequest(ctx, rawURL)
+	if err != nil {
+		return err
+	}
+	if ranged {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", seg.Next, seg.End))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if ranged && resp.StatusCode != http.StatusPartialContent {
+		return &StatusError{Code: resp.StatusCode}
+	}
+	if !ranged && resp.StatusCode != http.StatusOK {
+		return &StatusError{Code: resp.StatusCode}
+	}
+
+	buf := make([]byte, bufferSize)
+	offset := seg.Next
+	for seg.End < 0 || offset <= seg.End {
+		n, readErr := resp.Body.Read(buf)
+		if n > 0 {
+			if seg.End >= 0 && offset+int64(n) > seg.End+1 {
+				n = int(seg.End + 1 - offset)
+			}
+			if _, err := out.WriteAt(buf[:n], offset); err != nil {
+				return err
+			}
+			offset += int64(n)
+			progress.add(int64(n))
+			state.advance(index, offset)
+		}
+		if readErr == io.EOF {
+			if seg.End >= 0 && offset <= seg.End {
+				return io.ErrUnexpectedEOF
+			}
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+
+	if seg.End < 0 {
+		state.finishUnknown(index, offset)
+	}
+	return nil
+}
+
+func (d *Downloader) newRequest(ctx context.Context, rawURL string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", d.cfg.UserAgent)
+	d.cfg.Session.Apply(req)
+	return req, nil
+}
+
+// retry calls fn with the zero-based attempt number until it succeeds or retries run out.
+// At least failover retries are made, so every mirror is tried once even with Retries set to 0.
+func (d *Downloader) retry(ctx context.Context, failover int, fn func(attempt int) error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = fn(attempt)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if attempt >= max(d.cfg.Retries, failover) || !retryable(err) {
+			return err
+		}
+
+		delay := d.cfg.RetryDelay * time.Duration(attempt+1)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// StatusError reports an unexpected HTTP status from the download host.
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("http status %d", e.Code)
+}
+
+// Unwrap returns the failure the status stands for, e.g. cloudmail.ErrQuotaExceeded for 509.
+func (e *StatusError) Unwrap() error {
+	return cloudmail.ErrorForStatus(e.Code)
+}
+
+// IsExpiredLink reports whether err contains a download host rejection
+// (403, 404 or 410) that a freshly resolved URL may fix.
+func IsExpiredLink(err error) bool {
+	switch e := err.(type) {
+	case *StatusError:
+		return e.Code == http.StatusForbidden || e.Code == http.StatusNotFound || e.Code == http.StatusGone
+	case interface{ Unwrap() []error }:
+		for _, inner := range e.Unwrap() {
+			if IsExpiredLink(inner) {
+				return true
+			}
+		}
+	case interface{ Unwrap() error }:
+		return IsExpiredLink(e.Unwrap())
+	}
+	return false
+}
+
+func retryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code == http.StatusTooManyRequests || statusErr.Code >= 500
+	}
+	return true
+}
+
+func parseContentRangeSize(value string) (int64, bool) {
+	matches := contentRangeRE.FindStringSubmatch(strings.TrimSpace(value))
+	if len(matches) < 2 {
+		return 0, false
+	}
+	size, err := strconv.ParseInt(matches[1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return size, true
+}
+
+func loadControl(path string) (*controlState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	state := &controlState{path: path}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	for _, seg := range state.Segments {
+		if seg.Next < seg.Start || seg.End >= state.Size {
+			return nil, errors.New("invalid control file")
+		}
+	}
+	return state, nil
+}
+
+func (s *controlState) advance(index int, next int64) {
+	s.mu.Lock()
+	delta := next - s.Segments[index].Next
+	s.Segments[index].Next = next
+	s.unsavedAt += delta
+	shouldSave := s.unsavedAt >= saveEveryBytes
+	s.mu.Unlock()
+
+	if shouldSave {
+		s.save()
+	}
+}
+
+func (s *controlState) finishUnknown(index int, next int64) {
+	s.mu.Lock()
+	s.Segments[index].End = next - 1
+	s.Segments[index].Next = next
+	s.mu.Unlock()
+}
+
+// save persists segment offsets so an interrupted download can resume.
+func (s *controlState) save() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unsavedAt = 0
+	if s.Size < 0 {
+		return
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return
+	}
+	_ = os.WriteFile(s.path, data, 0o644)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,213 @@
+package httpdl
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jhonroun/cmrd/internal/cloudmail"
+)
+
+func testPayload(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	return data
+}
+
+func newContentServer(t *testing.T, payload []byte, hook func(*http.Request) bool) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hook != nil && !hook(r) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(payload))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDownloadSegmented(t *testing.T) {
+	payload := testPayload(1 << 20)
+	var ranges sync.Map
+	server := newContentServer(t, payload, func(r *http.Request) bool {
+		ranges.Store(r.Header.Get("Range"), true)
+		return true
+	})
+
+	downloader, err := NewDownloader(Config{Splits: 4, MinSplitSize: 64 << 10})
+	if err != nil {
+		t.Fatalf("new downloader: %v", err)
+	}
+
+	dir := t.TempDir()
+	files := []cloudmail.File{
+		{URL: server.URL + "/a", Output: "folder/a.bin"},
+		{URL: server.URL + "/b", Output: "b.bin"},
+	}
+
+	var last ProgressEvent
+	if err := downloader.Download(context.Background(), files, dir, func(event ProgressEvent) {
+		last = event
+	}); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+
+	for _, file := range files {
+		got, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(file.Output)))
+		if err != nil {
+			t.Fatalf("read %s: %v", file.Output, err)
+		}
+		if !bytes.Equal(got, payload) {
+			t.Fatalf("content mismatch for %s", file.Output)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(file.Output))
+		if fileExists(target+partSuffix) || fileExists(target+controlSuffix) {
+			t.Fatalf("temporary files left for %s", file.Output)
+		}
+	}
+
+	if _, ok := ranges.Load("bytes=262144-524287"); !ok {
+		t.Fatalf("expected segmented range requests")
+	}
+	if !last.Done || last.DoneFiles != 2 || last.Percent != 100 {
+		t.Fatalf("unexpected final event: %+v", last)
+	}
+}
+
+func TestDownloadStreamStartsBeforeSourceCloses(t *testing.T) {
+	payload := testPayload(64 << 10)
+	server := newContentServer(t, payload, nil)
+
+	downloader, err := NewDownloader(Config{Concurrency: 2})
+	if err != nil {
+		t.Fatalf("new downloader: %v", err)
+	}
+
+	dir := t.TempDir()
+	source := make(chan cloudmail.File)
+	firstDone := make(chan struct{})
+	var once sync.Once
+	result := make(chan error, 1)
+	var last ProgressEvent
+	go func() {
+		result <- downloader.DownloadStream(context.Background(), source, dir, func(event ProgressEvent) {
+			if event.DoneFiles >= 1 {
+				once.Do(func() { close(firstDone) })
+			}
+			last = event
+		})
+	}()
+
+	source <- cloudmail.File{URL: server.URL + "/a", Output: "a.bin"}
+	select {
+	case <-firstDone:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("first file was not downloaded before the source was closed")
+	}
+	source <- cloudmail.File{URL: server.URL + "/b", Output: "b.bin"}
+	close(source)
+
+	if err := <-result; err != nil {
+		t.Fatalf("download stream: %v", err)
+	}
+	if !last.Done || last.DoneFiles != 2 || last.TotalFiles != 2 {
+		t.Fatalf("unexpected final event: %+v", last)
+	}
+}
+
+func TestDownloadResumesPartialFile(t *testing.T) {
+	payload := testPayload(300 << 10)
+	var served atomic.Int64
+	server := newContentServer(t, payload, func(r *http.Request) bool {
+		if r.Header.Get("Range") != "bytes=0-0" {
+			served.Store(1)
+			if !strings.HasPrefix(r.Header.Get("Range"), "bytes=102400-") {
+				t.Errorf("unexpected resume range %q", r.Header.Get("Range"))
+			}
+		}
+		return true
+	})
+
+	dir := t.TempDir()
+	target := filepath.Join(dir, "resume.bin")
+	if err := os.WriteFile(target+partSuffix, payload[:100<<10], 0o644); err != nil {
+		t.Fatalf("write part: %v", err)
+	}
+
+	downloader, err := NewDownloader(Config{Splits: 4})
+	if err != nil {
+		t.Fatalf("new downloader: %v", err)
+	}
+	files := []cloudmail.File{{URL: server.URL + "/resume", Output: "resume.bin"}}
+	if err := downloader.Download(context.Background(), files, dir, nil); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+
+	got, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatalf("read target: %v", err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Fatalf("resumed content mismatch")
+	}
+	if served.Load() == 0 {
+		t.Fatalf("expected tail request")
+	}
+}
+
+func TestDownloadRetriesTransientErrors(t *testing.T) {
+	payload := testPayload(4 << 10)
+	var calls atomic.Int32
+	server := newContentServer(t, payload, func(*http.Request) bool {
+		return calls.Add(1) > 2
+	})
+
+	downloader, err := NewDownloader(Config{Retries: 3, RetryDelay: time.Millisecond})
+	if err != nil {
+		t.Fatalf("new downloader: %v", err)
+	}
+
+	dir := t.TempDir()
+	files := []cloudmail.File{{URL: server.URL + "/flaky", Output: "flaky.bin"}}
+	if err := downloader.Download(context.Background(), files, dir, nil); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(dir, "flaky.bin"))
+	if err != nil {
+		t.Fatalf("read target: %v", err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Fatalf("content mismatch after retry")
+	}
+}
+
+func TestDownloadReportsPermanentErrors(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(server.Close)
+
+	downloader, err := NewDownloader(Config{Retries: 3, RetryDelay: time.Millisecond})
+	if err != nil {
+		t.Fatalf("new downloader: %v", err)
+	}
+
+	files := []cloudmail.File{{URL: server.URL + "/missing", Output: "missing.bin"}}
+	err = downloader.Download(context.Background(), files, t.TempDir(), nil)
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	if !strings.Contains(err.Error(), "http status 404") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
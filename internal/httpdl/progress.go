@@ -0,0 +1,99 @@
+package httpdl
+
+import "sync"
+
+type fileProgress struct {
+	mu      sync.Mutex
+	size    int64
+	written int64
+}
+
+func (p *fileProgress) setSize(size int64) {
+	p.mu.Lock()
+	p.size = size
+	p.mu.Unlock()
+}
+
+func (p *fileProgress) add(delta int64) {
+	p.mu.Lock()
+	p.written += delta
+	p.mu.Unlock()
+}
+
+func (p *fileProgress) fraction() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.size <= 0 {
+		return 0
+	}
+	value := float64(p.written) / float64(p.size)
+	if value > 1 {
+		return 1
+	}
+	return value
+}
+
+// tracker aggregates per-file byte progress into an overall percentage.
+// Files are registered as they arrive, so totals grow while resolve is running.
+type tracker struct {
+	mu      sync.Mutex
+	files   []*fileProgress
+	outputs []string
+	done    []bool
+	doneCnt int
+}
+
+func newTracker() *tracker {
+	return &tracker{}
+}
+
+func (t *tracker) add(output string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.files = append(t.files, &fileProgress{})
+	t.outputs = append(t.outputs, output)
+	t.done = append(t.done, false)
+	return len(t.files) - 1
+}
+
+func (t *tracker) file(index int) *fileProgress {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.files[index]
+}
+
+func (t *tracker) finish(index int, ok bool) (int, int, float64) {
+	t.mu.Lock()
+	if ok && !t.done[index] {
+		t.done[index] = true
+		t.doneCnt++
+	}
+	t.mu.Unlock()
+
+	doneFiles, totalFiles, percent, _ := t.snapshot()
+	return doneFiles, totalFiles, percent
+}
+
+func (t *tracker) snapshot() (int, int, float64, string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.files) == 0 {
+		return 0, 0, 0, ""
+	}
+
+	var sum float64
+	current := ""
+	for i, file := range t.files {
+		if t.done[i] {
+			sum++
+			continue
+		}
+		fraction := file.fraction()
+		if current == "" && fraction > 0 {
+			current = t.outputs[i]
+		}
+		sum += fraction
+	}
+	return t.doneCnt, len(t.files), sum * 100 / float64(len(t.files)), current
+}
@@ -0,0 +1,136 @@
+package pathpolicy
+
+import (
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Namer assigns unique local paths in the order names are seen.
+//
+// The first remote entry keeps its sanitized name and later entries that map
+// to the same local path get " (2)", " (3)" and so on before the extension.
+// Folders are renamed once and all their files follow the new folder path.
+// A Namer is not safe for concurrent use.
+type Namer struct {
+	sanitizer Sanitizer
+	// owners maps a local path key to the original path that claimed it.
+	owners map[string]string
+	// dirs maps an original folder path to its assigned local path.
+	dirs map[string]string
+	// added lists the owners and dirs keys in assignment order, for Rollback.
+	added []namerKey
+}
+
+type namerKey struct {
+	dir bool
+	key string
+}
+
+// NewNamer returns a Namer that sanitizes names with s.
+func NewNamer(s Sanitizer) *Namer {
+	return &Namer{
+		sanitizer: s,
+		owners:    make(map[string]string),
+		dirs:      make(map[string]string),
+	}
+}
+
+// Assign returns the local output for an original "/"-separated path.
+// Assigning the same path again returns the same output.
+func (n *Namer) Assign(original string) string {
+	return n.assign(original, false)
+}
+
+// AssignDir returns the local path for an original folder path; files of the
+// folder get outputs below it.
+func (n *Namer) AssignDir(original string) string {
+	return n.assign(original, true)
+}
+
+// Checkpoint marks the names assigned so far; see Rollback.
+func (n *Namer) Checkpoint() int {
+	return len(n.added)
+}
+
+// Rollback releases the names assigned after checkpoint, e.g. the files of a
+// link that failed to resolve, so later entries can take them.
+func (n *Namer) Rollback(checkpoint int) {
+	for _, added := range n.added[checkpoint:] {
+		if added.dir {
+			delete(n.dirs, added.key)
+		} else {
+			delete(n.owners, added.key)
+		}
+	}
+	n.added = n.added[:checkpoint]
+}
+
+func (n *Namer) assign(original string, dir bool) string {
+	parts := strings.Split(original, "/")
+
+	local, remote := "", ""
+	for index, part := range parts {
+		remote = join(remote, part)
+		isDir := dir || index < len(parts)-1
+		if isDir {
+			if assigned, ok := n.dirs[remote]; ok {
+				local = assigned
+				continue
+			}
+		}
+
+		name := part
+		if part != "" {
+			name = n.sanitizer.Component(part)
+		}
+		candidate := n.claim(join(local, name), remote)
+		if isDir {
+			n.dirs[remote] = candidate
+			n.added = append(n.added, namerKey{dir: true, key: remote})
+		}
+		local = candidate
+	}
+	return local
+}
+
+// claim returns a local path owned by remote, adding a suffix when another
+// remote entry already owns the candidate.
+func (n *Namer) claim(candidate string, remote string) string {
+	for attempt := 1; ; attempt++ {
+		name := candidate
+		if attempt > 1 {
+			name = withSuffix(candidate, attempt)
+		}
+		key := n.key(name)
+		owner, taken := n.owners[key]
+		if !taken {
+			n.owners[key] = remote
+			n.added = append(n.added, namerKey{key: key})
+			return name
+		}
+		if owner == remote {
+			return name
+		}
+	}
+}
+
+func (n *Namer) key(local string) string {
+	if n.sanitizer.CaseInsensitive() {
+		return strings.ToLower(local)
+	}
+	return local
+}
+
+func withSuffix(value string, attempt int) string {
+	dir, name := path.Split(value)
+	base, ext := splitExt(name)
+	return dir + base + " (" + strconv.Itoa(attempt) + ")" + ext
+}
+
+func join(parent string, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "/" + name
+}
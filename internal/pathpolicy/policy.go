@@ -0,0 +1,186 @@
+// Package pathpolicy maps remote Cloud.Mail names to safe local paths.
+package pathpolicy
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Policy selects which file systems local names must be valid on.
+type Policy string
+
+// Supported policies.
+const (
+	// Windows replaces characters and names that Windows rejects.
+	Windows Policy = "windows"
+	// POSIX replaces only NUL and limits components to 255 bytes.
+	POSIX Policy = "posix"
+	// Portable applies Windows rules, POSIX limits and Unicode NFC normalization.
+	Portable Policy = "portable"
+	// None keeps remote names unchanged.
+	None Policy = "none"
+)
+
+// DefaultSubstitute replaces forbidden characters.
+const DefaultSubstitute = "_"
+
+const maxComponent = 255
+
+// ParsePolicy parses a case-insensitive policy name.
+func ParsePolicy(value string) (Policy, error) {
+	switch policy := Policy(strings.ToLower(strings.TrimSpace(value))); policy {
+	case Windows, POSIX, Portable, None:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown path policy %q", value)
+	}
+}
+
+// Sanitizer rewrites path components according to a policy.
+type Sanitizer struct {
+	policy     Policy
+	substitute string
+}
+
+// NewSanitizer validates the substitute against the policy.
+func NewSanitizer(policy Policy, substitute string) (Sanitizer, error) {
+	if substitute == "" {
+		substitute = DefaultSubstitute
+	}
+	// Without a substitute forbidden characters are dropped, so any change means
+	// the substitute itself is not allowed by the policy.
+	probe := Sanitizer{policy: policy}
+	if policy != None && (strings.Contains(substitute, "/") || probe.Component(substitute) != substitute || isReserved(substitute)) {
+		return Sanitizer{}, fmt.Errorf("path substitute %q is not valid for %s policy", substitute, policy)
+	}
+	return Sanitizer{policy: policy, substitute: substitute}, nil
+}
+
+// CaseInsensitive reports whether names that differ only in case collide.
+func (s Sanitizer) CaseInsensitive() bool {
+	return s.policy == Windows || s.policy == Portable
+}
+
+// Component returns a safe version of one path component.
+func (s Sanitizer) Component(name string) string {
+	if s.policy == None {
+		return name
+	}
+	if name == "." || name == ".." {
+		// Never let a remote name point at the current or parent folder.
+		return strings.Repeat(s.substitute, len(name))
+	}
+
+	switch s.policy {
+	case POSIX:
+		name = strings.ReplaceAll(name, "\x00", s.substitute)
+		return truncate(name, utf8.RuneLen)
+	case Portable:
+		name = norm.NFC.String(name)
+	}
+
+	var b strings.Builder
+	b.Grow(len(name))
+	for _, r := range name {
+		if r < 32 || strings.ContainsRune(`<>:"|?*\`, r) {
+			b.WriteString(s.substitute)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	name = b.String()
+
+	// Windows strips trailing dots and spaces, which would merge "a." and "a".
+	if trimmed := strings.TrimRight(name, ". "); trimmed != name {
+		name = trimmed + strings.Repeat(s.substitute, len(name)-len(trimmed))
+	}
+	if isReserved(name) {
+		base, ext := splitExt(name)
+		name = base + s.substitute + ext
+	}
+	name = truncate(name, utf16Len)
+	if s.policy == Portable {
+		name = truncate(name, utf8.RuneLen)
+	}
+	return name
+}
+
+// Path sanitizes every "/"-separated component of a relative path.
+func (s Sanitizer) Path(value string) string {
+	parts := strings.Split(value, "/")
+	for i, part := range parts {
+		if part != "" {
+			parts[i] = s.Component(part)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// isReserved reports Windows device names, also with an extension such as "nul.txt".
+func isReserved(name string) bool {
+	base := name
+	if index := strings.IndexByte(name, '.'); index >= 0 {
+		base = name[:index]
+	}
+	return reservedNames[strings.ToUpper(strings.TrimRight(base, " "))]
+}
+
+func splitExt(name string) (string, string) {
+	ext := path.Ext(name)
+	if ext == name {
+		return name, ""
+	}
+	return strings.TrimSuffix(name, ext), ext
+}
+
+func utf16Len(r rune) int {
+	if n := utf16.RuneLen(r); n > 0 {
+		return n
+	}
+	return 1
+}
+
+// truncate shortens a component to maxComponent units, keeping a short extension.
+func truncate(name string, units func(rune) int) string {
+	total := 0
+	for _, r := range name {
+		total += units(r)
+	}
+	if total <= maxComponent {
+		return name
+	}
+
+	base, ext := splitExt(name)
+	extLen := 0
+	for _, r := range ext {
+		extLen += units(r)
+	}
+	if extLen > maxComponent/2 {
+		base, ext, extLen = name, "", 0
+	}
+
+	var b strings.Builder
+	used := extLen
+	for _, r := range base {
+		n := units(r)
+		if used+n > maxComponent {
+			break
+		}
+		b.WriteRune(r)
+		used += n
+	}
+	return b.String() + ext
+}
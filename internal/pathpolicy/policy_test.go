@@ -0,0 +1,181 @@
+package pathpolicy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestComponent(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+		input  string
+		want   string
+	}{
+		{name: "windows chars", policy: Windows, input: `folder<bad>|name:?.txt`, want: "folder_bad__name__.txt"},
+		{name: "windows control", policy: Windows, input: "a\tb", want: "a_b"},
+		{name: "windows backslash", policy: Windows, input: `a\b`, want: "a_b"},
+		{name: "windows trailing dot", policy: Windows, input: "notes.", want: "notes_"},
+		{name: "windows trailing space", policy: Windows, input: "notes  ", want: "notes__"},
+		{name: "windows reserved", policy: Windows, input: "CON", want: "CON_"},
+		{name: "windows reserved ext", policy: Windows, input: "nul.txt", want: "nul_.txt"},
+		{name: "windows not reserved", policy: Windows, input: "console.txt", want: "console.txt"},
+		{name: "posix keeps windows chars", policy: POSIX, input: `a:b?.txt`, want: `a:b?.txt`},
+		{name: "posix nul", policy: POSIX, input: "a\x00b", want: "a_b"},
+		{name: "portable nfc", policy: Portable, input: "cafe\u0301", want: "caf\u00e9"},
+		{name: "portable chars", policy: Portable, input: "a*b", want: "a_b"},
+		{name: "windows parent", policy: Windows, input: "..", want: "__"},
+		{name: "posix parent", policy: POSIX, input: "..", want: "__"},
+		{name: "posix current", policy: POSIX, input: ".", want: "_"},
+		{name: "none parent", policy: None, input: "..", want: ".."},
+		{name: "none", policy: None, input: `a<b>.`, want: `a<b>.`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sanitizer, err := NewSanitizer(tt.policy, "")
+			if err != nil {
+				t.Fatalf("new sanitizer: %v", err)
+			}
+			if got := sanitizer.Component(tt.input); got != tt.want {
+				t.Fatalf("component mismatch: got=%q want=%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComponentTruncatesKeepingExtension(t *testing.T) {
+	sanitizer, _ := NewSanitizer(Portable, "")
+	got := sanitizer.Component(strings.Repeat("я", 200) + ".mkv")
+	if len(got) > maxComponent || !strings.HasSuffix(got, ".mkv") {
+		t.Fatalf("unexpected truncation: len=%d name=%q", len(got), got)
+	}
+
+	sanitizer, _ = NewSanitizer(Windows, "")
+	got = sanitizer.Component(strings.Repeat("я", 300))
+	if len([]rune(got)) != maxComponent {
+		t.Fatalf("unexpected windows truncation: got=%d runes want=%d", len([]rune(got)), maxComponent)
+	}
+}
+
+func TestSubstitute(t *testing.T) {
+	sanitizer, err := NewSanitizer(Windows, "-")
+	if err != nil {
+		t.Fatalf("new sanitizer: %v", err)
+	}
+	if got := sanitizer.Component("a:b"); got != "a-b" {
+		t.Fatalf("substitute mismatch: got=%q want=%q", got, "a-b")
+	}
+
+	for _, substitute := range []string{"?", "/", "a."} {
+		if _, err := NewSanitizer(Windows, substitute); err == nil {
+			t.Fatalf("expected error for substitute %q", substitute)
+		}
+	}
+	if _, err := NewSanitizer(POSIX, "?"); err != nil {
+		t.Fatalf("posix should accept %q: %v", "?", err)
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	if got, err := ParsePolicy(" Portable "); err != nil || got != Portable {
+		t.Fatalf("parse mismatch: got=%q err=%v", got, err)
+	}
+	if _, err := ParsePolicy("fat32"); err == nil {
+		t.Fatalf("expected error for unknown policy")
+	}
+}
+
+func TestNamerCollisions(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+		inputs []string
+		want   []string
+	}{
+		{
+			name:   "sanitized names collide",
+			policy: Windows,
+			inputs: []string{"share/a?.txt", "share/a*.txt", "share/a_.txt"},
+			want:   []string{"share/a_.txt", "share/a_ (2).txt", "share/a_ (3).txt"},
+		},
+		{
+			name:   "case collisions",
+			policy: Windows,
+			inputs: []string{"share/Readme.md", "share/README.md"},
+			want:   []string{"share/Readme.md", "share/README (2).md"},
+		},
+		{
+			name:   "posix is case sensitive",
+			policy: POSIX,
+			inputs: []string{"share/Readme.md", "share/README.md"},
+			want:   []string{"share/Readme.md", "share/README.md"},
+		},
+		{
+			name:   "folders are renamed once",
+			policy: Windows,
+			inputs: []string{"share/s:1/a.txt", "share/s?1/a.txt", "share/s:1/b.txt"},
+			want:   []string{"share/s_1/a.txt", "share/s_1 (2)/a.txt", "share/s_1/b.txt"},
+		},
+		{
+			name:   "folders assigned before their files",
+			policy: Windows,
+			inputs: []string{"share/s:1/", "share/s?1/", "share/s?1/a.txt", "share/s:1/b.txt"},
+			want:   []string{"share/s_1", "share/s_1 (2)", "share/s_1 (2)/a.txt", "share/s_1/b.txt"},
+		},
+		{
+			name:   "same remote path is stable",
+			policy: Windows,
+			inputs: []string{"share/a?.txt", "share/a?.txt"},
+			want:   []string{"share/a_.txt", "share/a_.txt"},
+		},
+		{
+			name:   "suffix skips taken names",
+			policy: Windows,
+			inputs: []string{"a (2).txt", "a?", "a:", "a.txt", "A.txt"},
+			want:   []string{"a (2).txt", "a_", "a_ (2)", "a.txt", "A (3).txt"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sanitizer, err := NewSanitizer(tt.policy, "")
+			if err != nil {
+				t.Fatalf("new sanitizer: %v", err)
+			}
+			namer := NewNamer(sanitizer)
+			for index, input := range tt.inputs {
+				// A trailing "/" marks a folder.
+				assign := namer.Assign
+				if strings.HasSuffix(input, "/") {
+					assign, input = namer.AssignDir, strings.TrimSuffix(input, "/")
+				}
+				if got := assign(input); got != tt.want[index] {
+					t.Fatalf("assign %q mismatch: got=%q want=%q", input, got, tt.want[index])
+				}
+			}
+		})
+	}
+}
+
+func TestNamerRollback(t *testing.T) {
+	sanitizer, err := NewSanitizer(Windows, "")
+	if err != nil {
+		t.Fatalf("new sanitizer: %v", err)
+	}
+	namer := NewNamer(sanitizer)
+	namer.Assign("share/keep.txt")
+	checkpoint := namer.Checkpoint()
+	namer.AssignDir("share/s:1")
+	namer.Assign("share/s:1/a?.txt")
+	namer.Rollback(checkpoint)
+
+	for input, want := range map[string]string{
+		"share/s?1/a:.txt": "share/s_1/a_.txt",
+		"share/keep.txt":   "share/keep.txt",
+	} {
+		if got := namer.Assign(input); got != want {
+			t.Fatalf("assign %q after rollback: got=%q want=%q", input, got, want)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+// Package proxypool rotates requests over a list of proxies, evicting the ones that fail.
+package proxypool
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Selection strategies.
+const (
+	// RoundRobin uses healthy proxies in turn.
+	RoundRobin = "round-robin"
+	// LeastFailures prefers the healthy proxy with the fewest failures so far.
+	LeastFailures = "least-failures"
+)
+
+const (
+	// DefaultMaxFailures is the number of failures in a row that evicts a proxy.
+	DefaultMaxFailures = 3
+	// DefaultCooldown is how long an evicted proxy is skipped.
+	DefaultCooldown = time.Minute
+)
+
+// Config configures a Pool.
+type Config struct {
+	// Proxies are host:port values or http, https, socks5 and socks5h URLs.
+	Proxies []string
+	// Auth is user:pass applied to proxies without credentials in the URL.
+	Auth string
+	// Strategy is RoundRobin (default) or LeastFailures.
+	Strategy string
+	// MaxFailures evicts a proxy after that many failures in a row.
+	MaxFailures int
+	// Cooldown is how long an evicted proxy is skipped before it is tried again.
+	Cooldown time.Duration
+}
+
+// Proxy is one pool entry.
+type Proxy struct {
+	URL *url.URL
+
+	failures     int
+	total        int
+	evictedUntil time.Time
+}
+
+// Pool selects proxies for requests and tracks their health. It is safe for concurrent use.
+type Pool struct {
+	mu          sync.Mutex
+	proxies     []*Proxy
+	strategy    string
+	maxFailures int
+	cooldown    time.Duration
+	next        int
+}
+
+// New parses cfg.Proxies into a pool; duplicates are dropped.
+func New(cfg Config) (*Pool, error) {
+	strategy := strings.ToLower(strings.TrimSpace(cfg.Strategy))
+	switch strategy {
+	case "":
+		strategy = RoundRobin
+	case RoundRobin, LeastFailures:
+	default:
+		return nil, fmt.Errorf("unknown proxy strategy %q", cfg.Strategy)
+	}
+
+	pool := &Pool{
+		strategy:    strategy,
+		maxFailures: cfg.MaxFailures,
+		cooldown:    cfg.Cooldown,
+	}
+	if pool.maxFailures <= 0 {
+		pool.maxFailures = DefaultMaxFailures
+	}
+	if pool.cooldown <= 0 {
+		pool.cooldown = DefaultCooldown
+	}
+
+	seen := make(map[string]bool)
+	for _, value := range cfg.Proxies {
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		proxyURL, err := ParseURL(value, cfg.Auth)
+		if err != nil {
+			return nil, fmt.Errorf("proxy %q: %w", value, err)
+		}
+		if seen[proxyURL.String()] {
+			continue
+		}
+		seen[proxyURL.String()] = true
+		pool.proxies = append(pool.proxies, &Proxy{URL: proxyURL})
+	}
+	if len(pool.proxies) == 0 {
+		return nil, errors.New("proxy list is empty")
+	}
+	return pool, nil
+}
+
+// ParseURL builds a proxy URL from host:port or a URL and optional user:pass auth.
+// Values without a scheme are HTTP proxies; credentials in the URL take precedence over auth.
+func ParseURL(value string, auth string) (*url.URL, error) {
+	value = strings.TrimSpace(value)
+	if !strings.Contains(value, "://") {
+		value = "http://" + value
+	}
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return nil, err
+	}
+	switch parsed.Scheme = strings.ToLower(parsed.Scheme); parsed.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", parsed.Scheme)
+	}
+	if parsed.Host == "" {
+		return nil, errors.New("proxy host is empty")
+	}
+	if auth = strings.TrimSpace(auth); auth != "" && parsed.User == nil {
+		if user, password, ok := strings.Cut(auth, ":"); ok {
+			parsed.User = url.UserPassword(user, password)
+		} else {
+			parsed.User = url.User(user)
+		}
+	}
+	return parsed, nil
+}
+
+// ReadFile reads proxies from a file, one per line, skipping blank and # comment lines.
+func ReadFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var proxies []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		proxies = append(proxies, line)
+	}
+	return proxies, scanner.Err()
+}
+
+// Len returns the number of proxies in the pool.
+func (p *Pool) Len() int {
+	return len(p.proxies)
+}
+
+// Has reports whether the pool contains a proxy accepted by accept.
+func (p *Pool) Has(accept func(*url.URL) bool) bool {
+	return slices.ContainsFunc(p.proxies, func(proxy *Proxy) bool { return accept(proxy.URL) })
+}
+
+// Next returns the proxy for the next request.
+func (p *Pool) Next() *Proxy {
+	return p.NextWhere(nil)
+}
+
+// NextWhere returns the next proxy accepted by accept, or nil when none is.
+// When every accepted proxy is evicted, the one that recovers first is returned.
+func (p *Pool) NextWhere(accept func(*url.URL) bool) *Proxy {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	var best, fallback *Proxy
+	bestIndex := 0
+	for offset := range p.proxies {
+		index := (p.next + offset) % len(p.proxies)
+		proxy := p.proxies[index]
+		if accept != nil && !accept(proxy.URL) {
+			continue
+		}
+		if now.Before(proxy.evictedUntil) {
+			if fallback == nil || proxy.evictedUntil.Before(fallback.evictedUntil) {
+				fallback = proxy
+			}
+			continue
+		}
+		if best == nil || (p.strategy == LeastFailures && proxy.total < best.total) {
+			best, bestIndex = proxy, index
+			if p.strategy == RoundRobin {
+				break
+			}
+		}
+	}
+	if best == nil {
+		return fallback
+	}
+	p.next = bestIndex + 1
+	return best
+}
+
+// Success records a working request through proxy.
+func (p *Pool) Success(proxy *Proxy) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	proxy.failures = 0
+	proxy.evictedUntil = time.Time{}
+}
+
+// Failure records a failed request through proxy and evicts it after MaxFailures in a row.
+func (p *Pool) Failure(proxy *Proxy) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	proxy.failures++
+	proxy.total++
+	if proxy.failures >= p.maxFailures {
+		proxy.evictedUntil = time.Now().Add(p.cooldown)
+	}
+}
+
+// Healthy returns the number of proxies that are not evicted.
+func (p *Pool) Healthy() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	healthy := 0
+	now := time.Now()
+	for _, proxy := range p.proxies {
+		if !now.Before(proxy.evictedUntil) {
+			healthy++
+		}
+	}
+	return healthy
+}
+
+type proxyKey struct{}
+
+// Transport returns a round tripper that sends every request through the next
+// proxy of the pool and records transport failures. base is modified and must
+// not be used elsewhere.
+func (p *Pool) Transport(base *http.Transport) http.RoundTripper {
+	base.Proxy = func(req *http.Request) (*url.URL, error) {
+		if proxy, ok := req.Context().Value(proxyKey{}).(*Proxy); ok {
+			return proxy.URL, nil
+		}
+		return nil, nil
+	}
+	return &transport{pool: p, base: base}
+}
+
+type transport struct {
+	pool *Pool
+	base *http.Transport
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	proxy := t.pool.Next()
+	resp, err := t.base.RoundTrip(req.WithContext(context.WithValue(req.Context(), proxyKey{}, proxy)))
+	switch {
+	case err != nil && req.Context().Err() == nil:
+		t.pool.Failure(proxy)
+	case err == nil && resp.StatusCode == http.StatusProxyAuthRequired:
+		t.pool.Failure(proxy)
+	case err == nil:
+		t.pool.Success(proxy)
+	}
+	return resp, err
+}
+
+// Check requests target through every proxy and evicts the ones that fail,
+// or returns recovered ones to the rotation.
+func (p *Pool) Check(ctx context.Context, target string, timeout time.Duration) {
+	var wg sync.WaitGroup
+	for _, proxy := range p.proxies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := probe(ctx, proxy.URL, target, timeout)
+			if ctx.Err() != nil {
+				return
+			}
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			if err != nil {
+				proxy.failures = max(proxy.failures, p.maxFailures)
+				proxy.total++
+				proxy.evictedUntil = time.Now().Add(p.cooldown)
+				return
+			}
+			proxy.failures = 0
+			proxy.evictedUntil = time.Time{}
+		}()
+	}
+	wg.Wait()
+}
+
+// Watch runs Check every interval until ctx is done.
+func (p *Pool) Watch(ctx context.Context, target string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		p.Check(ctx, target, interval)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func probe(ctx context.Context, proxyURL *url.URL, target string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	transport, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return errors.New("unexpected default transport type")
+	}
+	cloned := transport.Clone()
+	cloned.Proxy = http.ProxyURL(proxyURL)
+	defer cloned.CloseIdleConnections()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, target, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := cloned.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusProxyAuthRequired {
+		return fmt.Errorf("proxy %s: %s", proxyURL.Redacted(), resp.Status)
+	}
+	return nil
+}
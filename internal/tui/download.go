@@ -21,6 +21,7 @@ type model struct {
 	bar       progress.Model
 	updates   <-chan cmrd.ProgressEvent
 	phase     string
+	label     string
 	message   string
 	percent   float64
 	total     int
@@ -72,6 +73,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case progressMsg:
 		event := typed.Event
 		m.phase = event.Phase
+		m.label = event.Label
 		m.message = event.Message
 		m.total = event.TotalFiles
 		m.doneFiles = event.DoneFiles
@@ -99,6 +101,9 @@ func (m model) View() string {
 	title := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("45")).Render("CMRD TUI Downloader")
 	hint := lipgloss.NewStyle().Foreground(lipgloss.Color("241")).Render("Keys: h/? help, q/Ctrl+C quit")
 	phase := fmt.Sprintf("Phase: %s", strings.ToUpper(m.phase))
+	if m.label != "" {
+		phase += fmt.Sprintf(" [%s]", m.label)
+	}
 	total := fmt.Sprintf("Resolved files: %d", m.total)
 	downloaded := fmt.Sprintf("Downloaded files: %d", m.doneFiles)
 	remaining := fmt.Sprintf("Remaining files: %d", m.remaining)
@@ -138,13 +143,17 @@ func (m model) View() string {
 }
 
 // RunDownload starts download and renders progress in Bubble Tea UI.
-func RunDownload(ctx context.Context, client *cmrd.Client, links []string) error {
+// observe, when set, receives every event before it is rendered.
+func RunDownload(ctx context.Context, client *cmrd.Client, entries []cmrd.LinkEntry, observe cmrd.ProgressHandler) error {
 	updates := make(chan cmrd.ProgressEvent, 64)
 	errCh := make(chan error, 1)
 
 	go func() {
 		defer close(updates)
-		err := client.Download(ctx, links, func(event cmrd.ProgressEvent) {
+		err := client.DownloadEntries(ctx, entries, func(event cmrd.ProgressEvent) {
+			if observe != nil {
+				observe(event)
+			}
 			select {
 			case updates <- event:
 			case <-ctx.Done():
@@ -0,0 +1,326 @@
+// Package yadisk resolves Yandex.Disk public links through the public
+// resources API of Yandex.Disk.
+package yadisk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jhonroun/cmrd/internal/cloudmail"
+)
+
+const (
+	defaultAPIBaseURL = "https://cloud-api.yandex.net/v1/disk"
+	defaultPageSize   = 200
+)
+
+// ErrNotPublic is returned for links that are not Yandex.Disk public links.
+var ErrNotPublic = errors.New("not a Yandex.Disk public link")
+
+// File describes one file of a public resource.
+type File struct {
+	URL        string
+	Output     string
+	RemotePath string
+	Size       int64
+	ModTime    time.Time
+}
+
+// Dir describes one folder of a public resource.
+type Dir struct {
+	Output     string
+	RemotePath string
+	// Empty reports that the folder has no entries on the remote side.
+	Empty bool
+}
+
+// Config configures the client.
+type Config struct {
+	HTTPClient *http.Client
+	UserAgent  string
+	// APIBaseURL overrides the Yandex.Disk API endpoint, e.g. for a fake server in tests.
+	APIBaseURL string
+	// PageSize is the number of entries requested per folder page.
+	PageSize int
+	// Keep selects entries by their path relative to the resolved folder;
+	// nil keeps everything. Folders it rejects are not listed.
+	Keep func(rel string, size int64, dir bool) bool
+}
+
+// Client lists Yandex.Disk public resources.
+type Client struct {
+	client    *http.Client
+	apiBase   string
+	userAgent string
+	pageSize  int
+	keep      func(rel string, size int64, dir bool) bool
+}
+
+// New creates a client.
+func New(cfg Config) *Client {
+	client := cfg.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	userAgent := strings.TrimSpace(cfg.UserAgent)
+	if userAgent == "" {
+		userAgent = "cmrd/0.1"
+	}
+	apiBase := strings.TrimRight(strings.TrimSpace(cfg.APIBaseURL), "/")
+	if apiBase == "" {
+		apiBase = defaultAPIBaseURL
+	}
+	pageSize := cfg.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	keep := cfg.Keep
+	if keep == nil {
+		keep = func(string, int64, bool) bool { return true }
+	}
+	return &Client{
+		client:    client,
+		apiBase:   apiBase,
+		userAgent: userAgent,
+		pageSize:  pageSize,
+		keep:      keep,
+	}
+}
+
+// Match reports whether link is a Yandex.Disk public link, such as
+// https://disk.yandex.ru/d/<id> or https://yadi.sk/i/<id>.
+func Match(link string) bool {
+	_, _, err := splitLink(link)
+	return err == nil
+}
+
+// splitLink returns the public key of a link and the path inside the public
+// resource that follows it, "" for the resource itself.
+func splitLink(link string) (key string, inner string, err error) {
+	parsed, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return "", "", err
+	}
+	host := strings.ToLower(parsed.Hostname())
+	if parsed.Scheme != "https" && parsed.Scheme != "http" ||
+		host != "yadi.sk" && !strings.HasPrefix(host, "disk.yandex.") {
+		return "", "", fmt.Errorf("%w: %q", ErrNotPublic, link)
+	}
+	kind, rest, _ := strings.Cut(strings.Trim(parsed.Path, "/"), "/")
+	id, inner, _ := strings.Cut(rest, "/")
+	if kind != "d" && kind != "i" || id == "" {
+		return "", "", fmt.Errorf("%w: %q", ErrNotPublic, link)
+	}
+	return "https://" + host + "/" + kind + "/" + id, strings.Trim(inner, "/"), nil
+}
+
+// remotePath joins the public key and the path inside the resource,
+// e.g. https://yadi.sk/d/AbCd/docs/a.txt; Refresh splits it again.
+func remotePath(key string, inner string) string {
+	if inner = strings.Trim(inner, "/"); inner == "" {
+		return key
+	}
+	return key + "/" + inner
+}
+
+// splitRemotePath is the inverse of remotePath.
+func splitRemotePath(remote string) (key string, inner string, err error) {
+	scheme, rest, ok := strings.Cut(remote, "://")
+	parts := strings.SplitN(rest, "/", 4)
+	if !ok || len(parts) < 3 {
+		return "", "", fmt.Errorf("invalid Yandex.Disk remote path %q", remote)
+	}
+	key = scheme + "://" + strings.Join(parts[:3], "/")
+	if len(parts) == 4 {
+		inner = parts[3]
+	}
+	return key, inner, nil
+}
+
+type resource struct {
+	Name     string    `json:"name"`
+	Type     string    `json:"type"`
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	// File is the download URL of a file.
+	File     string `json:"file"`
+	Embedded *struct {
+		Items []resource `json:"items"`
+		Total int        `json:"total"`
+	} `json:"_embedded"`
+}
+
+// empty reports whether a loaded folder has no items.
+func (r resource) empty() bool {
+	return r.Embedded == nil || r.Embedded.Total == 0 && len(r.Embedded.Items) == 0
+}
+
+// Walk lists a public link. Files are reported to file and, when dir is not
+// nil, every folder before its contents. Outputs start with the name of the
+// linked folder; a linked file is reported with its name as output.
+// Walk stops without error when a callback returns false.
+func (c *Client) Walk(ctx context.Context, link string, file func(File) bool, dir func(Dir) bool) error {
+	key, inner, err := splitLink(link)
+	if err != nil {
+		return err
+	}
+	root, err := c.resource(ctx, key, inner, 0)
+	if err != nil {
+		return err
+	}
+	if root.Type != "dir" {
+		if !c.keep(root.Name, root.Size, false) {
+			return nil
+		}
+		file(File{
+			URL:        root.File,
+			Output:     root.Name,
+			RemotePath: remotePath(key, inner),
+			Size:       root.Size,
+			ModTime:    root.Modified.UTC(),
+		})
+		return nil
+	}
+	if dir != nil && !dir(Dir{Output: root.Name, RemotePath: remotePath(key, inner), Empty: root.empty()}) {
+		return nil
+	}
+	_, err = c.walk(ctx, key, root, root.Path, root.Name, file, dir)
+	return err
+}
+
+// walk reports the contents of folder, whose first page is already loaded.
+// It returns false when a callback stopped the walk.
+func (c *Client) walk(ctx context.Context, key string, folder resource, rootPath string, rootName string, file func(File) bool, dir func(Dir) bool) (bool, error) {
+	for offset := 0; ; {
+		if folder.Embedded == nil {
+			return true, nil
+		}
+		items := folder.Embedded.Items
+		for _, item := range items {
+			rel := relative(rootPath, item.Path)
+			output := rootName + "/" + rel
+			inner := relative("/", item.Path)
+			if item.Type == "dir" {
+				if !c.keep(rel, 0, true) {
+					continue
+				}
+				sub, err := c.resource(ctx, key, inner, 0)
+				if err != nil {
+					return false, err
+				}
+				if dir != nil && !dir(Dir{Output: output, RemotePath: remotePath(key, inner), Empty: sub.empty()}) {
+					return false, nil
+				}
+				if more, err := c.walk(ctx, key, sub, rootPath, rootName, file, dir); !more || err != nil {
+					return more, err
+				}
+				continue
+			}
+			if !c.keep(rel, item.Size, false) {
+				continue
+			}
+			if !file(File{
+				URL:        item.File,
+				Output:     output,
+				RemotePath: remotePath(key, inner),
+				Size:       item.Size,
+				ModTime:    item.Modified.UTC(),
+			}) {
+				return false, nil
+			}
+		}
+		offset += len(items)
+		if len(items) == 0 || offset >= folder.Embedded.Total {
+			return true, nil
+		}
+		next, err := c.resource(ctx, key, relative("/", folder.Path), offset)
+		if err != nil {
+			return false, err
+		}
+		folder = next
+	}
+}
+
+// relative returns the path of item below root, both as returned by the API.
+func relative(root string, item string) string {
+	root = strings.Trim(root, "/")
+	item = strings.Trim(item, "/")
+	if root == "" {
+		return item
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(item, root), "/")
+}
+
+// Refresh returns fresh download URLs for files listed earlier, in order.
+func (c *Client) Refresh(ctx context.Context, remotePaths []string) ([]string, error) {
+	urls := make([]string, 0, len(remotePaths))
+	for _, remote := range remotePaths {
+		key, inner, err := splitRemotePath(remote)
+		if err != nil {
+			return nil, err
+		}
+		query := url.Values{"public_key": {key}}
+		if inner != "" {
+			query.Set("path", "/"+inner)
+		}
+		var body struct {
+			Href string `json:"href"`
+		}
+		if err := c.get(ctx, "/public/resources/download", query, &body); err != nil {
+			return nil, fmt.Errorf("refresh %q: %w", remote, err)
+		}
+		if body.Href == "" {
+			return nil, fmt.Errorf("refresh %q: no download URL", remote)
+		}
+		urls = append(urls, body.Href)
+	}
+	return urls, nil
+}
+
+func (c *Client) resource(ctx context.Context, key string, inner string, offset int) (resource, error) {
+	query := url.Values{
+		"public_key": {key},
+		"limit":      {fmt.Sprint(c.pageSize)},
+		"offset":     {fmt.Sprint(offset)},
+	}
+	if inner != "" {
+		query.Set("path", "/"+inner)
+	}
+	var body resource
+	err := c.get(ctx, "/public/resources", query, &body)
+	return body, err
+}
+
+func (c *Client) get(ctx context.Context, endpoint string, query url.Values, target any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.apiBase+endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return cloudmail.NewHTTPError(resp)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, target); err != nil {
+		return fmt.Errorf("decode %s: %w", endpoint, err)
+	}
+	return nil
+}
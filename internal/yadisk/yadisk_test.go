@@ -0,0 +1,153 @@
+package yadisk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jhonroun/cmrd/internal/cloudmail"
+)
+
+// fakeAPI serves the public resources of one share keyed by path.
+func fakeAPI(t *testing.T, key string, items map[string][]resource) (*httptest.Server, *[]string) {
+	t.Helper()
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		requests = append(requests, r.URL.Path+" "+query.Get("path")+" "+query.Get("offset"))
+		if query.Get("public_key") != key {
+			http.Error(w, `{"error":"DiskNotFoundError"}`, http.StatusNotFound)
+			return
+		}
+		folder := query.Get("path")
+		if folder == "" {
+			folder = "/"
+		}
+		if r.URL.Path == "/public/resources/download" {
+			_ = json.NewEncoder(w).Encode(map[string]string{"href": "https://downloader.example/fresh" + folder})
+			return
+		}
+		children, ok := items[folder]
+		if !ok {
+			for _, list := range items {
+				for _, item := range list {
+					if item.Path == folder {
+						_ = json.NewEncoder(w).Encode(item)
+						return
+					}
+				}
+			}
+			http.Error(w, `{"error":"DiskNotFoundError"}`, http.StatusNotFound)
+			return
+		}
+		offset, _ := strconv.Atoi(query.Get("offset"))
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		page := children[min(offset, len(children)):min(offset+limit, len(children))]
+		name := strings.TrimPrefix(folder[strings.LastIndex(folder, "/"):], "/")
+		if folder == "/" {
+			name = "Share"
+		}
+		body := resource{Name: name, Type: "dir", Path: folder}
+		body.Embedded = &struct {
+			Items []resource `json:"items"`
+			Total int        `json:"total"`
+		}{Items: page, Total: len(children)}
+		_ = json.NewEncoder(w).Encode(body)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestWalk(t *testing.T) {
+	key := "https://disk.yandex.ru/d/AbCd"
+	server, requests := fakeAPI(t, key, map[string][]resource{
+		"/": {
+			{Name: "docs", Type: "dir", Path: "/docs"},
+			{Name: "a.txt", Type: "file", Path: "/a.txt", Size: 1, File: "https://downloader.example/a"},
+			{Name: "b.tmp", Type: "file", Path: "/b.tmp", Size: 2, File: "https://downloader.example/b"},
+		},
+		"/docs": {
+			{Name: "c.txt", Type: "file", Path: "/docs/c.txt", Size: 3, File: "https://downloader.example/c"},
+		},
+	})
+	client := New(Config{
+		APIBaseURL: server.URL,
+		PageSize:   2,
+		Keep:       func(rel string, size int64, dir bool) bool { return !strings.HasSuffix(rel, ".tmp") },
+	})
+
+	var files, dirs []string
+	err := client.Walk(context.Background(), key+"?utm=1", func(file File) bool {
+		files = append(files, file.Output+" "+file.RemotePath+" "+file.URL)
+		return true
+	}, func(dir Dir) bool {
+		dirs = append(dirs, dir.Output+" "+dir.RemotePath)
+		return true
+	})
+	if err != nil {
+		t.Fatalf("walk: %v", err)
+	}
+	wantFiles := []string{
+		"Share/docs/c.txt https://disk.yandex.ru/d/AbCd/docs/c.txt https://downloader.example/c",
+		"Share/a.txt https://disk.yandex.ru/d/AbCd/a.txt https://downloader.example/a",
+	}
+	if !slices.Equal(files, wantFiles) {
+		t.Fatalf("files mismatch: got=%q want=%q", files, wantFiles)
+	}
+	wantDirs := []string{"Share https://disk.yandex.ru/d/AbCd", "Share/docs https://disk.yandex.ru/d/AbCd/docs"}
+	if !slices.Equal(dirs, wantDirs) {
+		t.Fatalf("dirs mismatch: got=%q want=%q", dirs, wantDirs)
+	}
+	wantRequests := []string{"/public/resources  0", "/public/resources /docs 0", "/public/resources  2"}
+	if !slices.Equal(*requests, wantRequests) {
+		t.Fatalf("requests mismatch: got=%q want=%q", *requests, wantRequests)
+	}
+
+	urls, err := client.Refresh(context.Background(), []string{"https://disk.yandex.ru/d/AbCd/docs/c.txt"})
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if want := []string{"https://downloader.example/fresh/docs/c.txt"}; !slices.Equal(urls, want) {
+		t.Fatalf("refresh mismatch: got=%q want=%q", urls, want)
+	}
+
+	err = client.Walk(context.Background(), "https://yadi.sk/d/Missing", func(File) bool { return true }, nil)
+	if !errors.Is(err, cloudmail.ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestSplitLink(t *testing.T) {
+	tests := []struct {
+		link  string
+		key   string
+		inner string
+		ok    bool
+	}{
+		{link: "https://disk.yandex.ru/d/AbCd", key: "https://disk.yandex.ru/d/AbCd", ok: true},
+		{link: "https://yadi.sk/i/XyZ", key: "https://yadi.sk/i/XyZ", ok: true},
+		{link: "http://disk.yandex.com/d/AbCd/sub/dir/", key: "https://disk.yandex.com/d/AbCd", inner: "sub/dir", ok: true},
+		{link: "https://disk.yandex.ru/client/disk", ok: false},
+		{link: "https://cloud.mail.ru/public/AbCd/EfGh", ok: false},
+		{link: "https://yadi.sk/d/", ok: false},
+	}
+	for _, test := range tests {
+		key, inner, err := splitLink(test.link)
+		if (err == nil) != test.ok || key != test.key || inner != test.inner {
+			t.Fatalf("split %q: got=%q,%q,%v want=%q,%q,%v", test.link, key, inner, err, test.key, test.inner, test.ok)
+		}
+		if !test.ok {
+			continue
+		}
+		gotKey, gotInner, err := splitRemotePath(remotePath(key, inner))
+		if err != nil || gotKey != key || gotInner != inner {
+			t.Fatalf("remote path round trip of %q: got=%q,%q,%v", test.link, gotKey, gotInner, err)
+		}
+	}
+}
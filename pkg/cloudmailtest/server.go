@@ -0,0 +1,596 @@
+// Package cloudmailtest provides a fake Cloud.Mail public API for offline tests.
+//
+// The server serves public share pages, the dispatcher and paginated folder
+// API, file bodies with Range support and ZIP archives of folders. Point cmrd.Config.APIBaseURL at
+// Server.APIBaseURL and use links returned by Server.Link.
+//
+// It also stands in for a logged-in account: folders set with SetHome are
+// listed and downloaded only with the cookies of Server.Cookies, and their
+// links are returned by Server.HomeLink.
+package cloudmailtest
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jhonroun/cmrd/internal/cloudmail"
+)
+
+// Routes served by the fake server, used by Fault and Requests.
+const (
+	RoutePage       = "page"
+	RouteDispatcher = "dispatcher"
+	RouteFolder     = "folder"
+	RouteFile       = "file"
+	// RouteZip is the zip/weblink API call, RouteArchive the archive it points to.
+	RouteZip     = "zip"
+	RouteArchive = "archive"
+	// RouteToken is the session token request of account API calls.
+	RouteToken = "token"
+)
+
+const (
+	pageID = "cloudmailtest-page"
+	// The session cookie and the token it is exchanged for.
+	sessionCookie = "sdcs"
+	sessionValue  = "cloudmailtest-session"
+	sessionToken  = "cloudmailtest-token"
+)
+
+// errTokenBody is the answer of the API to a stale session token.
+const errTokenBody = `{"status":403,"body":"token"}`
+
+// File is a fake file with its content.
+type File struct {
+	Name    string
+	Content []byte
+	ModTime time.Time
+}
+
+// Folder is a fake folder tree.
+type Folder struct {
+	Name    string
+	Folders []Folder
+	Files   []File
+}
+
+// Fault makes matching requests fail with Status.
+type Fault struct {
+	// Route is one of the Route constants.
+	Route string
+	// Weblink limits the fault to one weblink or account path; empty matches all.
+	Weblink string
+	// Shard limits a RouteFile fault to one download host, numbered from 1; zero matches all.
+	Shard int
+	// Status is the HTTP status to return, e.g. 404, 500 or 429.
+	Status int
+	// RetryAfter is sent as the Retry-After header when positive.
+	RetryAfter time.Duration
+	// Times is the number of requests to fail; zero or less fails forever.
+	Times int
+	// Body replaces the status text in the response, e.g. a captcha page served with status 200.
+	Body string
+}
+
+type faultState struct {
+	Fault
+	remaining int
+}
+
+// Server is a fake Cloud.Mail API served over httptest.
+type Server struct {
+	server *httptest.Server
+
+	mu          sync.Mutex
+	shares      map[string]Folder
+	home        *Folder
+	faults      []*faultState
+	requests    map[string]int
+	maxPageSize int
+	shards      int
+	// tokens counts RotateToken calls; the current token ends with it.
+	tokens int
+}
+
+// NewServer starts a fake server that is closed when the test ends.
+func NewServer(tb testing.TB) *Server {
+	tb.Helper()
+	s := &Server{
+		shares:   make(map[string]Folder),
+		requests: make(map[string]int),
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	tb.Cleanup(s.server.Close)
+	return s
+}
+
+// URL returns the server root URL.
+func (s *Server) URL() string {
+	return s.server.URL
+}
+
+// APIBaseURL returns the value for cmrd.Config.APIBaseURL.
+func (s *Server) APIBaseURL() string {
+	return s.server.URL + "/api/v2"
+}
+
+// Client returns an HTTP client that talks to the server.
+func (s *Server) Client() *http.Client {
+	return s.server.Client()
+}
+
+// AddShare registers a public share with a two-segment id such as "AbCd/EfGh"
+// and returns its public link.
+func (s *Server) AddShare(id string, root Folder) string {
+	id = strings.Trim(id, "/")
+	if root.Name == "" {
+		root.Name = id[strings.LastIndex(id, "/")+1:]
+	}
+	s.mu.Lock()
+	s.shares[id] = root
+	s.mu.Unlock()
+	return s.Link(id)
+}
+
+// Link returns the public link of a weblink path, e.g. a subfolder or a file of a share.
+func (s *Server) Link(weblink string) string {
+	parts := strings.Split(strings.Trim(weblink, "/"), "/")
+	return s.server.URL + "/public/" + (&url.URL{Path: strings.Join(parts, "/")}).EscapedPath()
+}
+
+// SetHome sets the folders of the logged-in account.
+func (s *Server) SetHome(root Folder) {
+	s.mu.Lock()
+	s.home = &root
+	s.mu.Unlock()
+}
+
+// HomeLink returns the private link of an account path, e.g. "Photos/2024"; "" is the account root.
+func (s *Server) HomeLink(path string) string {
+	return s.server.URL + "/home/" + (&url.URL{Path: strings.Trim(path, "/")}).EscapedPath()
+}
+
+// Cookies returns a cookies.txt file with the session cookie of the account,
+// for cmrd.ParseSession.
+func (s *Server) Cookies() string {
+	host := strings.TrimPrefix(s.server.URL, "http://")
+	host, _, _ = strings.Cut(host, ":")
+	return fmt.Sprintf("# Netscape HTTP Cookie File\n%s\tFALSE\t/\tFALSE\t0\t%s\t%s\n", host, sessionCookie, sessionValue)
+}
+
+// RotateToken replaces the session token, as Cloud.Mail does from time to
+// time; requests with the old token are rejected with 403 until the client
+// asks for a new one.
+func (s *Server) RotateToken() {
+	s.mu.Lock()
+	s.tokens++
+	s.mu.Unlock()
+}
+
+// SetMaxPageSize caps the number of folder entries returned per page.
+func (s *Server) SetMaxPageSize(size int) {
+	s.mu.Lock()
+	s.maxPageSize = size
+	s.mu.Unlock()
+}
+
+// SetShards makes the dispatcher return n download hosts instead of one.
+// Hosts are served by the same server under different path prefixes.
+func (s *Server) SetShards(n int) {
+	s.mu.Lock()
+	s.shards = n
+	s.mu.Unlock()
+}
+
+// AddFault injects a failure for matching requests.
+func (s *Server) AddFault(fault Fault) {
+	s.mu.Lock()
+	s.faults = append(s.faults, &faultState{Fault: fault, remaining: fault.Times})
+	s.mu.Unlock()
+}
+
+// Requests returns the number of requests served for a route, including failed ones.
+func (s *Server) Requests(route string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[route]
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	route, weblink, shard := s.route(r)
+	if route == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if s.fail(w, route, weblink, shard) {
+		return
+	}
+	home := isHomeRequest(r)
+	if (home || route == RouteToken) && !authorized(r) {
+		http.Error(w, "session required", http.StatusUnauthorized)
+		return
+	}
+	if token := r.URL.Query().Get("token"); token != "" && token != s.token() {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, errTokenBody)
+		return
+	}
+
+	switch route {
+	case RoutePage:
+		s.servePage(w, r, weblink)
+	case RouteDispatcher:
+		s.serveDispatcher(w, r, home)
+	case RouteFolder:
+		s.serveFolder(w, r, weblink, home)
+	case RouteFile:
+		s.serveFile(w, r, weblink, home)
+	case RouteToken:
+		writeJSON(w, map[string]any{"body": map[string]string{"token": s.token()}})
+	case RouteZip:
+		s.serveZip(w, r)
+	case RouteArchive:
+		s.serveArchive(w, r, weblink)
+	}
+}
+
+// route returns the route, the weblink path and, for files, the shard number.
+func (s *Server) route(r *http.Request) (string, string, int) {
+	path := r.URL.Path
+	switch {
+	case strings.HasPrefix(path, "/public/"):
+		return RoutePage, strings.Trim(strings.TrimPrefix(path, "/public/"), "/"), 0
+	case path == "/api/v2/dispatcher":
+		return RouteDispatcher, "", 0
+	case path == "/api/v2/folder":
+		if r.URL.Query().Has("home") {
+			return RouteFolder, strings.Trim(r.URL.Query().Get("home"), "/"), 0
+		}
+		return RouteFolder, strings.Trim(r.URL.Query().Get("weblink"), "/"), 0
+	case path == "/api/v2/tokens/csrf":
+		return RouteToken, "", 0
+	case path == "/api/v2/zip/weblink":
+		return RouteZip, zipWeblink(r), 0
+	case strings.HasPrefix(path, "/zip/"):
+		return RouteArchive, strings.Trim(strings.TrimPrefix(path, "/zip/"), "/"), 0
+	case strings.HasPrefix(path, "/get/"), strings.HasPrefix(path, "/attach/"):
+		_, rest, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+		return RouteFile, strings.Trim(rest, "/"), 1
+	case strings.HasPrefix(path, "/s"):
+		// Extra shards are served as /s<n>/get/... and /s<n>/attach/...
+		prefix, rest, ok := strings.Cut(strings.TrimPrefix(path, "/s"), "/get/")
+		if !ok {
+			prefix, rest, ok = strings.Cut(strings.TrimPrefix(path, "/s"), "/attach/")
+		}
+		if shard, err := strconv.Atoi(prefix); ok && err == nil && shard > 1 {
+			return RouteFile, strings.Trim(rest, "/"), shard
+		}
+	}
+	return "", "", 0
+}
+
+// isHomeRequest reports whether a request addresses the account rather than a public share.
+func isHomeRequest(r *http.Request) bool {
+	query := r.URL.Query()
+	return query.Has("home") || query.Has("token") || strings.Contains(r.URL.Path, "/attach/")
+}
+
+func authorized(r *http.Request) bool {
+	cookie, err := r.Cookie(sessionCookie)
+	return err == nil && cookie.Value == sessionValue
+}
+
+// token returns the current session token.
+func (s *Server) token() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tokens == 0 {
+		return sessionToken
+	}
+	return fmt.Sprintf("%s-%d", sessionToken, s.tokens)
+}
+
+// shardURL returns a download host; account files are served under /attach.
+func (s *Server) shardURL(shard int, home bool) string {
+	base := "/get"
+	if home {
+		base = "/attach"
+	}
+	if shard <= 1 {
+		return s.server.URL + base
+	}
+	return fmt.Sprintf("%s/s%d%s", s.server.URL, shard, base)
+}
+
+// fail counts the request and writes an injected failure when one matches.
+func (s *Server) fail(w http.ResponseWriter, route string, weblink string, shard int) bool {
+	s.mu.Lock()
+	s.requests[route]++
+	var matched *faultState
+	for _, fault := range s.faults {
+		if fault.Route != route || (fault.Weblink != "" && strings.Trim(fault.Weblink, "/") != weblink) {
+			continue
+		}
+		if fault.Shard != 0 && fault.Shard != shard {
+			continue
+		}
+		if fault.Times > 0 {
+			if fault.remaining == 0 {
+				continue
+			}
+			fault.remaining--
+		}
+		matched = fault
+		break
+	}
+	s.mu.Unlock()
+
+	if matched == nil {
+		return false
+	}
+	if matched.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(matched.RetryAfter.Round(time.Second)/time.Second)))
+	}
+	body := matched.Body
+	if body == "" {
+		body = http.StatusText(matched.Status)
+	}
+	http.Error(w, body, matched.Status)
+	return true
+}
+
+func (s *Server) servePage(w http.ResponseWriter, r *http.Request, weblink string) {
+	if _, _, ok := s.lookup(weblink); !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<html><script>window.cloudSettings = {\"params\": {\"pageId\": %q}};</script></html>", pageID)
+}
+
+func (s *Server) serveDispatcher(w http.ResponseWriter, r *http.Request, home bool) {
+	if !home && r.URL.Query().Get("x-page-id") != pageID {
+		http.Error(w, "bad page id", http.StatusForbidden)
+		return
+	}
+	s.mu.Lock()
+	shards := max(s.shards, 1)
+	s.mu.Unlock()
+	hosts := make([]map[string]string, 0, shards)
+	for shard := 1; shard <= shards; shard++ {
+		hosts = append(hosts, map[string]string{"url": s.shardURL(shard, home)})
+	}
+	key := "weblink_get"
+	if home {
+		key = "get"
+	}
+	writeJSON(w, map[string]any{
+		"body": map[string]any{
+			key: hosts,
+		},
+	})
+}
+
+type apiItem struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Size  int64  `json:"size,omitempty"`
+	Hash  string `json:"hash,omitempty"`
+	MTime int64  `json:"mtime,omitempty"`
+}
+
+func (s *Server) serveFolder(w http.ResponseWriter, r *http.Request, weblink string, home bool) {
+	folder, file, ok := s.find(weblink, home)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if file != nil {
+		writeJSON(w, map[string]any{"body": fileItem(*file)})
+		return
+	}
+
+	entries := make([]apiItem, 0, len(folder.Folders)+len(folder.Files))
+	for _, child := range folder.Folders {
+		entries = append(entries, apiItem{Type: "folder", Name: child.Name})
+	}
+	for _, child := range folder.Files {
+		entries = append(entries, fileItem(child))
+	}
+
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = len(entries)
+	}
+	s.mu.Lock()
+	if s.maxPageSize > 0 && limit > s.maxPageSize {
+		limit = s.maxPageSize
+	}
+	s.mu.Unlock()
+	offset = min(max(offset, 0), len(entries))
+	end := min(offset+limit, len(entries))
+
+	writeJSON(w, map[string]any{
+		"body": map[string]any{
+			"type": "folder",
+			"name": folder.Name,
+			"count": map[string]int{
+				"folders": len(folder.Folders),
+				"files":   len(folder.Files),
+			},
+			"list": entries[offset:end],
+		},
+	})
+}
+
+func (s *Server) serveFile(w http.ResponseWriter, r *http.Request, weblink string, home bool) {
+	_, file, ok := s.find(weblink, home)
+	if !ok || file == nil {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeContent(w, r, file.Name, file.ModTime, bytes.NewReader(file.Content))
+}
+
+// zipWeblink returns the first weblink of a zip/weblink request.
+func zipWeblink(r *http.Request) string {
+	var weblinks []string
+	if err := json.Unmarshal([]byte(r.PostFormValue("weblink_list")), &weblinks); err != nil || len(weblinks) == 0 {
+		return ""
+	}
+	return strings.Trim(weblinks[0], "/")
+}
+
+func (s *Server) serveZip(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.PostFormValue("x-page-id") != pageID {
+		http.Error(w, "bad zip request", http.StatusBadRequest)
+		return
+	}
+	weblink := zipWeblink(r)
+	if _, file, ok := s.lookup(weblink); !ok || file != nil {
+		http.NotFound(w, r)
+		return
+	}
+	archive := &url.URL{Path: "/zip/" + weblink}
+	writeJSON(w, map[string]any{"body": s.server.URL + archive.EscapedPath()})
+}
+
+// serveArchive packs a folder into a ZIP archive with the folder as its top-level entry.
+func (s *Server) serveArchive(w http.ResponseWriter, r *http.Request, weblink string) {
+	folder, file, ok := s.lookup(weblink)
+	if !ok || file != nil {
+		http.NotFound(w, r)
+		return
+	}
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	if err := addFolder(archive, "", folder); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := archive.Close(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	http.ServeContent(w, r, folder.Name+".zip", time.Time{}, bytes.NewReader(buf.Bytes()))
+}
+
+func addFolder(archive *zip.Writer, parent string, folder Folder) error {
+	prefix := parent + folder.Name + "/"
+	if _, err := archive.Create(prefix); err != nil {
+		return err
+	}
+	for _, child := range folder.Folders {
+		if err := addFolder(archive, prefix, child); err != nil {
+			return err
+		}
+	}
+	for _, file := range folder.Files {
+		header := &zip.FileHeader{Name: prefix + file.Name, Method: zip.Deflate, Modified: file.ModTime}
+		writer, err := archive.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if _, err := writer.Write(file.Content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) find(weblink string, home bool) (Folder, *File, bool) {
+	if home {
+		return s.lookupHome(weblink)
+	}
+	return s.lookup(weblink)
+}
+
+// lookup finds the folder or file addressed by a weblink path.
+func (s *Server) lookup(weblink string) (Folder, *File, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	parts := strings.Split(strings.Trim(weblink, "/"), "/")
+	if len(parts) < 2 {
+		return Folder{}, nil, false
+	}
+	folder, ok := s.shares[parts[0]+"/"+parts[1]]
+	if !ok {
+		return Folder{}, nil, false
+	}
+	return descend(folder, parts[2:])
+}
+
+// lookupHome finds the folder or file addressed by an account path.
+func (s *Server) lookupHome(path string) (Folder, *File, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.home == nil {
+		return Folder{}, nil, false
+	}
+	var parts []string
+	if path = strings.Trim(path, "/"); path != "" {
+		parts = strings.Split(path, "/")
+	}
+	return descend(*s.home, parts)
+}
+
+// descend follows names from folder down to a subfolder or, for the last name, a file.
+func descend(folder Folder, parts []string) (Folder, *File, bool) {
+	for index, name := range parts {
+		last := index == len(parts)-1
+		found := false
+		for _, child := range folder.Folders {
+			if child.Name == name {
+				folder, found = child, true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		if last {
+			for _, child := range folder.Files {
+				if child.Name == name {
+					file := child
+					return Folder{}, &file, true
+				}
+			}
+		}
+		return Folder{}, nil, false
+	}
+	return folder, nil, true
+}
+
+func fileItem(file File) apiItem {
+	hash, _ := cloudmail.HashReader(bytes.NewReader(file.Content))
+	item := apiItem{
+		Type: "file",
+		Name: file.Name,
+		Size: int64(len(file.Content)),
+		Hash: hash,
+	}
+	if !file.ModTime.IsZero() {
+		item.MTime = file.ModTime.Unix()
+	}
+	return item
+}
+
+func writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,42 @@
+package cloudmailtest
+
+import (
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestServerRangeAndFaults(t *testing.T) {
+	server := NewServer(t)
+	server.AddShare("AbCd/EfGh", Folder{Files: []File{{Name: "a.txt", Content: []byte("0123456789")}}})
+	server.AddFault(Fault{Route: RouteFile, Status: http.StatusServiceUnavailable, RetryAfter: 2 * time.Second, Times: 1})
+
+	request, err := http.NewRequest(http.MethodGet, server.URL()+"/get/AbCd/EfGh/a.txt", nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	request.Header.Set("Range", "bytes=2-5")
+
+	response, err := server.Client().Do(request)
+	if err != nil {
+		t.Fatalf("first request: %v", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusServiceUnavailable || response.Header.Get("Retry-After") != "2" {
+		t.Fatalf("unexpected fault response: %d retry-after=%q", response.StatusCode, response.Header.Get("Retry-After"))
+	}
+
+	response, err = server.Client().Do(request)
+	if err != nil {
+		t.Fatalf("second request: %v", err)
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	if response.StatusCode != http.StatusPartialContent || string(body) != "2345" {
+		t.Fatalf("unexpected range response: %d %q", response.StatusCode, body)
+	}
+	if server.Requests(RouteFile) != 2 {
+		t.Fatalf("unexpected request count: %d", server.Requests(RouteFile))
+	}
+}
@@ -0,0 +1,249 @@
+package cmrd
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/jhonroun/cmrd/internal/cloudmail"
+	"github.com/jhonroun/cmrd/internal/pathpolicy"
+)
+
+// ResolveArchive asks Cloud.Mail to pack a folder link into one ZIP archive
+// and returns it as a download target named after the folder, e.g. "share.zip".
+func (c *Client) ResolveArchive(ctx context.Context, link string) (FileTask, error) {
+	_, task, err := c.resolveArchive(ctx, c.newNamer(), link)
+	return task, err
+}
+
+func (c *Client) resolveArchive(ctx context.Context, namer *pathpolicy.Namer, link string) (cloudmail.Archive, FileTask, error) {
+	if provider := c.provider(link); provider.Name() != ProviderCloudMail {
+		return cloudmail.Archive{}, FileTask{}, fmt.Errorf("%s links cannot be downloaded as archives", provider.Name())
+	}
+	archive, err := c.resolver.ResolveArchive(ctx, link)
+	if err != nil {
+		return cloudmail.Archive{}, FileTask{}, err
+	}
+	task := FileTask{
+		URL:        archive.URL,
+		Output:     namer.Assign(archive.Name + ".zip"),
+		RemotePath: archive.RemotePath,
+		Label:      c.label,
+	}
+	if err := CheckOutput(task); err != nil {
+		return cloudmail.Archive{}, FileTask{}, err
+	}
+	return archive, task, nil
+}
+
+// downloadArchives downloads every link as one ZIP archive, see Config.Archive.
+func (c *Client) downloadArchives(ctx context.Context, links []string, onProgress ProgressHandler) error {
+	namer := c.newNamer()
+	var (
+		archives []cloudmail.Archive
+		tasks    []FileTask
+		failed   []LinkError
+	)
+	resolveCtx := withResolveEvents(ctx, onProgress)
+	for _, raw := range links {
+		link := strings.TrimSpace(raw)
+		if link == "" {
+			continue
+		}
+		archive, task, err := c.resolveArchive(resolveCtx, namer, link)
+		if err != nil {
+			if c.cfg.ContinueOnError && ctx.Err() == nil {
+				failed = append(failed, LinkError{Link: link, Err: err})
+				reportLinkError(onProgress, link, err)
+				continue
+			}
+			return fmt.Errorf("resolve %q: %w", link, err)
+		}
+		archives = append(archives, archive)
+		tasks = append(tasks, task)
+	}
+
+	var partialErr error
+	if len(failed) > 0 {
+		partialErr = &ResolveError{Links: failed}
+	}
+	if len(tasks) == 0 {
+		if partialErr != nil {
+			return partialErr
+		}
+		return errors.New("empty file list")
+	}
+
+	progress := onProgress
+	if onProgress != nil {
+		onProgress(ProgressEvent{
+			Phase:          "download",
+			Message:        fmt.Sprintf("downloading %d folder archives (%s backend)", len(tasks), c.cfg.Backend),
+			TotalFiles:     len(tasks),
+			RemainingFiles: len(tasks),
+			CurrentFile:    currentFileForIndex(tasks, 0),
+		})
+		if c.cfg.ExtractArchive {
+			// The job is not done until the archives are extracted.
+			progress = func(event ProgressEvent) {
+				if event.Err == nil {
+					event.Done = false
+				}
+				onProgress(event)
+			}
+		}
+	}
+	if err := c.backend.Download(ctx, tasks, progress); err != nil {
+		return joinErrors(err, partialErr)
+	}
+
+	if c.cfg.ExtractArchive {
+		for index, task := range tasks {
+			if onProgress != nil {
+				onProgress(ProgressEvent{
+					Phase:          "extract",
+					Percent:        float64(index) * 100 / float64(len(tasks)),
+					Message:        fmt.Sprintf("extracting %s", task.Output),
+					TotalFiles:     len(tasks),
+					DoneFiles:      index,
+					RemainingFiles: len(tasks) - index,
+					CurrentFile:    task.Output,
+				})
+			}
+			if err := c.extractArchive(namer, archives[index], task); err != nil {
+				return joinErrors(fmt.Errorf("extract %s: %w", task.Output, err), partialErr)
+			}
+		}
+	}
+
+	if onProgress != nil {
+		onProgress(ProgressEvent{
+			Phase:      "download",
+			Percent:    100,
+			Message:    "download completed",
+			TotalFiles: len(tasks),
+			DoneFiles:  len(tasks),
+			Done:       true,
+		})
+	}
+	return partialErr
+}
+
+// extractArchive unpacks a downloaded folder archive into the download
+// directory with the layout of a per-file download of the same folder, and
+// removes the archive. Config.Filter is applied to the archive entries.
+func (c *Client) extractArchive(namer *pathpolicy.Namer, archive cloudmail.Archive, task FileTask) error {
+	archivePath := filepath.Join(c.cfg.DownloadDir, filepath.FromSlash(task.Output))
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return err
+	}
+
+	err = c.extractEntries(namer, archive, reader.File)
+	if closeErr := reader.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Remove(archivePath)
+}
+
+func (c *Client) extractEntries(namer *pathpolicy.Namer, archive cloudmail.Archive, entries []*zip.File) error {
+	if err := c.makeDir(namer, archive.Name, archive.RemotePath); err != nil {
+		return err
+	}
+
+	// Archives usually hold the folder itself as the only top-level entry.
+	root := archive.Name
+	for _, entry := range entries {
+		name := archiveEntryName(entry)
+		if name != root && !strings.HasPrefix(name, root+"/") {
+			root = ""
+			break
+		}
+	}
+
+	for _, entry := range entries {
+		rel := archiveEntryName(entry)
+		if root != "" {
+			rel = strings.TrimPrefix(strings.TrimPrefix(rel, root), "/")
+		}
+		if rel == "" {
+			continue
+		}
+		if rel == ".." || strings.HasPrefix(rel, "../") {
+			return &UnsafePathError{RemotePath: archive.RemotePath, Output: entry.Name}
+		}
+
+		isDir := entry.FileInfo().IsDir()
+		size := int64(entry.UncompressedSize64)
+		if !c.resolver.Keep(rel, size, isDir) {
+			continue
+		}
+		output := archive.Name + "/" + rel
+		remotePath := archive.RemotePath + "/" + rel
+		if isDir {
+			if err := c.makeDir(namer, output, remotePath); err != nil {
+				return err
+			}
+			continue
+		}
+
+		file, err := c.localFile(namer, FileTask{Output: output, RemotePath: remotePath, Size: size})
+		if err != nil {
+			return err
+		}
+		if err := c.extractFile(entry, file.Output); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// archiveEntryName returns the cleaned slash-separated name of an archive entry.
+func archiveEntryName(entry *zip.File) string {
+	name := strings.Trim(strings.ReplaceAll(entry.Name, `\`, "/"), "/")
+	if name == "" {
+		return ""
+	}
+	return path.Clean(name)
+}
+
+// makeDir creates a folder with the local path per-file downloads would use.
+func (c *Client) makeDir(namer *pathpolicy.Namer, output string, remotePath string) error {
+	local := namer.AssignDir(output)
+	if err := CheckOutput(FileTask{Output: local, RemotePath: remotePath}); err != nil {
+		return err
+	}
+	return os.MkdirAll(filepath.Join(c.cfg.DownloadDir, filepath.FromSlash(local)), 0o755)
+}
+
+func (c *Client) extractFile(entry *zip.File, output string) error {
+	target := filepath.Join(c.cfg.DownloadDir, filepath.FromSlash(output))
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+
+	in, err := entry.Open()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return downloadError(err)
+	}
+	return downloadError(out.Close())
+}
@@ -0,0 +1,360 @@
+package cmrd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/jhonroun/cmrd/internal/aria2"
+	"github.com/jhonroun/cmrd/internal/cloudmail"
+	"github.com/jhonroun/cmrd/internal/httpdl"
+	"github.com/jhonroun/cmrd/internal/proxypool"
+)
+
+// downloadBackend downloads already resolved files and reports progress.
+type downloadBackend interface {
+	Download(ctx context.Context, files []FileTask, onProgress ProgressHandler) error
+}
+
+// streamingBackend is implemented by backends that accept files while resolve is running.
+type streamingBackend interface {
+	downloadBackend
+	DownloadStream(ctx context.Context, files <-chan FileTask, onProgress ProgressHandler) error
+}
+
+func newBackend(cfg Config, proxies *proxypool.Pool, session *cloudmail.Session) (string, downloadBackend, error) {
+	runner := aria2.NewRunner(cfg.Aria2Path)
+	runner.Concurrency = cfg.Concurrency
+	runner.Splits = cfg.Splits
+	runner.Retries = cfg.Retries
+
+	name := cfg.Backend
+	if name == BackendAuto {
+		name = BackendNative
+		// aria2c cannot use SOCKS proxies, so a pool without http proxies needs the native engine.
+		if runner.Available() && (proxies == nil || proxies.Has(aria2.SupportsProxy)) {
+			name = BackendAria2
+		}
+	}
+
+	switch name {
+	case BackendAria2:
+		return name, &aria2Backend{cfg: cfg, runner: runner, proxies: proxies, session: session}, nil
+	case BackendNative:
+		downloader, err := httpdl.NewDownloader(httpdl.Config{
+			Timeout:     cfg.HTTPTimeout,
+			Proxies:     proxies,
+			Concurrency: cfg.Concurrency,
+			Splits:      cfg.Splits,
+			Retries:     cfg.Retries,
+			RetryDelay:  cfg.RetryBaseDelay,
+			Session:     session,
+		})
+		if err != nil {
+			return "", nil, err
+		}
+		return name, &nativeBackend{dir: cfg.DownloadDir, downloader: downloader}, nil
+	default:
+		return "", nil, fmt.Errorf("unknown download backend %q", cfg.Backend)
+	}
+}
+
+func toInternalFiles(files []FileTask) []cloudmail.File {
+	internalFiles := make([]cloudmail.File, 0, len(files))
+	for _, file := range files {
+		internalFiles = append(internalFiles, cloudmail.File{
+			URL:        file.URL,
+			Output:     file.Output,
+			RemotePath: file.RemotePath,
+			Size:       file.Size,
+			Hash:       file.Hash,
+			ModTime:    file.ModTime,
+			Mirrors:    file.Mirrors,
+		})
+	}
+	return internalFiles
+}
+
+func fromInternalFile(file cloudmail.File) FileTask {
+	return FileTask{
+		URL:        file.URL,
+		Output:     file.Output,
+		RemotePath: file.RemotePath,
+		Size:       file.Size,
+		Hash:       file.Hash,
+		ModTime:    file.ModTime,
+		Mirrors:    file.Mirrors,
+	}
+}
+
+// aria2Backend runs the external aria2c binary.
+type aria2Backend struct {
+	cfg     Config
+	runner  *aria2.Runner
+	proxies *proxypool.Pool
+	session *cloudmail.Session
+}
+
+func (b *aria2Backend) Download(ctx context.Context, files []FileTask, onProgress ProgressHandler) error {
+	runner := b.runner
+	if b.session != nil {
+		cookieFile, err := writeCookieFile(b.session)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(cookieFile)
+		copied := *b.runner
+		copied.CookieFile = cookieFile
+		runner = &copied
+	}
+
+	// aria2c runs as one process, so the whole batch goes through one proxy.
+	var proxy *proxypool.Proxy
+	if b.proxies != nil {
+		if proxy = b.proxies.NextWhere(aria2.SupportsProxy); proxy == nil {
+			return errors.New("aria2c supports only http and https proxies, use the native backend for SOCKS5")
+		}
+	}
+
+	var err error
+	if !b.cfg.Aria2Console {
+		err = b.downloadRPC(ctx, runner, files, proxy, onProgress)
+		if errors.Is(err, aria2.ErrRPCUnavailable) {
+			if onProgress != nil {
+				onProgress(ProgressEvent{
+					Phase:          "download",
+					Message:        fmt.Sprintf("%v, falling back to console output", err),
+					TotalFiles:     len(files),
+					RemainingFiles: len(files),
+					CurrentFile:    currentFileForIndex(files, 0),
+				})
+			}
+			err = b.downloadConsole(ctx, runner, files, proxy, onProgress)
+		}
+	} else {
+		err = b.downloadConsole(ctx, runner, files, proxy, onProgress)
+	}
+	if proxy != nil {
+		if aria2.IsNetworkError(err) {
+			b.proxies.Failure(proxy)
+		} else if err == nil {
+			b.proxies.Success(proxy)
+		}
+	}
+	return aria2Error(err)
+}
+
+// downloadRPC drives aria2c over JSON-RPC and reports exact per-file progress.
+func (b *aria2Backend) downloadRPC(ctx context.Context, runner *aria2.Runner, files []FileTask, proxy *proxypool.Proxy, onProgress ProgressHandler) error {
+	return runner.RunRPC(ctx, toInternalFiles(files), b.cfg.DownloadDir, proxyURL(proxy), func(event aria2.ProgressEvent) {
+		if onProgress != nil {
+			onProgress(rpcProgress(event, files))
+		}
+	})
+}
+
+// downloadConsole runs aria2c on an input file and estimates progress from its console output.
+func (b *aria2Backend) downloadConsole(ctx context.Context, runner *aria2.Runner, files []FileTask, proxy *proxypool.Proxy, onProgress ProgressHandler) error {
+	temp, err := os.CreateTemp("", "cmrd-input-*.txt")
+	if err != nil {
+		return err
+	}
+	tempPath := temp.Name()
+	defer temp.Close()
+	if b.cfg.DeleteInputAfterDone {
+		defer os.Remove(tempPath)
+	}
+
+	if err := aria2.WriteInput(temp, toInternalFiles(files), b.cfg.DownloadDir); err != nil {
+		return fmt.Errorf("write aria2 input: %w", err)
+	}
+
+	if err := temp.Close(); err != nil {
+		return err
+	}
+
+	progress := newDownloadProgress(len(files))
+	return runner.Run(ctx, tempPath, proxyURL(proxy), func(event aria2.ProgressEvent) {
+		if onProgress == nil {
+			return
+		}
+		doneFiles, remainingFiles, currentFile := progress.update(event, files)
+		onProgress(ProgressEvent{
+			Phase:          event.Phase,
+			Percent:        event.Percent,
+			Message:        event.Message,
+			TotalFiles:     len(files),
+			DoneFiles:      doneFiles,
+			RemainingFiles: remainingFiles,
+			CurrentFile:    currentFile,
+			Done:           event.Done,
+			Err:            event.Err,
+		})
+	})
+}
+
+// rpcProgress maps an aria2 JSON-RPC event to a ProgressEvent with per-file state.
+func rpcProgress(event aria2.ProgressEvent, files []FileTask) ProgressEvent {
+	out := ProgressEvent{
+		Phase:          event.Phase,
+		Percent:        event.Percent,
+		Message:        event.Message,
+		TotalFiles:     len(files),
+		RemainingFiles: len(files),
+		CurrentFile:    currentFileForIndex(files, 0),
+		Done:           event.Done,
+		Err:            event.Err,
+	}
+	if event.Files == nil {
+		return out
+	}
+	out.Files = make([]FileProgress, len(event.Files))
+	out.CurrentFile = ""
+	for index, state := range event.Files {
+		file := FileProgress{
+			Output:     files[state.Index].Output,
+			State:      state.State,
+			Size:       state.TotalBytes,
+			Downloaded: state.DoneBytes,
+			Speed:      state.Speed,
+			Err:        state.Err,
+		}
+		switch file.State {
+		case FileStateComplete:
+			out.DoneFiles++
+			out.RemainingFiles--
+		case FileStateError:
+			out.RemainingFiles--
+			// Failures are listed once, on the final event.
+			if event.Done {
+				out.FileErrors = append(out.FileErrors, FileError{Output: file.Output, Err: file.Err})
+			}
+		case FileStateActive:
+			if out.CurrentFile == "" {
+				out.CurrentFile = file.Output
+			}
+		}
+		out.Speed += file.Speed
+		out.Files[index] = file
+	}
+	return out
+}
+
+// writeCookieFile writes the session to a private temporary cookies.txt file
+// for aria2c; the caller removes it.
+func writeCookieFile(session *cloudmail.Session) (string, error) {
+	temp, err := os.CreateTemp("", "cmrd-cookies-*.txt")
+	if err != nil {
+		return "", err
+	}
+	path := temp.Name()
+	// CreateTemp opens the file with mode 0600, so other users cannot read it.
+	err = session.WriteCookies(temp)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("write aria2 cookies: %w", err)
+	}
+	return path, nil
+}
+
+func proxyURL(proxy *proxypool.Proxy) *url.URL {
+	if proxy == nil {
+		return nil
+	}
+	return proxy.URL
+}
+
+// nativeBackend downloads files with the built-in HTTP engine.
+type nativeBackend struct {
+	dir        string
+	downloader *httpdl.Downloader
+}
+
+func (b *nativeBackend) Download(ctx context.Context, files []FileTask, onProgress ProgressHandler) error {
+	return downloadError(b.downloader.Download(ctx, toInternalFiles(files), b.dir, nativeProgress(onProgress)))
+}
+
+func (b *nativeBackend) DownloadStream(ctx context.Context, files <-chan FileTask, onProgress ProgressHandler) error {
+	source := make(chan cloudmail.File)
+	go func() {
+		defer close(source)
+		for file := range files {
+			select {
+			case source <- toInternalFiles([]FileTask{file})[0]:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return downloadError(b.downloader.DownloadStream(ctx, source, b.dir, nativeProgress(onProgress)))
+}
+
+func nativeProgress(onProgress ProgressHandler) func(httpdl.ProgressEvent) {
+	return func(event httpdl.ProgressEvent) {
+		if onProgress == nil {
+			return
+		}
+		onProgress(ProgressEvent{
+			Phase:          event.Phase,
+			Percent:        event.Percent,
+			Message:        event.Message,
+			TotalFiles:     event.TotalFiles,
+			DoneFiles:      event.DoneFiles,
+			RemainingFiles: event.TotalFiles - event.DoneFiles,
+			CurrentFile:    event.File,
+			Done:           event.Done,
+			Err:            event.Err,
+		})
+	}
+}
+
+type downloadProgress struct {
+	mu       sync.Mutex
+	total    int
+	doneSeen int
+}
+
+func newDownloadProgress(total int) *downloadProgress {
+	return &downloadProgress{total: total}
+}
+
+func (p *downloadProgress) update(event aria2.ProgressEvent, files []FileTask) (int, int, string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if strings.Contains(strings.ToLower(event.Message), "download complete:") && p.doneSeen < p.total {
+		p.doneSeen++
+	}
+
+	doneFiles := p.doneSeen
+	if event.Percent > 0 {
+		estimated := int(math.Floor(event.Percent * float64(p.total) / 100.0))
+		if estimated > doneFiles {
+			doneFiles = estimated
+		}
+	}
+	if event.Done {
+		doneFiles = p.total
+	}
+	if doneFiles < 0 {
+		doneFiles = 0
+	}
+	if doneFiles > p.total {
+		doneFiles = p.total
+	}
+
+	remainingFiles := p.total - doneFiles
+	if remainingFiles < 0 {
+		remainingFiles = 0
+	}
+
+	return doneFiles, remainingFiles, currentFileForIndex(files, doneFiles)
+}
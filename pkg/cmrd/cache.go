@@ -0,0 +1,58 @@
+package cmrd
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jhonroun/cmrd/internal/cloudmail"
+)
+
+// DefaultCacheTTL is the resolve cache lifetime used when Config.CacheTTL is not set.
+const DefaultCacheTTL = cloudmail.DefaultCacheTTL
+
+// CacheEntry describes one cached resolve result.
+type CacheEntry struct {
+	LinkID  string    `json:"link_id"`
+	Files   int       `json:"files"`
+	Size    int64     `json:"size"`
+	Created time.Time `json:"created"`
+	Expired bool      `json:"expired"`
+	Path    string    `json:"path"`
+}
+
+// DefaultCacheDir returns the per-user resolve cache directory,
+// or an empty string when the system has no cache directory.
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "cmrd", "resolve")
+}
+
+// ListCache returns entries of the resolve cache in dir; expiry is judged by ttl.
+func ListCache(dir string, ttl time.Duration) ([]CacheEntry, error) {
+	entries, err := cloudmail.NewCache(dir, ttl).List()
+	if err != nil {
+		return nil, err
+	}
+	converted := make([]CacheEntry, 0, len(entries))
+	for _, entry := range entries {
+		converted = append(converted, CacheEntry(entry))
+	}
+	return converted, nil
+}
+
+// ClearCache removes entries of the resolve cache in dir, only expired ones when
+// expiredOnly is set, and returns the number of removed entries.
+func ClearCache(dir string, ttl time.Duration, expiredOnly bool) (int, error) {
+	return cloudmail.NewCache(dir, ttl).Clear(expiredOnly)
+}
+
+func newCache(cfg Config) *cloudmail.Cache {
+	if cfg.CacheDir == "" {
+		return nil
+	}
+	return cloudmail.NewCache(cfg.CacheDir, cfg.CacheTTL)
+}
@@ -1,43 +1,87 @@
 package cmrd
 
 import (
-	"bufio"
 	"context"
 	"errors"
 	"fmt"
-	"math"
-	"os"
+	"iter"
 	"strings"
 	"sync"
+	"time"
 
-	"github.com/jhonroun/cmrd/internal/aria2"
 	"github.com/jhonroun/cmrd/internal/cloudmail"
+	"github.com/jhonroun/cmrd/internal/pathpolicy"
 )
 
 // Client provides library API for resolve/download workflows.
 type Client struct {
 	cfg      Config
 	resolver *cloudmail.Resolver
-	runner   *aria2.Runner
+	// providers are tried in order to find the provider of a link.
+	providers []Provider
+	backend   downloadBackend
+	paths     pathpolicy.Sanitizer
+	// label is set on files and progress events of clients made by ForLink.
+	label string
 }
 
 // New creates a new client.
 func New(cfg Config) (*Client, error) {
 	cfg = cfg.normalized()
 
+	paths, err := newSanitizer(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Clients derived with ForLink share the limiter and the proxy pool.
+	if cfg.RateLimiter == nil {
+		cfg.RateLimiter = NewRateLimiter(cfg.RateLimit, cfg.RateBurst)
+	}
+	if cfg.ProxyPool == nil {
+		if cfg.ProxyPool, err = NewProxyPool(cfg); err != nil {
+			return nil, err
+		}
+	}
+	proxies := cfg.ProxyPool.internal()
+
 	resolver, err := cloudmail.NewResolver(cloudmail.Config{
-		Timeout:   cfg.HTTPTimeout,
-		Proxy:     cfg.Proxy,
-		ProxyAuth: cfg.ProxyAuth,
+		Timeout:    cfg.HTTPTimeout,
+		Proxies:    proxies,
+		APIBaseURL: cfg.APIBaseURL,
+		HTTPClient: cfg.HTTPClient,
+		Workers:    cfg.ResolveWorkers,
+		Retry: cloudmail.RetryPolicy{
+			MaxAttempts: cfg.Retries + 1,
+			BaseDelay:   cfg.RetryBaseDelay,
+			MaxDelay:    cfg.RetryMaxDelay,
+		},
+		Filter:  cfg.Filter.internal(),
+		Cache:   newCache(cfg),
+		Limiter: cfg.RateLimiter.internal(),
+		Session: cfg.Session.internal(),
 	})
 	if err != nil {
 		return nil, err
 	}
 
+	providers, err := newProviders(cfg, resolver, proxies)
+	if err != nil {
+		return nil, err
+	}
+
+	backendName, backend, err := newBackend(cfg, proxies, cfg.Session.internal())
+	if err != nil {
+		return nil, err
+	}
+	cfg.Backend = backendName
+
 	return &Client{
-		cfg:      cfg,
-		resolver: resolver,
-		runner:   aria2.NewRunner(cfg.Aria2Path),
+		cfg:       cfg,
+		resolver:  resolver,
+		providers: providers,
+		backend:   backend,
+		paths:     paths,
 	}, nil
 }
 
@@ -46,103 +90,249 @@ func (c *Client) Config() Config {
 	return c.cfg
 }
 
-// ReadLinksFile reads links from text file, skipping blank and comment lines.
-func ReadLinksFile(path string) ([]string, error) {
-	file, err := os.Open(path)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
-	var links []string
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
+// Resolve resolves cloud links into a flat file list.
+func (c *Client) Resolve(ctx context.Context, links []string) ([]FileTask, error) {
+	result := make([]FileTask, 0)
+	for task, err := range c.ResolveStream(ctx, links) {
+		if err != nil {
+			return nil, err
 		}
-		links = append(links, line)
+		result = append(result, task)
 	}
-	if err := scanner.Err(); err != nil {
-		return nil, err
-	}
-	return links, nil
+	return result, nil
 }
 
-// Resolve resolves cloud links into a flat file list.
-func (c *Client) Resolve(ctx context.Context, links []string) ([]FileTask, error) {
-	files, err := c.resolver.Resolve(ctx, links)
-	if err != nil {
-		return nil, err
+// ResolveStream yields files as soon as they are discovered.
+// An error is yielded inline and ends the stream.
+func (c *Client) ResolveStream(ctx context.Context, links []string) iter.Seq2[FileTask, error] {
+	return func(yield func(FileTask, error) bool) {
+		namer := c.newNamer()
+		for _, raw := range links {
+			link := strings.TrimSpace(raw)
+			if link == "" {
+				continue
+			}
+			for file, err := range c.linkStream(ctx, link) {
+				var task FileTask
+				if err == nil {
+					task, err = c.localFile(namer, file)
+				} else {
+					err = fmt.Errorf("resolve %q: %w", link, err)
+				}
+				if err != nil {
+					yield(FileTask{}, err)
+					return
+				}
+				if !yield(task, nil) {
+					return
+				}
+			}
+		}
 	}
+}
 
-	result := make([]FileTask, 0, len(files))
-	for _, file := range files {
-		result = append(result, FileTask{
-			URL:    file.URL,
-			Output: file.Output,
-		})
+// ResolveAll resolves every link independently and returns one result per non-empty link.
+func (c *Client) ResolveAll(ctx context.Context, links []string) []LinkResult {
+	var results []LinkResult
+	namer := c.newNamer()
+	for _, raw := range links {
+		link := strings.TrimSpace(raw)
+		if link == "" {
+			continue
+		}
+		result := LinkResult{Link: link}
+		started := time.Now()
+		checkpoint := namer.Checkpoint()
+		for file, err := range c.linkStream(ctx, link) {
+			var task FileTask
+			if err == nil {
+				task, err = c.localFile(namer, file)
+			}
+			if err != nil {
+				// Reject the whole link, as a resolve failure would, and free
+				// its names for the links that follow.
+				result.Files, result.Err = nil, err
+				namer.Rollback(checkpoint)
+				break
+			}
+			result.Files = append(result.Files, task)
+		}
+		result.Duration = time.Since(started)
+		results = append(results, result)
 	}
-	return result, nil
+	return results
 }
 
-// Download resolves links and runs aria2c.
+// Download resolves links and downloads them with the configured backend.
+// Backends that accept files incrementally start downloading while resolve is still running.
+// With Config.ContinueOnError links that fail to resolve are skipped and reported
+// as *ResolveError once the rest of the batch is downloaded.
+// With Config.Archive every link is downloaded as one ZIP archive.
 func (c *Client) Download(ctx context.Context, links []string, onProgress ProgressHandler) error {
-	files, err := c.Resolve(ctx, links)
-	if err != nil {
-		return err
+	// Folder workers, the streaming resolve and the backend report from different goroutines.
+	onProgress = serialProgress(onProgress)
+	if c.cfg.Archive {
+		return c.downloadArchives(ctx, links, onProgress)
+	}
+	if backend, ok := c.backend.(streamingBackend); ok {
+		return c.downloadStream(ctx, backend, links, onProgress)
+	}
+
+	files, resolveErr := c.resolveBatch(withResolveEvents(ctx, onProgress), links, onProgress)
+	if resolveErr != nil && (!c.cfg.ContinueOnError || len(files) == 0) {
+		return resolveErr
 	}
 
 	if onProgress != nil {
 		onProgress(ProgressEvent{
 			Phase:          "resolve",
-			Message:        "resolve complete",
+			Message:        resolveCompleteMessage(files),
 			TotalFiles:     len(files),
 			DoneFiles:      0,
 			RemainingFiles: len(files),
 			CurrentFile:    currentFileForIndex(files, 0),
+			PathMappings:   PathMappings(files),
 		})
 	}
 
-	return c.DownloadResolved(ctx, files, onProgress)
+	if err := c.DownloadResolved(ctx, files, onProgress); err != nil {
+		return joinErrors(err, resolveErr)
+	}
+	return resolveErr
 }
 
-// DownloadResolved runs aria2c for already resolved files.
-func (c *Client) DownloadResolved(ctx context.Context, files []FileTask, onProgress ProgressHandler) error {
-	if len(files) == 0 {
-		return errors.New("empty file list")
+// resolveBatch resolves links for Download, skipping failed links when ContinueOnError is set.
+func (c *Client) resolveBatch(ctx context.Context, links []string, onProgress ProgressHandler) ([]FileTask, error) {
+	if !c.cfg.ContinueOnError {
+		return c.Resolve(ctx, links)
 	}
 
-	temp, err := os.CreateTemp("", "cmrd-input-*.txt")
-	if err != nil {
-		return err
+	results := c.ResolveAll(ctx, links)
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
-	tempPath := temp.Name()
-	defer temp.Close()
-	if c.cfg.DeleteInputAfterDone {
-		defer os.Remove(tempPath)
+	for _, result := range results {
+		if result.Err != nil {
+			reportLinkError(onProgress, result.Link, result.Err)
+		}
 	}
+	return SplitResults(results)
+}
 
-	internalFiles := make([]cloudmail.File, 0, len(files))
-	for _, file := range files {
-		internalFiles = append(internalFiles, cloudmail.File{
-			URL:    file.URL,
-			Output: file.Output,
+func (c *Client) downloadStream(ctx context.Context, backend streamingBackend, links []string, onProgress ProgressHandler) error {
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if onProgress != nil {
+		onProgress(ProgressEvent{
+			Phase:   "download",
+			Message: fmt.Sprintf("download started while resolving (%s backend)", c.cfg.Backend),
 		})
 	}
 
-	if err := aria2.WriteInput(temp, internalFiles, c.cfg.DownloadDir); err != nil {
-		return fmt.Errorf("write aria2 input: %w", err)
-	}
+	source := make(chan FileTask)
+	resolveDone := make(chan struct{})
+	var (
+		files      []FileTask
+		failed     []LinkError
+		resolveErr error
+	)
+	go func() {
+		defer close(resolveDone)
+		defer close(source)
+		resolveCtx := withResolveEvents(ctx, onProgress)
+		namer := c.newNamer()
+		for _, raw := range links {
+			link := strings.TrimSpace(raw)
+			if link == "" {
+				continue
+			}
+			for file, err := range c.linkStream(resolveCtx, link) {
+				var task FileTask
+				if err == nil {
+					task, err = c.localFile(namer, file)
+				}
+				if err != nil {
+					if c.cfg.ContinueOnError && ctx.Err() == nil {
+						failed = append(failed, LinkError{Link: link, Err: err})
+						reportLinkError(onProgress, link, err)
+						break
+					}
+					resolveErr = fmt.Errorf("resolve %q: %w", link, err)
+					cancel()
+					return
+				}
+				files = append(files, task)
+				select {
+				case source <- task:
+				case <-ctx.Done():
+					resolveErr = ctx.Err()
+					return
+				}
+			}
+		}
+		if onProgress != nil {
+			onProgress(ProgressEvent{
+				Phase:          "resolve",
+				Message:        resolveCompleteMessage(files),
+				TotalFiles:     len(files),
+				RemainingFiles: len(files),
+				PathMappings:   PathMappings(files),
+			})
+		}
+	}()
+
+	err := backend.DownloadStream(ctx, source, c.backendProgress(onProgress))
+	cancel()
+	<-resolveDone
 
-	if err := temp.Close(); err != nil {
+	if resolveErr != nil && !errors.Is(resolveErr, context.Canceled) {
+		return resolveErr
+	}
+	if resolveErr == nil {
+		// Resolve finished, so files is complete and can be restarted with fresh URLs.
+		err = c.refreshExpired(parent, files, err, onProgress)
+	}
+	if err != nil {
 		return err
 	}
+	if resolveErr != nil {
+		return resolveErr
+	}
+
+	var partialErr error
+	if len(failed) > 0 {
+		partialErr = &ResolveError{Links: failed}
+	}
+	if len(files) == 0 {
+		if partialErr != nil {
+			return partialErr
+		}
+		return errors.New("empty file list")
+	}
+	if err := c.finishDownload(parent, files, onProgress); err != nil {
+		return joinErrors(err, partialErr)
+	}
+	return partialErr
+}
+
+// DownloadResolved downloads already resolved files with the configured backend.
+func (c *Client) DownloadResolved(ctx context.Context, files []FileTask, onProgress ProgressHandler) error {
+	onProgress = serialProgress(onProgress)
+	if len(files) == 0 {
+		return errors.New("empty file list")
+	}
+	for _, file := range files {
+		if err := CheckOutput(file); err != nil {
+			return err
+		}
+	}
 
 	if onProgress != nil {
 		onProgress(ProgressEvent{
 			Phase:          "download",
-			Message:        "download started",
+			Message:        fmt.Sprintf("download started (%s backend)", c.cfg.Backend),
 			TotalFiles:     len(files),
 			DoneFiles:      0,
 			RemainingFiles: len(files),
@@ -150,27 +340,64 @@ func (c *Client) DownloadResolved(ctx context.Context, files []FileTask, onProgr
 		})
 	}
 
-	progress := newDownloadProgress(len(files))
-	err = c.runner.Run(ctx, tempPath, c.cfg.Proxy, c.cfg.ProxyAuth, func(event aria2.ProgressEvent) {
-		if onProgress == nil {
-			return
-		}
-		doneFiles, remainingFiles, currentFile := progress.update(event, files)
-		onProgress(ProgressEvent{
-			Phase:          event.Phase,
-			Percent:        event.Percent,
-			Message:        event.Message,
-			TotalFiles:     len(files),
-			DoneFiles:      doneFiles,
-			RemainingFiles: remainingFiles,
-			CurrentFile:    currentFile,
-			Done:           event.Done,
-			Err:            event.Err,
-		})
-	})
-	if err != nil {
+	err := c.backend.Download(ctx, files, c.backendProgress(onProgress))
+	if err := c.refreshExpired(ctx, files, err, onProgress); err != nil {
 		return err
 	}
+	return c.finishDownload(ctx, files, onProgress)
+}
+
+// serialProgress wraps onProgress so that it is never called concurrently.
+func serialProgress(onProgress ProgressHandler) ProgressHandler {
+	if onProgress == nil {
+		return nil
+	}
+	var mu sync.Mutex
+	return func(event ProgressEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		onProgress(event)
+	}
+}
+
+// backendProgress keeps the job open while verification or a URL refresh is
+// still pending; refreshExpired and finishDownload report the outcome.
+func (c *Client) backendProgress(onProgress ProgressHandler) ProgressHandler {
+	if onProgress == nil || (!c.cfg.VerifyHashes && c.cfg.URLRefreshes <= 0) {
+		return onProgress
+	}
+	return func(event ProgressEvent) {
+		if event.Err != nil && c.holdsExpired(event.Err) {
+			event.Err, event.Done = nil, false
+		}
+		if c.cfg.VerifyHashes && event.Err == nil {
+			event.Done = false
+		}
+		onProgress(event)
+	}
+}
+
+// finishDownload verifies downloaded files and reports completion.
+func (c *Client) finishDownload(ctx context.Context, files []FileTask, onProgress ProgressHandler) error {
+	if c.cfg.VerifyHashes {
+		if err := c.Verify(ctx, files, onProgress); err != nil {
+			var verifyErr *VerifyError
+			if onProgress != nil && errors.As(err, &verifyErr) {
+				onProgress(ProgressEvent{
+					Phase:          "verify",
+					Percent:        100,
+					Message:        fmt.Sprintf("verification failed for %d files", len(verifyErr.Files)),
+					TotalFiles:     len(files),
+					DoneFiles:      len(files) - len(verifyErr.Files),
+					RemainingFiles: len(verifyErr.Files),
+					Done:           true,
+					Err:            err,
+					FileErrors:     verifyErr.Files,
+				})
+			}
+			return err
+		}
+	}
 
 	if onProgress != nil {
 		onProgress(ProgressEvent{
@@ -186,47 +413,51 @@ func (c *Client) DownloadResolved(ctx context.Context, files []FileTask, onProgr
 	return nil
 }
 
-type downloadProgress struct {
-	mu       sync.Mutex
-	total    int
-	doneSeen int
-}
-
-func newDownloadProgress(total int) *downloadProgress {
-	return &downloadProgress{total: total}
-}
-
-func (p *downloadProgress) update(event aria2.ProgressEvent, files []FileTask) (int, int, string) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-
-	if strings.Contains(strings.ToLower(event.Message), "download complete:") && p.doneSeen < p.total {
-		p.doneSeen++
-	}
-
-	doneFiles := p.doneSeen
-	if event.Percent > 0 {
-		estimated := int(math.Floor(event.Percent * float64(p.total) / 100.0))
-		if estimated > doneFiles {
-			doneFiles = estimated
+// resolveCompleteMessage mentions files renamed by the path policy.
+func resolveCompleteMessage(files []FileTask) string {
+	renamed := 0
+	for _, file := range files {
+		if file.OriginalOutput != "" {
+			renamed++
 		}
 	}
-	if event.Done {
-		doneFiles = p.total
-	}
-	if doneFiles < 0 {
-		doneFiles = 0
+	if renamed == 0 {
+		return "resolve complete"
 	}
-	if doneFiles > p.total {
-		doneFiles = p.total
+	return fmt.Sprintf("resolve complete, %d paths renamed by path policy", renamed)
+}
+
+// reportLinkError reports a skipped link without finishing the job.
+func reportLinkError(onProgress ProgressHandler, link string, err error) {
+	if onProgress == nil {
+		return
 	}
+	onProgress(ProgressEvent{
+		Phase:   "resolve",
+		Message: fmt.Sprintf("skipped %s: %v", link, err),
+	})
+}
 
-	remainingFiles := p.total - doneFiles
-	if remainingFiles < 0 {
-		remainingFiles = 0
+// joinErrors joins download and resolve failures, dropping nil values.
+func joinErrors(err error, resolveErr error) error {
+	if resolveErr == nil {
+		return err
 	}
+	return errors.Join(err, resolveErr)
+}
 
-	return doneFiles, remainingFiles, currentFileForIndex(files, doneFiles)
+// withResolveEvents forwards resolver events, such as retries, as resolve progress.
+func withResolveEvents(ctx context.Context, onProgress ProgressHandler) context.Context {
+	if onProgress == nil {
+		return ctx
+	}
+	return cloudmail.WithEvents(ctx, func(event cloudmail.Event) {
+		onProgress(ProgressEvent{
+			Phase:         "resolve",
+			Message:       event.Message,
+			RateLimitWait: event.RateLimitWait,
+		})
+	})
 }
 
 func currentFileForIndex(files []FileTask, index int) string {
@@ -1,9 +1,15 @@
 package cmrd
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/jhonroun/cmrd/internal/aria2"
+	"github.com/jhonroun/cmrd/internal/cloudmail"
 )
 
 func TestReadLinksFile(t *testing.T) {
@@ -34,3 +40,150 @@ https://cloud.mail.ru/public/9bFs/gVzxjU5uC
 		t.Fatalf("unexpected second link: %q", links[1])
 	}
 }
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+	cfg := DefaultConfig()
+	cfg.DownloadDir = dir
+	cfg.Backend = BackendNative
+	client, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	content := []byte("content longer than twenty bytes")
+	hash, err := cloudmail.HashReader(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("hash: %v", err)
+	}
+	for _, name := range []string{"ok.txt", "bad.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	files := []FileTask{
+		{Output: "ok.txt", Size: int64(len(content)), Hash: hash},
+		{Output: "bad.txt", Size: int64(len(content)), Hash: "0000000000000000000000000000000000000001"},
+		{Output: "missing.txt", Size: 1, Hash: hash},
+	}
+
+	err = client.Verify(context.Background(), files, nil)
+	var verifyErr *VerifyError
+	if !errors.As(err, &verifyErr) {
+		t.Fatalf("expected VerifyError, got %v", err)
+	}
+	if len(verifyErr.Files) != 2 {
+		t.Fatalf("unexpected failed count: got=%d want=2", len(verifyErr.Files))
+	}
+	if verifyErr.Files[0].Output != "bad.txt" || !errors.Is(verifyErr.Files[0].Err, ErrHashMismatch) {
+		t.Fatalf("unexpected first failure: %v", verifyErr.Files[0])
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected missing file error in %v", err)
+	}
+
+	// Files without a hash are still checked by size, unless the size is unknown.
+	unhashed := []FileTask{
+		{Output: "ok.txt", Size: int64(len(content))},
+		{Output: "ok.txt"},
+		{Output: "bad.txt", Size: 1},
+	}
+	err = client.Verify(context.Background(), unhashed, nil)
+	if !errors.As(err, &verifyErr) || len(verifyErr.Files) != 1 || !errors.Is(verifyErr.Files[0].Err, ErrSizeMismatch) {
+		t.Fatalf("expected one size mismatch, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := client.Verify(ctx, files, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation, got %v", err)
+	}
+	if err := verifyFile(ctx, filepath.Join(dir, "ok.txt"), files[0]); !errors.Is(err, context.Canceled) {
+		t.Fatalf("hashing should stop on cancellation, got %v", err)
+	}
+}
+
+func TestSplitResults(t *testing.T) {
+	deadErr := errors.New("http status 404")
+	results := []LinkResult{
+		{Link: "https://cloud.mail.ru/public/AbCd/EfGh", Files: []FileTask{{Output: "a.txt"}, {Output: "b.txt"}}},
+		{Link: "https://cloud.mail.ru/public/Dead/Link", Err: deadErr},
+	}
+
+	files, err := SplitResults(results)
+	if len(files) != 2 {
+		t.Fatalf("unexpected files count: got=%d want=2", len(files))
+	}
+	var resolveErr *ResolveError
+	if !errors.As(err, &resolveErr) || len(resolveErr.Links) != 1 {
+		t.Fatalf("expected ResolveError with one link, got %v", err)
+	}
+	if resolveErr.Links[0].Link != results[1].Link || !errors.Is(err, deadErr) {
+		t.Fatalf("unexpected link error: %+v", resolveErr.Links[0])
+	}
+
+	if _, err := SplitResults(results[:1]); err != nil {
+		t.Fatalf("unexpected error for resolved links: %v", err)
+	}
+}
+
+func TestCheckOutput(t *testing.T) {
+	tests := []struct {
+		output string
+		safe   bool
+	}{
+		{output: "share/a.txt", safe: true},
+		{output: "share/sub/../a.txt", safe: true},
+		{output: `share\a.txt`, safe: true},
+		{output: "../a.txt", safe: false},
+		{output: "share/../../a.txt", safe: false},
+		{output: `share\..\..\a.txt`, safe: false},
+		{output: "/etc/passwd", safe: false},
+		{output: "..", safe: false},
+		{output: "", safe: false},
+	}
+
+	for _, tt := range tests {
+		err := CheckOutput(FileTask{Output: tt.output, RemotePath: "AbCd/EfGh"})
+		var unsafeErr *UnsafePathError
+		if tt.safe != (err == nil) || (err != nil && !errors.As(err, &unsafeErr)) {
+			t.Fatalf("CheckOutput(%q) mismatch: got=%v want safe=%v", tt.output, err, tt.safe)
+		}
+	}
+}
+
+func TestRPCProgress(t *testing.T) {
+	files := []FileTask{{Output: "a"}, {Output: "b"}, {Output: "c"}}
+	failed := &aria2.DownloadError{File: "c", Code: 3}
+	event := aria2.ProgressEvent{
+		Phase: "download",
+		Files: []aria2.FileState{
+			{Index: 0, State: aria2.StateComplete, TotalBytes: 10, DoneBytes: 10},
+			{Index: 1, State: aria2.StateActive, TotalBytes: 10, DoneBytes: 4, Speed: 7},
+			{Index: 2, State: aria2.StateError, Err: failed},
+		},
+	}
+
+	got := rpcProgress(event, files)
+	if got.DoneFiles != 1 || got.RemainingFiles != 1 || got.CurrentFile != "b" || got.Speed != 7 {
+		t.Fatalf("unexpected counters: %+v", got)
+	}
+	want := FileProgress{Output: "b", State: FileStateActive, Size: 10, Downloaded: 4, Speed: 7}
+	if len(got.Files) != 3 || got.Files[1] != want || got.Files[2].Err != failed {
+		t.Fatalf("files mismatch: got=%+v want=%+v", got.Files, want)
+	}
+	if len(got.FileErrors) != 0 {
+		t.Fatalf("file errors are reported only on the final event: %+v", got.FileErrors)
+	}
+
+	event.Done = true
+	if got := rpcProgress(event, files); len(got.FileErrors) != 1 || got.FileErrors[0].Output != "c" {
+		t.Fatalf("final event file errors mismatch: %+v", got.FileErrors)
+	}
+
+	// Events without file state, e.g. the start message, keep the plain counters.
+	if got := rpcProgress(aria2.ProgressEvent{Message: "aria2c started"}, files); got.Files != nil || got.RemainingFiles != 3 || got.CurrentFile != "a" {
+		t.Fatalf("unexpected start event: %+v", got)
+	}
+}
@@ -1,10 +1,18 @@
 package cmrd
 
 import (
+	"net/http"
 	"strings"
 	"time"
 )
 
+// Download backends accepted by Config.Backend.
+const (
+	BackendAuto   = "auto"
+	BackendAria2  = "aria2"
+	BackendNative = "native"
+)
+
 // Config configures library behavior.
 type Config struct {
 	Aria2Path            string
@@ -13,6 +21,85 @@ type Config struct {
 	ProxyAuth            string
 	HTTPTimeout          time.Duration
 	DeleteInputAfterDone bool
+
+	// Backend selects the download engine: auto, aria2 or native.
+	// Auto uses aria2c when it can be found and the native engine otherwise.
+	Backend string
+	// Aria2Console makes the aria2 backend read progress from the aria2c console
+	// output instead of driving it over JSON-RPC. Console mode reports only the
+	// overall percentage and is also used when the RPC interface fails to start.
+	Aria2Console bool
+	// Concurrency is the number of files downloaded in parallel.
+	Concurrency int
+	// Splits is the number of parallel connections per file.
+	Splits int
+	// Retries is the number of retries for a failed API or download request.
+	Retries int
+	// RetryBaseDelay is the delay before the first retry; later retries back off exponentially.
+	RetryBaseDelay time.Duration
+	// RetryMaxDelay caps the retry delay, including server Retry-After hints.
+	RetryMaxDelay time.Duration
+	// URLRefreshes bounds how many times download URLs rejected by the hosts
+	// (403, 404, 410) are re-resolved and unfinished files restarted; 0 disables it.
+	URLRefreshes int
+	// VerifyHashes checks downloaded files against Cloud.Mail content hash.
+	VerifyHashes bool
+	// ResolveWorkers is the number of folders listed in parallel during resolve.
+	ResolveWorkers int
+	// ContinueOnError downloads files of resolved links when other links fail to resolve.
+	// Failed links are reported with *ResolveError after the download.
+	ContinueOnError bool
+	// Filter selects files during resolve; the zero value keeps every file.
+	Filter Filter
+	// Archive makes Download fetch every Cloud.Mail folder link as one ZIP
+	// archive packed by Cloud.Mail instead of file by file; other providers
+	// reject it. Filter and VerifyHashes do not apply to the archive itself.
+	Archive bool
+	// ExtractArchive unpacks downloaded archives into DownloadDir with the
+	// layout of per-file downloads, applying Filter, and removes them.
+	ExtractArchive bool
+	// PathPolicy selects how remote names are made safe for the local file system:
+	// windows, posix, portable or none. Colliding outputs get " (2)", " (3)" suffixes.
+	PathPolicy string
+	// PathSubstitute replaces characters forbidden by PathPolicy.
+	PathSubstitute string
+	// CacheDir enables the on-disk resolve cache; empty disables it.
+	// Cached folder trees are reused for CacheTTL, download URLs are always fresh.
+	CacheDir string
+	// CacheTTL is the lifetime of cached resolve results.
+	CacheTTL time.Duration
+	// RateLimit caps Cloud.Mail API requests per second; zero does not limit.
+	RateLimit float64
+	// RateBurst is the number of API requests allowed at once under RateLimit.
+	RateBurst int
+	// RateLimiter shares one limiter between clients, e.g. all jobs of a gRPC server;
+	// it overrides RateLimit and RateBurst.
+	RateLimiter *RateLimiter
+
+	// Proxies are extra proxies used together with Proxy: host:port or
+	// http, https, socks5 and socks5h URLs. ProxyAuth applies to entries without credentials.
+	// aria2c uses only http and https proxies.
+	Proxies []string
+	// ProxyStrategy selects proxies: round-robin (default) or least-failures.
+	ProxyStrategy string
+	// ProxyPool shares one pool between clients; it overrides Proxy, Proxies and ProxyStrategy.
+	ProxyPool *ProxyPool
+
+	// Session logs requests in to Cloud.Mail, so private https://cloud.mail.ru/home/...
+	// links can be resolved and downloaded; nil stays anonymous.
+	Session *Session
+
+	// Providers handle links of other services. They are tried in order before
+	// the built-in Cloud.Mail, Yandex.Disk and directory listing providers.
+	Providers []Provider
+
+	// APIBaseURL overrides the Cloud.Mail API endpoint, e.g. for cloudmailtest.Server.
+	APIBaseURL string
+	// YandexAPIBaseURL overrides the Yandex.Disk API endpoint, e.g. for a fake server in tests.
+	YandexAPIBaseURL string
+	// HTTPClient overrides the HTTP client used for API and listing requests;
+	// HTTPTimeout and proxy settings do not apply to it.
+	HTTPClient *http.Client
 }
 
 // DefaultConfig returns recommended defaults.
@@ -21,6 +108,19 @@ func DefaultConfig() Config {
 		DownloadDir:          "downloads",
 		HTTPTimeout:          30 * time.Second,
 		DeleteInputAfterDone: true,
+		Backend:              BackendAuto,
+		Concurrency:          10,
+		Splits:               10,
+		Retries:              5,
+		RetryBaseDelay:       time.Second,
+		RetryMaxDelay:        30 * time.Second,
+		URLRefreshes:         DefaultURLRefreshes,
+		VerifyHashes:         true,
+		ResolveWorkers:       4,
+		PathPolicy:           PathPolicyWindows,
+		PathSubstitute:       "_",
+		CacheTTL:             DefaultCacheTTL,
+		RateBurst:            DefaultRateBurst,
 	}
 }
 
@@ -32,5 +132,52 @@ func (c Config) normalized() Config {
 	if cfg.HTTPTimeout <= 0 {
 		cfg.HTTPTimeout = 30 * time.Second
 	}
+	cfg.Backend = strings.ToLower(strings.TrimSpace(cfg.Backend))
+	if cfg.Backend == "" {
+		cfg.Backend = BackendAuto
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 10
+	}
+	if cfg.Splits <= 0 {
+		cfg.Splits = 10
+	}
+	if cfg.Retries < 0 {
+		cfg.Retries = 0
+	}
+	if cfg.URLRefreshes < 0 {
+		cfg.URLRefreshes = 0
+	}
+	if cfg.RetryBaseDelay <= 0 {
+		cfg.RetryBaseDelay = time.Second
+	}
+	if cfg.RetryMaxDelay <= 0 {
+		cfg.RetryMaxDelay = 30 * time.Second
+	}
+	if cfg.ResolveWorkers <= 0 {
+		cfg.ResolveWorkers = 1
+	}
+	cfg.PathPolicy = strings.ToLower(strings.TrimSpace(cfg.PathPolicy))
+	if cfg.PathPolicy == "" {
+		cfg.PathPolicy = PathPolicyWindows
+	}
+	if cfg.PathSubstitute == "" {
+		cfg.PathSubstitute = "_"
+	}
+	cfg.Proxy = strings.TrimSpace(cfg.Proxy)
+	cfg.ProxyStrategy = strings.ToLower(strings.TrimSpace(cfg.ProxyStrategy))
+	if cfg.ProxyStrategy == "" {
+		cfg.ProxyStrategy = ProxyRoundRobin
+	}
+	cfg.CacheDir = strings.TrimSpace(cfg.CacheDir)
+	if cfg.CacheTTL <= 0 {
+		cfg.CacheTTL = DefaultCacheTTL
+	}
+	if cfg.RateLimit < 0 {
+		cfg.RateLimit = 0
+	}
+	if cfg.RateBurst <= 0 {
+		cfg.RateBurst = DefaultRateBurst
+	}
 	return cfg
 }
@@ -0,0 +1,210 @@
+package cmrd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/jhonroun/cmrd/internal/aria2"
+	"github.com/jhonroun/cmrd/internal/cloudmail"
+)
+
+// Failures returned by Client, matched with errors.Is.
+var (
+	// ErrLinkNotFound means the public link or one of its files does not exist.
+	ErrLinkNotFound = cloudmail.ErrNotFound
+	// ErrLinkBlocked means Cloud.Mail blocked access to the link.
+	ErrLinkBlocked = cloudmail.ErrBlocked
+	// ErrRateLimited means Cloud.Mail rejected requests as too frequent (HTTP 429).
+	ErrRateLimited = cloudmail.ErrRateLimited
+	// ErrQuotaExceeded means the download traffic quota of the link is used up.
+	ErrQuotaExceeded = cloudmail.ErrQuotaExceeded
+	// ErrAntiBot means Cloud.Mail served a captcha page instead of the share.
+	ErrAntiBot = cloudmail.ErrAntiBot
+	// ErrAuthRequired means a private link needs a session, or Cloud.Mail rejected the session (HTTP 401).
+	ErrAuthRequired = cloudmail.ErrAuthRequired
+	// ErrDiskFull means there is no space left in the download directory.
+	ErrDiskFull = errors.New("disk full")
+	// ErrAria2Missing means the aria2 backend was selected but aria2c cannot be run.
+	ErrAria2Missing = errors.New("aria2c not found")
+)
+
+// Aria2Error reports an aria2c run that exited with a non-zero code or, in
+// JSON-RPC mode, files aria2c failed to download; ExitCode is then the error
+// code of the first failed file. It unwraps to the process error and, for
+// some codes, to a failure above, e.g. ErrDiskFull for code 9.
+type Aria2Error struct {
+	ExitCode int
+	// Meaning describes the exit code as documented by aria2.
+	Meaning string
+	Err     error
+}
+
+func (e *Aria2Error) Error() string {
+	return fmt.Sprintf("aria2c failed with code %d: %s", e.ExitCode, e.Meaning)
+}
+
+func (e *Aria2Error) Unwrap() []error {
+	if kind := aria2Failures[e.ExitCode]; kind != nil {
+		return []error{e.Err, kind}
+	}
+	return []error{e.Err}
+}
+
+// aria2Failures maps aria2c exit codes to the failures they stand for.
+var aria2Failures = map[int]error{
+	3: ErrLinkNotFound,
+	9: ErrDiskFull,
+}
+
+// Error codes returned by Code. They are stable and sent as gRPC error reasons.
+const (
+	CodeLinkNotFound  = "LINK_NOT_FOUND"
+	CodeLinkBlocked   = "LINK_BLOCKED"
+	CodeRateLimited   = "RATE_LIMITED"
+	CodeQuotaExceeded = "QUOTA_EXCEEDED"
+	CodeAntiBot       = "ANTI_BOT"
+	CodeAuthRequired  = "AUTH_REQUIRED"
+	CodeDiskFull      = "DISK_FULL"
+	CodeAria2Missing  = "ARIA2_MISSING"
+	CodeAria2Failed   = "ARIA2_FAILED"
+	CodeVerifyFailed  = "VERIFY_FAILED"
+	CodeUnsafePath    = "UNSAFE_PATH"
+	CodeNetwork       = "NETWORK"
+	CodeCanceled      = "CANCELED"
+	CodeUnknown       = "UNKNOWN"
+)
+
+// Exit codes of the cmrd command, returned by ExitCode.
+const (
+	ExitOK            = 0
+	ExitFailure       = 1
+	ExitLinkNotFound  = 2
+	ExitLinkBlocked   = 3
+	ExitRateLimited   = 4
+	ExitQuotaExceeded = 5
+	ExitAntiBot       = 6
+	ExitDiskFull      = 7
+	ExitAria2Missing  = 8
+	ExitAria2Failed   = 9
+	ExitVerifyFailed  = 10
+	ExitUnsafePath    = 11
+	ExitNetwork       = 12
+	ExitAuthRequired  = 13
+	ExitCanceled      = 130
+)
+
+type errorClass struct {
+	code      string
+	exit      int
+	retryable bool
+	match     func(error) bool
+}
+
+// errorClasses are checked in order; the first match classifies the error.
+var errorClasses = []errorClass{
+	{code: CodeCanceled, exit: ExitCanceled, match: isError(context.Canceled)},
+	{code: CodeDiskFull, exit: ExitDiskFull, match: isError(ErrDiskFull)},
+	{code: CodeAria2Missing, exit: ExitAria2Missing, match: isError(ErrAria2Missing)},
+	{code: CodeAntiBot, exit: ExitAntiBot, match: isError(ErrAntiBot)},
+	{code: CodeAuthRequired, exit: ExitAuthRequired, match: isError(ErrAuthRequired)},
+	{code: CodeLinkBlocked, exit: ExitLinkBlocked, match: isError(ErrLinkBlocked)},
+	{code: CodeQuotaExceeded, exit: ExitQuotaExceeded, retryable: true, match: isError(ErrQuotaExceeded)},
+	{code: CodeRateLimited, exit: ExitRateLimited, retryable: true, match: isError(ErrRateLimited)},
+	{code: CodeLinkNotFound, exit: ExitLinkNotFound, match: isError(ErrLinkNotFound)},
+	{code: CodeUnsafePath, exit: ExitUnsafePath, match: isType[*UnsafePathError]},
+	{code: CodeVerifyFailed, exit: ExitVerifyFailed, retryable: true, match: isType[*VerifyError]},
+	{code: CodeAria2Failed, exit: ExitAria2Failed, retryable: true, match: isType[*Aria2Error]},
+	{code: CodeNetwork, exit: ExitNetwork, retryable: true, match: isNetworkError},
+}
+
+func isError(target error) func(error) bool {
+	return func(err error) bool { return errors.Is(err, target) }
+}
+
+func isType[T error](err error) bool {
+	var target T
+	return errors.As(err, &target)
+}
+
+func isNetworkError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func classify(err error) (errorClass, bool) {
+	for _, class := range errorClasses {
+		if class.match(err) {
+			return class, true
+		}
+	}
+	return errorClass{}, false
+}
+
+// Code returns the error code of err, CodeUnknown for unrecognized errors and "" for nil.
+func Code(err error) string {
+	if err == nil {
+		return ""
+	}
+	if class, ok := classify(err); ok {
+		return class.code
+	}
+	return CodeUnknown
+}
+
+// ExitCode returns the cmrd process exit code for err: ExitOK for nil and
+// ExitFailure for unrecognized errors.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	if class, ok := classify(err); ok {
+		return class.exit
+	}
+	return ExitFailure
+}
+
+// Retryable reports whether running the same request again later may succeed:
+// rate limits, quotas, network errors and failed downloads are retryable,
+// missing or blocked links, anti-bot pages and a full disk are not.
+func Retryable(err error) bool {
+	class, ok := classify(err)
+	return ok && class.retryable
+}
+
+// RetryAfter returns the delay requested by Cloud.Mail with Retry-After, or zero.
+func RetryAfter(err error) time.Duration {
+	var httpErr *cloudmail.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.RetryAfter
+	}
+	return 0
+}
+
+// downloadError marks a full disk with ErrDiskFull.
+func downloadError(err error) error {
+	if err != nil && errors.Is(err, syscall.ENOSPC) && !errors.Is(err, ErrDiskFull) {
+		return fmt.Errorf("%w: %w", ErrDiskFull, err)
+	}
+	return err
+}
+
+// aria2Error turns a missing aria2c binary into ErrAria2Missing and an exit
+// status or failed files into *Aria2Error.
+func aria2Error(err error) error {
+	if errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %w", ErrAria2Missing, err)
+	}
+	if code, ok := aria2.ExitCode(err); ok {
+		return downloadError(&Aria2Error{ExitCode: code, Meaning: aria2.ExitMeaning(code), Err: err})
+	}
+	return downloadError(err)
+}
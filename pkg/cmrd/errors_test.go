@@ -0,0 +1,72 @@
+package cmrd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jhonroun/cmrd/internal/aria2"
+	"github.com/jhonroun/cmrd/internal/cloudmail"
+)
+
+func TestErrorClassification(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		code      string
+		exit      int
+		retryable bool
+	}{
+		{name: "nil", err: nil, code: "", exit: ExitOK},
+		{name: "unknown", err: errors.New("boom"), code: CodeUnknown, exit: ExitFailure},
+		{name: "404", err: fmt.Errorf("resolve %q: %w", "x", &cloudmail.HTTPError{StatusCode: 404}), code: CodeLinkNotFound, exit: ExitLinkNotFound},
+		{name: "451", err: &cloudmail.HTTPError{StatusCode: 451}, code: CodeLinkBlocked, exit: ExitLinkBlocked},
+		{name: "429", err: &cloudmail.HTTPError{StatusCode: 429}, code: CodeRateLimited, exit: ExitRateLimited, retryable: true},
+		{name: "509", err: &cloudmail.HTTPError{StatusCode: 509}, code: CodeQuotaExceeded, exit: ExitQuotaExceeded, retryable: true},
+		{name: "500", err: &cloudmail.HTTPError{StatusCode: 500}, code: CodeUnknown, exit: ExitFailure},
+		{name: "401", err: &cloudmail.HTTPError{StatusCode: 401}, code: CodeAuthRequired, exit: ExitAuthRequired},
+		{name: "anti-bot", err: fmt.Errorf("page id not found: %w", ErrAntiBot), code: CodeAntiBot, exit: ExitAntiBot},
+		{
+			name: "partial resolve",
+			err:  &ResolveError{Links: []LinkError{{Link: "dead", Err: &cloudmail.HTTPError{StatusCode: 404}}}},
+			code: CodeLinkNotFound, exit: ExitLinkNotFound,
+		},
+		{
+			name: "disk full",
+			err:  downloadError(fmt.Errorf("a.bin: %w", &fs.PathError{Op: "write", Path: "a.bin", Err: syscall.ENOSPC})),
+			code: CodeDiskFull, exit: ExitDiskFull,
+		},
+		{name: "aria2 missing", err: aria2Error(&exec.Error{Name: "aria2c", Err: exec.ErrNotFound}), code: CodeAria2Missing, exit: ExitAria2Missing},
+		{name: "aria2 disk full", err: &Aria2Error{ExitCode: 9, Err: errors.New("exit status 9")}, code: CodeDiskFull, exit: ExitDiskFull},
+		{name: "aria2 failed", err: &Aria2Error{ExitCode: 7, Err: errors.New("exit status 7")}, code: CodeAria2Failed, exit: ExitAria2Failed, retryable: true},
+		{
+			name: "aria2 rpc link not found",
+			err:  aria2Error(errors.Join(&aria2.DownloadError{File: "a.bin", Code: 3, Message: "Resource not found"})),
+			code: CodeLinkNotFound, exit: ExitLinkNotFound,
+		},
+		{name: "verify", err: &VerifyError{Files: []FileError{{Output: "a"}}}, code: CodeVerifyFailed, exit: ExitVerifyFailed, retryable: true},
+		{name: "unsafe path", err: &UnsafePathError{Output: "../a"}, code: CodeUnsafePath, exit: ExitUnsafePath},
+		{name: "timeout", err: fmt.Errorf("get: %w", context.DeadlineExceeded), code: CodeNetwork, exit: ExitNetwork, retryable: true},
+		{name: "canceled", err: errors.Join(context.Canceled, ErrRateLimited), code: CodeCanceled, exit: ExitCanceled},
+	}
+	for _, test := range tests {
+		if got := Code(test.err); got != test.code {
+			t.Fatalf("%s: code mismatch: got=%q want=%q", test.name, got, test.code)
+		}
+		if got := ExitCode(test.err); got != test.exit {
+			t.Fatalf("%s: exit code mismatch: got=%d want=%d", test.name, got, test.exit)
+		}
+		if got := Retryable(test.err); got != test.retryable {
+			t.Fatalf("%s: retryable mismatch: got=%v want=%v", test.name, got, test.retryable)
+		}
+	}
+
+	if got := RetryAfter(fmt.Errorf("x: %w", &cloudmail.HTTPError{StatusCode: 429, RetryAfter: 3 * time.Second})); got != 3*time.Second {
+		t.Fatalf("retry after mismatch: got=%s want=3s", got)
+	}
+}
@@ -0,0 +1,50 @@
+package cmrd
+
+import "github.com/jhonroun/cmrd/internal/cloudmail"
+
+// Filter selects files during resolve. Paths are matched relative to the
+// resolved folder with "/" separators; excluded folders are not listed at all.
+//
+// Glob patterns support "*", "?", "[...]" and "**". A glob without "/" matches
+// the file or folder name at any depth, and a trailing "/" matches folders only.
+type Filter struct {
+	// Include keeps only files matching at least one glob pattern.
+	Include []string `json:"include,omitempty"`
+	// Exclude skips files and prunes folders matching any glob pattern.
+	Exclude []string `json:"exclude,omitempty"`
+	// IncludeRegex keeps only files whose path matches at least one regular expression.
+	IncludeRegex []string `json:"include_regex,omitempty"`
+	// ExcludeRegex skips files and prunes folders whose path matches any regular expression.
+	ExcludeRegex []string `json:"exclude_regex,omitempty"`
+	// Extensions keeps only files with one of the extensions, with or without the dot.
+	Extensions []string `json:"extensions,omitempty"`
+	// MinSize skips files smaller than MinSize bytes.
+	MinSize int64 `json:"min_size,omitempty"`
+	// MaxSize skips files larger than MaxSize bytes; zero means no limit.
+	MaxSize int64 `json:"max_size,omitempty"`
+	// MaxDepth limits traversal depth; files of the resolved folder have depth 1.
+	MaxDepth int `json:"max_depth,omitempty"`
+}
+
+// Validate reports invalid patterns or bounds.
+func (f Filter) Validate() error {
+	return f.internal().Validate()
+}
+
+// IsZero reports whether the filter keeps every file.
+func (f Filter) IsZero() bool {
+	return f.internal().IsZero()
+}
+
+func (f Filter) internal() cloudmail.Filter {
+	return cloudmail.Filter{
+		Include:      f.Include,
+		Exclude:      f.Exclude,
+		IncludeRegex: f.IncludeRegex,
+		ExcludeRegex: f.ExcludeRegex,
+		Extensions:   f.Extensions,
+		MinSize:      f.MinSize,
+		MaxSize:      f.MaxSize,
+		MaxDepth:     f.MaxDepth,
+	}
+}
@@ -0,0 +1,826 @@
+package cmrd_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jhonroun/cmrd/pkg/cloudmailtest"
+	"github.com/jhonroun/cmrd/pkg/cmrd"
+)
+
+func newFakeShare(t *testing.T) (*cloudmailtest.Server, string) {
+	t.Helper()
+	server := cloudmailtest.NewServer(t)
+	link := server.AddShare("AbCd/EfGh", cloudmailtest.Folder{
+		Name: "share",
+		Folders: []cloudmailtest.Folder{{
+			Name: "docs",
+			Files: []cloudmailtest.File{
+				{Name: "a.txt", Content: []byte("small")},
+				{Name: "b.bin", Content: bytes.Repeat([]byte("cloud"), 40000)},
+			},
+		}},
+		Files: []cloudmailtest.File{
+			{Name: "readme.md", Content: []byte("# fake share\n"), ModTime: time.Unix(1700000000, 0)},
+		},
+	})
+	return server, link
+}
+
+func newFakeClient(t *testing.T, server *cloudmailtest.Server, configure func(*cmrd.Config)) *cmrd.Client {
+	t.Helper()
+	cfg := cmrd.DefaultConfig()
+	cfg.APIBaseURL = server.APIBaseURL()
+	cfg.Backend = cmrd.BackendNative
+	cfg.DownloadDir = t.TempDir()
+	cfg.RetryBaseDelay = time.Millisecond
+	cfg.RetryMaxDelay = 10 * time.Millisecond
+	if configure != nil {
+		configure(&cfg)
+	}
+	client, err := cmrd.New(cfg)
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	return client
+}
+
+func TestFakeShareDownload(t *testing.T) {
+	server, link := newFakeShare(t)
+	client := newFakeClient(t, server, nil)
+
+	var last cmrd.ProgressEvent
+	if err := client.Download(context.Background(), []string{link}, func(event cmrd.ProgressEvent) {
+		last = event
+	}); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	if !last.Done || last.DoneFiles != 3 {
+		t.Fatalf("unexpected final event: %+v", last)
+	}
+
+	got, err := os.ReadFile(filepath.Join(client.Config().DownloadDir, "share", "docs", "b.bin"))
+	if err != nil {
+		t.Fatalf("read downloaded file: %v", err)
+	}
+	if !bytes.Equal(got, bytes.Repeat([]byte("cloud"), 40000)) {
+		t.Fatalf("downloaded content mismatch")
+	}
+}
+
+func TestFakeShareRetriesRateLimit(t *testing.T) {
+	server, link := newFakeShare(t)
+	server.SetMaxPageSize(1)
+	server.AddFault(cloudmailtest.Fault{Route: cloudmailtest.RouteFolder, Status: http.StatusTooManyRequests, Times: 2})
+	server.AddFault(cloudmailtest.Fault{Route: cloudmailtest.RouteDispatcher, Status: http.StatusBadGateway, Times: 1})
+	client := newFakeClient(t, server, nil)
+
+	files, err := client.Resolve(context.Background(), []string{link})
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("unexpected files count: got=%d want=3", len(files))
+	}
+	if files[2].Output != "share/readme.md" || files[2].ModTime.Unix() != 1700000000 || files[2].Hash == "" {
+		t.Fatalf("unexpected file metadata: %+v", files[2])
+	}
+	if server.Requests(cloudmailtest.RouteDispatcher) != 2 {
+		t.Fatalf("dispatcher was not retried: %d requests", server.Requests(cloudmailtest.RouteDispatcher))
+	}
+}
+
+func TestFakeShareDeadLink(t *testing.T) {
+	server, link := newFakeShare(t)
+	dead := server.Link("Dead/Link")
+	client := newFakeClient(t, server, func(cfg *cmrd.Config) {
+		cfg.ContinueOnError = true
+	})
+
+	err := client.Download(context.Background(), []string{dead, link}, nil)
+	var resolveErr *cmrd.ResolveError
+	if !errors.As(err, &resolveErr) || len(resolveErr.Links) != 1 || resolveErr.Links[0].Link != dead {
+		t.Fatalf("expected ResolveError for the dead link, got %v", err)
+	}
+	if !errors.Is(err, cmrd.ErrLinkNotFound) || cmrd.ExitCode(err) != cmrd.ExitLinkNotFound {
+		t.Fatalf("dead link is not reported as not found: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(client.Config().DownloadDir, "share", "readme.md")); err != nil {
+		t.Fatalf("files of the live link were not downloaded: %v", err)
+	}
+}
+
+func TestFakeSharePathPolicy(t *testing.T) {
+	server := cloudmailtest.NewServer(t)
+	link := server.AddShare("AbCd/EfGh", cloudmailtest.Folder{
+		Name: "share",
+		Files: []cloudmailtest.File{
+			{Name: "a:b.txt", Content: []byte("1")},
+			{Name: "a?b.txt", Content: []byte("2")},
+			{Name: "plain.txt", Content: []byte("3")},
+		},
+	})
+
+	tests := []struct {
+		policy string
+		want   []string
+	}{
+		{policy: cmrd.PathPolicyWindows, want: []string{"share/a-b.txt", "share/a-b (2).txt", "share/plain.txt"}},
+		{policy: cmrd.PathPolicyPOSIX, want: []string{"share/a:b.txt", "share/a?b.txt", "share/plain.txt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			client := newFakeClient(t, server, func(cfg *cmrd.Config) {
+				cfg.PathPolicy = tt.policy
+				cfg.PathSubstitute = "-"
+			})
+			files, err := client.Resolve(context.Background(), []string{link})
+			if err != nil {
+				t.Fatalf("resolve: %v", err)
+			}
+			for index, file := range files {
+				if file.Output != tt.want[index] {
+					t.Fatalf("output mismatch: got=%q want=%q", file.Output, tt.want[index])
+				}
+			}
+
+			mappings := cmrd.PathMappings(files)
+			if tt.policy == cmrd.PathPolicyPOSIX {
+				if len(mappings) != 0 {
+					t.Fatalf("unexpected mappings: %+v", mappings)
+				}
+				return
+			}
+			if len(mappings) != 2 || mappings[1].Original != "share/a?b.txt" || mappings[1].Output != "share/a-b (2).txt" {
+				t.Fatalf("unexpected mappings: %+v", mappings)
+			}
+		})
+	}
+
+	cfg := cmrd.DefaultConfig()
+	cfg.PathPolicy = "fat12"
+	if _, err := cmrd.New(cfg); err == nil {
+		t.Fatalf("expected error for unknown path policy")
+	}
+}
+
+func TestFakeSharePathTraversal(t *testing.T) {
+	server := cloudmailtest.NewServer(t)
+	link := server.AddShare("AbCd/EfGh", cloudmailtest.Folder{
+		Name: "..",
+		Folders: []cloudmailtest.Folder{{
+			Name:  "..",
+			Files: []cloudmailtest.File{{Name: "evil.txt", Content: []byte("x")}},
+		}},
+	})
+
+	client := newFakeClient(t, server, func(cfg *cmrd.Config) {
+		cfg.PathPolicy = cmrd.PathPolicyNone
+	})
+	_, err := client.Resolve(context.Background(), []string{link})
+	var unsafeErr *cmrd.UnsafePathError
+	if !errors.As(err, &unsafeErr) || unsafeErr.Output != "../../evil.txt" {
+		t.Fatalf("expected UnsafePathError, got %v", err)
+	}
+	err = client.Download(context.Background(), []string{link}, nil)
+	if !errors.As(err, &unsafeErr) {
+		t.Fatalf("expected UnsafePathError from download, got %v", err)
+	}
+	if _, statErr := os.Stat(filepath.Join(client.Config().DownloadDir, "..", "..", "evil.txt")); !os.IsNotExist(statErr) {
+		t.Fatalf("file escaped the download directory: %v", statErr)
+	}
+
+	client = newFakeClient(t, server, func(cfg *cmrd.Config) {
+		cfg.PathPolicy = cmrd.PathPolicyPOSIX
+	})
+	files, err := client.Resolve(context.Background(), []string{link})
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if len(files) != 1 || files[0].Output != "__/__/evil.txt" {
+		t.Fatalf("unexpected rewritten output: %+v", files)
+	}
+}
+
+func TestFakeShareShardFailover(t *testing.T) {
+	server, link := newFakeShare(t)
+	server.SetShards(3)
+	server.AddFault(cloudmailtest.Fault{Route: cloudmailtest.RouteFile, Shard: 2, Status: http.StatusServiceUnavailable})
+	client := newFakeClient(t, server, func(cfg *cmrd.Config) {
+		cfg.Retries = 0
+	})
+
+	files, err := client.Resolve(context.Background(), []string{link})
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	hosts := make(map[string]bool)
+	for _, file := range files {
+		if len(file.Mirrors) != 2 {
+			t.Fatalf("expected 2 mirrors for %s, got %q", file.Output, file.Mirrors)
+		}
+		hosts[file.URL[:strings.Index(file.URL, "/AbCd/")]] = true
+	}
+	if len(hosts) != 3 {
+		t.Fatalf("files were not spread across shards: %v", hosts)
+	}
+
+	if err := client.Download(context.Background(), []string{link}, nil); err != nil {
+		t.Fatalf("download with a dead shard: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(client.Config().DownloadDir, "share", "docs", "b.bin"))
+	if err != nil || !bytes.Equal(got, bytes.Repeat([]byte("cloud"), 40000)) {
+		t.Fatalf("downloaded content mismatch: %v", err)
+	}
+}
+
+func TestFakeShareRefreshesExpiredURLs(t *testing.T) {
+	server, link := newFakeShare(t)
+	server.AddFault(cloudmailtest.Fault{Route: cloudmailtest.RouteFile, Weblink: "AbCd/EfGh/docs/b.bin", Status: http.StatusForbidden, Times: 1})
+	client := newFakeClient(t, server, nil)
+
+	var refreshes []string
+	var finals []cmrd.ProgressEvent
+	if err := client.Download(context.Background(), []string{link}, func(event cmrd.ProgressEvent) {
+		if strings.HasPrefix(event.Message, "download URLs expired") {
+			refreshes = append(refreshes, event.Message)
+		}
+		if event.Done || event.Err != nil {
+			finals = append(finals, event)
+		}
+	}); err != nil {
+		t.Fatalf("download with an expired URL: %v", err)
+	}
+	if want := "download URLs expired, refreshing 1 files (attempt 1/3)"; len(refreshes) != 1 || refreshes[0] != want {
+		t.Fatalf("unexpected refresh events: got=%q want=%q", refreshes, want)
+	}
+	// The expired-link failure must not finish the job before the refresh.
+	if len(finals) != 1 || finals[0].Err != nil {
+		t.Fatalf("expected one successful final event, got %+v", finals)
+	}
+	if got := server.Requests(cloudmailtest.RoutePage); got != 2 {
+		t.Fatalf("page id was not refreshed: page requests=%d", got)
+	}
+	got, err := os.ReadFile(filepath.Join(client.Config().DownloadDir, "share", "docs", "b.bin"))
+	if err != nil || !bytes.Equal(got, bytes.Repeat([]byte("cloud"), 40000)) {
+		t.Fatalf("downloaded content mismatch: %v", err)
+	}
+
+	server.AddFault(cloudmailtest.Fault{Route: cloudmailtest.RouteFile, Weblink: "AbCd/EfGh/readme.md", Status: http.StatusNotFound})
+	client = newFakeClient(t, server, func(cfg *cmrd.Config) {
+		cfg.URLRefreshes = 2
+	})
+	files, err := client.Resolve(context.Background(), []string{link})
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	pages := server.Requests(cloudmailtest.RoutePage)
+	// Refreshed URLs lose the query, so a changed caller slice is visible.
+	for index := range files {
+		files[index].URL += "?stale=1"
+	}
+	resolved := slices.Clone(files)
+	finals = nil
+	err = client.DownloadResolved(context.Background(), files, func(event cmrd.ProgressEvent) {
+		if event.Done || event.Err != nil {
+			finals = append(finals, event)
+		}
+	})
+	if err == nil {
+		t.Fatalf("expected download error for a permanently rejected URL")
+	}
+	if len(finals) != 1 || !finals[0].Done || finals[0].Err == nil {
+		t.Fatalf("expected one failed final event after the refreshes, got %+v", finals)
+	}
+	if !slices.EqualFunc(files, resolved, func(a, b cmrd.FileTask) bool { return a.URL == b.URL }) {
+		t.Fatalf("refresh changed the caller's files")
+	}
+	if got := server.Requests(cloudmailtest.RoutePage) - pages; got != 2 {
+		t.Fatalf("refresh attempts are not bounded: page requests=%d want=2", got)
+	}
+}
+
+func TestFakeShareProxyPool(t *testing.T) {
+	server, link := newFakeShare(t)
+	var proxied atomic.Int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied.Add(1)
+		r.RequestURI = ""
+		resp, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		maps.Copy(w.Header(), resp.Header)
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+	t.Cleanup(proxy.Close)
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	client := newFakeClient(t, server, func(cfg *cmrd.Config) {
+		cfg.Proxies = []string{dead.URL, proxy.URL}
+		cfg.ProxyStrategy = cmrd.ProxyLeastFailures
+	})
+	if err := client.Download(context.Background(), []string{link}, nil); err != nil {
+		t.Fatalf("download through proxy pool: %v", err)
+	}
+	if proxied.Load() == 0 {
+		t.Fatalf("no request went through the live proxy")
+	}
+	got, err := os.ReadFile(filepath.Join(client.Config().DownloadDir, "share", "docs", "b.bin"))
+	if err != nil || !bytes.Equal(got, bytes.Repeat([]byte("cloud"), 40000)) {
+		t.Fatalf("downloaded content mismatch: %v", err)
+	}
+
+	if _, err := cmrd.New(cmrd.Config{Proxies: []string{"ftp://proxy:21"}}); err == nil {
+		t.Fatalf("expected error for unsupported proxy scheme")
+	}
+}
+
+func TestFakeShareDownloadEntries(t *testing.T) {
+	server, link := newFakeShare(t)
+	client := newFakeClient(t, server, nil)
+
+	entries := []cmrd.LinkEntry{
+		{URL: link, Dir: "texts", Include: []string{"*.txt"}, Label: "Texts"},
+		{URL: link, Dir: "rest", Exclude: []string{"docs/"}},
+	}
+	var (
+		done   int
+		labels = make(map[string]bool)
+	)
+	if err := client.DownloadEntries(context.Background(), entries, func(event cmrd.ProgressEvent) {
+		if event.Done {
+			done++
+		}
+		labels[event.Label] = true
+	}); err != nil {
+		t.Fatalf("download entries: %v", err)
+	}
+	if done != 1 || !labels["Texts"] || !labels[""] {
+		t.Fatalf("unexpected events: done=%d labels=%v", done, labels)
+	}
+
+	root := client.Config().DownloadDir
+	for _, name := range []string{"texts/share/docs/a.txt", "rest/share/readme.md"} {
+		if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(name))); err != nil {
+			t.Fatalf("missing %s: %v", name, err)
+		}
+	}
+	for _, name := range []string{"texts/share/docs/b.bin", "texts/share/readme.md", "rest/share/docs"} {
+		if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(name))); err == nil {
+			t.Fatalf("unexpected %s", name)
+		}
+	}
+}
+
+func TestFakeShareErrorKinds(t *testing.T) {
+	server, link := newFakeShare(t)
+	server.AddFault(cloudmailtest.Fault{
+		Route:   cloudmailtest.RoutePage,
+		Status:  http.StatusOK,
+		Body:    "<html><div class=\"captcha\">Confirm you are not a robot</div></html>",
+		Weblink: "AbCd/EfGh",
+		Times:   1,
+	})
+	client := newFakeClient(t, server, nil)
+	if _, err := client.Resolve(context.Background(), []string{link}); !errors.Is(err, cmrd.ErrAntiBot) || cmrd.Retryable(err) {
+		t.Fatalf("expected anti-bot error, got %v", err)
+	}
+
+	server.AddFault(cloudmailtest.Fault{Route: cloudmailtest.RouteFile, Status: 509})
+	client = newFakeClient(t, server, func(cfg *cmrd.Config) {
+		cfg.Retries = 0
+	})
+	err := client.Download(context.Background(), []string{link}, nil)
+	if !errors.Is(err, cmrd.ErrQuotaExceeded) || cmrd.Code(err) != cmrd.CodeQuotaExceeded {
+		t.Fatalf("expected quota error, got %v", err)
+	}
+}
+
+func TestFakeShareResolveTree(t *testing.T) {
+	server := cloudmailtest.NewServer(t)
+	link := server.AddShare("AbCd/EfGh", cloudmailtest.Folder{
+		Name: "share",
+		Folders: []cloudmailtest.Folder{
+			{Name: "docs", Files: []cloudmailtest.File{
+				{Name: "a.txt", Content: []byte("small")},
+				{Name: "b.bin", Content: []byte("binary")},
+			}},
+			{Name: "empty"},
+		},
+		Files: []cloudmailtest.File{{Name: "readme.md", Content: []byte("# fake share\n")}},
+	})
+	client := newFakeClient(t, server, nil)
+
+	tree, err := client.ResolveTree(context.Background(), []string{link})
+	if err != nil {
+		t.Fatalf("resolve tree: %v", err)
+	}
+	root := tree.Find("share")
+	if root == nil || !root.Dir || root.Size != 24 || root.Files != 3 || root.Folders != 2 {
+		t.Fatalf("unexpected share node: %+v", root)
+	}
+	if empty := tree.Find("share/empty"); empty == nil || !empty.Dir || len(empty.Children) != 0 {
+		t.Fatalf("empty folder is missing: %+v", empty)
+	}
+	if docs := tree.Find("share/docs"); docs == nil || docs.Files != 2 || docs.RemotePath != "AbCd/EfGh/docs" {
+		t.Fatalf("unexpected docs node: %+v", docs)
+	}
+	if file := tree.Find("share/docs/b.bin"); file == nil || file.File == nil || file.File.Output != "share/docs/b.bin" {
+		t.Fatalf("unexpected file node: %+v", file)
+	}
+
+	files, err := client.Resolve(context.Background(), []string{link})
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	got := tree.Files()
+	if len(got) != len(files) {
+		t.Fatalf("unexpected files count: got=%d want=%d", len(got), len(files))
+	}
+	for index := range files {
+		if got[index].Output != files[index].Output {
+			t.Fatalf("unexpected file order: got=%q want=%q", got[index].Output, files[index].Output)
+		}
+	}
+
+	var visited []string
+	if err := tree.Walk(func(node *cmrd.Node) error {
+		visited = append(visited, node.Path)
+		if node.Path == "share/docs" {
+			return fs.SkipDir
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("walk: %v", err)
+	}
+	if strings.Join(visited, ",") != ",share,share/docs,share/empty,share/readme.md" {
+		t.Fatalf("unexpected walk order: %v", visited)
+	}
+
+	filtered := newFakeClient(t, server, func(cfg *cmrd.Config) {
+		cfg.Filter.Include = []string{"*.md"}
+	})
+	tree, err = filtered.ResolveTree(context.Background(), []string{link})
+	if err != nil {
+		t.Fatalf("resolve filtered tree: %v", err)
+	}
+	// docs is emptied by the filter; empty has no entries on the remote side.
+	if dirs := tree.Dirs(); strings.Join(dirs, ",") != "share,share/empty" {
+		t.Fatalf("unexpected folders of the filtered tree: %v", dirs)
+	}
+
+	encoded, err := json.Marshal(tree)
+	if err != nil {
+		t.Fatalf("marshal tree: %v", err)
+	}
+	var decoded cmrd.Tree
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("unmarshal tree: %v", err)
+	}
+	if node := decoded.Find("share/readme.md"); node == nil || node.File == nil || node.Size != 13 {
+		t.Fatalf("tree did not survive JSON: %s", encoded)
+	}
+}
+
+func TestFakeShareArchive(t *testing.T) {
+	server := cloudmailtest.NewServer(t)
+	link := server.AddShare("AbCd/EfGh", cloudmailtest.Folder{
+		Name: "share",
+		Folders: []cloudmailtest.Folder{
+			{Name: "docs", Files: []cloudmailtest.File{
+				{Name: "a:b.txt", Content: []byte("small")},
+				{Name: "b.bin", Content: bytes.Repeat([]byte("cloud"), 40000)},
+			}},
+			{Name: "empty"},
+		},
+		Files: []cloudmailtest.File{{Name: "readme.md", Content: []byte("# fake share\n")}},
+	})
+
+	client := newFakeClient(t, server, func(cfg *cmrd.Config) {
+		cfg.Archive = true
+		cfg.ExtractArchive = true
+	})
+	var last cmrd.ProgressEvent
+	if err := client.Download(context.Background(), []string{link}, func(event cmrd.ProgressEvent) {
+		last = event
+	}); err != nil {
+		t.Fatalf("download archive: %v", err)
+	}
+	if !last.Done || server.Requests(cloudmailtest.RouteZip) != 1 || server.Requests(cloudmailtest.RouteFile) != 0 {
+		t.Fatalf("unexpected archive download: last=%+v zip=%d files=%d",
+			last, server.Requests(cloudmailtest.RouteZip), server.Requests(cloudmailtest.RouteFile))
+	}
+
+	// Extracted files land where per-file downloads would put them.
+	files, err := client.Resolve(context.Background(), []string{link})
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	root := client.Config().DownloadDir
+	for _, file := range files {
+		info, err := os.Stat(filepath.Join(root, filepath.FromSlash(file.Output)))
+		if err != nil || info.Size() != file.Size {
+			t.Fatalf("extracted %s mismatch: %v", file.Output, err)
+		}
+	}
+	if info, err := os.Stat(filepath.Join(root, "share", "empty")); err != nil || !info.IsDir() {
+		t.Fatalf("empty folder was not extracted: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "share.zip")); err == nil {
+		t.Fatalf("archive was not removed after extraction")
+	}
+
+	filtered := newFakeClient(t, server, func(cfg *cmrd.Config) {
+		cfg.Archive = true
+		cfg.ExtractArchive = true
+		cfg.Filter.Exclude = []string{"docs/"}
+	})
+	if err := filtered.Download(context.Background(), []string{link}, nil); err != nil {
+		t.Fatalf("download filtered archive: %v", err)
+	}
+	root = filtered.Config().DownloadDir
+	if _, err := os.Stat(filepath.Join(root, "share", "readme.md")); err != nil {
+		t.Fatalf("missing readme.md: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "share", "docs")); err == nil {
+		t.Fatalf("excluded folder was extracted")
+	}
+
+	kept := newFakeClient(t, server, func(cfg *cmrd.Config) {
+		cfg.Archive = true
+	})
+	if err := kept.Download(context.Background(), []string{link}, nil); err != nil {
+		t.Fatalf("download archive without extraction: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(kept.Config().DownloadDir, "share.zip")); err != nil {
+		t.Fatalf("missing archive: %v", err)
+	}
+
+	if _, err := kept.ResolveArchive(context.Background(), server.Link("AbCd/EfGh/readme.md")); err == nil {
+		t.Fatalf("expected error for an archive of a single file")
+	}
+}
+
+func TestFakeAccountSession(t *testing.T) {
+	server := cloudmailtest.NewServer(t)
+	server.SetHome(cloudmailtest.Folder{
+		Folders: []cloudmailtest.Folder{{
+			Name: "Photos",
+			Folders: []cloudmailtest.Folder{{
+				Name:  "2024",
+				Files: []cloudmailtest.File{{Name: "b.bin", Content: bytes.Repeat([]byte("home"), 40000)}},
+			}},
+			Files: []cloudmailtest.File{{Name: "a.jpg", Content: []byte("jpeg")}},
+		}},
+	})
+	link := server.HomeLink("Photos")
+
+	anonymous := newFakeClient(t, server, nil)
+	if _, err := anonymous.Resolve(context.Background(), []string{link}); !errors.Is(err, cmrd.ErrAuthRequired) || cmrd.ExitCode(err) != cmrd.ExitAuthRequired {
+		t.Fatalf("expected ErrAuthRequired without a session, got %v", err)
+	}
+
+	expired, err := cmrd.ParseSession("127.0.0.1\tFALSE\t/\tFALSE\t0\tsdcs\texpired")
+	if err != nil {
+		t.Fatalf("parse session: %v", err)
+	}
+	rejected := newFakeClient(t, server, func(cfg *cmrd.Config) {
+		cfg.Session = expired
+	})
+	_, err = rejected.Resolve(context.Background(), []string{link})
+	if !errors.Is(err, cmrd.ErrAuthRequired) || strings.Contains(err.Error(), "expired") {
+		t.Fatalf("expected ErrAuthRequired without the cookie value for a rejected session, got %v", err)
+	}
+
+	session, err := cmrd.ParseSession(server.Cookies())
+	if err != nil {
+		t.Fatalf("parse session: %v", err)
+	}
+	client := newFakeClient(t, server, func(cfg *cmrd.Config) {
+		cfg.Session = session
+	})
+	files, err := client.Resolve(context.Background(), []string{link})
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	var got []string
+	for _, file := range files {
+		got = append(got, file.Output+"="+file.RemotePath)
+	}
+	if want := []string{"Photos/2024/b.bin=/Photos/2024/b.bin", "Photos/a.jpg=/Photos/a.jpg"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("private files mismatch: got=%q want=%q", got, want)
+	}
+
+	// An expired download URL is refreshed with the account dispatcher.
+	server.AddFault(cloudmailtest.Fault{Route: cloudmailtest.RouteFile, Weblink: "Photos/2024/b.bin", Status: http.StatusForbidden, Times: 1})
+	if err := client.Download(context.Background(), []string{link}, nil); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(client.Config().DownloadDir, "Photos", "2024", "b.bin"))
+	if err != nil || !bytes.Equal(content, bytes.Repeat([]byte("home"), 40000)) {
+		t.Fatalf("downloaded content mismatch: %v", err)
+	}
+	// The token is requested once per client, the dispatcher once per resolve and refresh.
+	if token, dispatcher := server.Requests(cloudmailtest.RouteToken), server.Requests(cloudmailtest.RouteDispatcher); token != 2 || dispatcher != 3 {
+		t.Fatalf("unexpected requests: token=%d dispatcher=%d", token, dispatcher)
+	}
+
+	// A token rotated between resolve and refresh is requested again.
+	files, err = client.Resolve(context.Background(), []string{link})
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	server.RotateToken()
+	if err := os.RemoveAll(filepath.Join(client.Config().DownloadDir, "Photos")); err != nil {
+		t.Fatal(err)
+	}
+	server.AddFault(cloudmailtest.Fault{Route: cloudmailtest.RouteFile, Weblink: "Photos/a.jpg", Status: http.StatusForbidden, Times: 1})
+	if err := client.DownloadResolved(context.Background(), files, nil); err != nil {
+		t.Fatalf("download with a rotated token: %v", err)
+	}
+	if token := server.Requests(cloudmailtest.RouteToken); token != 3 {
+		t.Fatalf("rotated token was not requested again: token requests=%d", token)
+	}
+}
+
+// memoryProvider serves "memory:" links from a fixed list of files.
+type memoryProvider struct {
+	files     []cmrd.FileTask
+	refreshed atomic.Int32
+	fresh     string
+}
+
+func (p *memoryProvider) Name() string { return "memory" }
+
+func (p *memoryProvider) Match(link string) bool { return strings.HasPrefix(link, "memory:") }
+
+func (p *memoryProvider) Walk(ctx context.Context, link string, file func(cmrd.FileTask) bool, dir func(cmrd.Folder) bool) error {
+	if dir != nil && !dir(cmrd.Folder{Output: "mem", RemotePath: link}) {
+		return nil
+	}
+	for _, task := range p.files {
+		if !file(task) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (p *memoryProvider) Refresh(ctx context.Context, files []cmrd.FileTask) ([]cmrd.FileTask, error) {
+	p.refreshed.Add(int32(len(files)))
+	refreshed := make([]cmrd.FileTask, len(files))
+	for index, file := range files {
+		file.URL = p.fresh
+		refreshed[index] = file
+	}
+	return refreshed, nil
+}
+
+func TestProviders(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"pub/a.txt":     "listing",
+		"pub/sub/b.txt": "nested",
+		"pub/sub/c.tmp": "temporary",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/pub/", http.FileServer(http.Dir(root)))
+	mux.HandleFunc("/expired/", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "expired", http.StatusForbidden)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	memory := &memoryProvider{
+		files: []cmrd.FileTask{
+			{URL: server.URL + "/expired/keep.txt", Output: "mem/keep.txt", RemotePath: "memory:keep", Size: 7},
+			{URL: server.URL + "/pub/sub/c.tmp", Output: "mem/drop.tmp", RemotePath: "memory:drop", Size: 9},
+		},
+		fresh: server.URL + "/pub/a.txt",
+	}
+	shares, _ := newFakeShare(t)
+	client := newFakeClient(t, shares, func(cfg *cmrd.Config) {
+		cfg.Providers = []cmrd.Provider{memory}
+		cfg.Filter.Exclude = []string{"*.tmp"}
+	})
+
+	links := []string{server.URL + "/pub/", "memory:share"}
+	files, err := client.Resolve(context.Background(), links)
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	var got []string
+	for _, file := range files {
+		got = append(got, file.Provider+" "+file.Output)
+	}
+	want := "autoindex pub/a.txt,autoindex pub/sub/b.txt,memory mem/keep.txt"
+	if strings.Join(got, ",") != want {
+		t.Fatalf("unexpected files: got=%q want=%q", strings.Join(got, ","), want)
+	}
+	if files[0].Size != 7 || files[0].RemotePath != server.URL+"/pub/a.txt" {
+		t.Fatalf("unexpected listing file: %+v", files[0])
+	}
+
+	tree, err := client.ResolveTree(context.Background(), links[:1])
+	if err != nil {
+		t.Fatalf("resolve tree: %v", err)
+	}
+	if node := tree.Find("pub/sub"); node == nil || !node.Dir || node.Files != 1 {
+		t.Fatalf("unexpected listing tree node: %+v", node)
+	}
+
+	if err := client.Download(context.Background(), links, nil); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	dir := client.Config().DownloadDir
+	for name, content := range map[string]string{
+		"pub/a.txt":     "listing",
+		"pub/sub/b.txt": "nested",
+		"mem/keep.txt":  "listing",
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil || string(data) != content {
+			t.Fatalf("unexpected %s: %q, %v", name, data, err)
+		}
+	}
+	if got := memory.refreshed.Load(); got != 1 {
+		t.Fatalf("expected the expired file to be refreshed through its provider, got %d", got)
+	}
+
+	// Links no provider accepts keep the Cloud.Mail error.
+	if _, err := client.Resolve(context.Background(), []string{"https://example.com/file.iso"}); err == nil {
+		t.Fatal("expected an error for an unknown link")
+	}
+}
+
+// listProvider serves "<name>:" links with fixed files and then fails with
+// err when it is set, like a listing that breaks partway.
+type listProvider struct {
+	name  string
+	files []cmrd.FileTask
+	err   error
+}
+
+func (p listProvider) Name() string { return p.name }
+
+func (p listProvider) Match(link string) bool { return strings.HasPrefix(link, p.name+":") }
+
+func (p listProvider) Walk(ctx context.Context, link string, file func(cmrd.FileTask) bool, dir func(cmrd.Folder) bool) error {
+	for _, task := range p.files {
+		if !file(task) {
+			return nil
+		}
+	}
+	return p.err
+}
+
+func (p listProvider) Refresh(ctx context.Context, files []cmrd.FileTask) ([]cmrd.FileTask, error) {
+	return files, nil
+}
+
+func TestResolveAllReleasesNamesOfFailedLinks(t *testing.T) {
+	server, _ := newFakeShare(t)
+	client := newFakeClient(t, server, func(cfg *cmrd.Config) {
+		cfg.Providers = []cmrd.Provider{
+			listProvider{name: "broken", files: []cmrd.FileTask{{URL: "https://a.example/1", Output: "mem/a?.txt"}}, err: errors.New("listing failed")},
+			listProvider{name: "good", files: []cmrd.FileTask{{URL: "https://a.example/2", Output: "mem/a:.txt"}}},
+		}
+	})
+
+	alone := client.ResolveAll(context.Background(), []string{"good:x"})
+	results := client.ResolveAll(context.Background(), []string{"broken:x", "good:x"})
+	if len(results) != 2 || results[0].Err == nil || len(results[0].Files) != 0 {
+		t.Fatalf("expected the broken link to fail without files: %+v", results)
+	}
+	// Both names sanitize to the same output; the failed link must not keep it.
+	if got, want := results[1].Files[0].Output, alone[0].Files[0].Output; got != want {
+		t.Fatalf("failed link kept its output names: got=%q want=%q", got, want)
+	}
+}
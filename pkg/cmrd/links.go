@@ -0,0 +1,338 @@
+package cmrd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jhonroun/cmrd/internal/cloudmail"
+	"github.com/jhonroun/cmrd/internal/yadisk"
+)
+
+// LinkEntry is one input link with its options from a links file.
+type LinkEntry struct {
+	URL string `json:"url"`
+	// Dir is a subdirectory of the download directory for the files of the link.
+	Dir string `json:"dir,omitempty"`
+	// Include replaces Filter.Include for the link.
+	Include []string `json:"include,omitempty"`
+	// Exclude is added to Filter.Exclude for the link.
+	Exclude []string `json:"exclude,omitempty"`
+	// Priority orders links: higher priorities are processed first.
+	Priority int `json:"priority,omitempty"`
+	// Label names the link in progress events and resolve output.
+	Label string `json:"label,omitempty"`
+}
+
+// LinkGroup is a run of links that share the same options.
+type LinkGroup struct {
+	// Options holds the shared options; its URL and Priority are not set.
+	Options LinkEntry
+	Links   []string
+}
+
+// publicLinkRE finds Cloud.Mail and Yandex.Disk public links in free text; the scheme is optional.
+var publicLinkRE = regexp.MustCompile(`(?i)(?:https?://)?(?:cloud\.mail\.ru/public|yadi\.sk/[di]|disk\.yandex\.[a-z.]+/[di])/[^\s"'<>()\[\]{}|\\^` + "`" + `]+`)
+
+// ReadLinksFile reads links from text file; see ParseLinks for the format.
+func ReadLinksFile(path string) ([]string, error) {
+	entries, err := ReadLinks(path)
+	if err != nil {
+		return nil, err
+	}
+	return LinkURLs(entries), nil
+}
+
+// ReadLinks reads link entries from a file, or from standard input when path is "-".
+func ReadLinks(path string) ([]LinkEntry, error) {
+	if path == "-" {
+		return ParseLinks(os.Stdin)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseLinks(file)
+}
+
+// ParseLinks reads link entries, one per line, skipping blank and # comment lines.
+//
+// A line that starts with a URL may carry options after it:
+//
+//	https://cloud.mail.ru/public/AbCd/EfGh dir=books include=*.pdf exclude=drafts/ priority=10 label="Books 2024"
+//
+// include and exclude may be repeated; a value with spaces is quoted.
+// Any other line is treated as free text, e.g. a chat log, markdown or HTML,
+// and every Cloud.Mail or Yandex.Disk public link in it is taken without options.
+// Links are de-duplicated by weblink, keeping the first occurrence, and
+// returned sorted by descending priority, in input order within a priority.
+func ParseLinks(r io.Reader) ([]LinkEntry, error) {
+	var (
+		entries []LinkEntry
+		seen    = make(map[string]bool)
+	)
+	add := func(entry LinkEntry) {
+		key := entry.URL
+		if id, err := cloudmail.LinkID(entry.URL); err == nil {
+			key = id
+		}
+		if !seen[key] {
+			seen[key] = true
+			entries = append(entries, entry)
+		}
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entry, ok, err := parseLinkLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", number, err)
+		}
+		if ok {
+			add(entry)
+			continue
+		}
+		for _, link := range ExtractLinks(line) {
+			add(LinkEntry{URL: link})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	slices.SortStableFunc(entries, func(a, b LinkEntry) int {
+		return b.Priority - a.Priority
+	})
+	return entries, nil
+}
+
+// ExtractLinks returns the Cloud.Mail and Yandex.Disk public links found in text, in order of appearance.
+// Links without a scheme get https://, and trailing punctuation is dropped.
+func ExtractLinks(text string) []string {
+	var links []string
+	for _, match := range publicLinkRE.FindAllString(text, -1) {
+		link := strings.TrimRight(match, ".,;:!?*_~")
+		if !strings.Contains(link, "://") {
+			link = "https://" + link
+		}
+		if _, err := cloudmail.LinkID(link); err == nil || yadisk.Match(link) {
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// LinkURLs returns the URLs of entries.
+func LinkURLs(entries []LinkEntry) []string {
+	links := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		links = append(links, entry.URL)
+	}
+	return links
+}
+
+// GroupLinks splits entries into runs of consecutive links with the same options.
+func GroupLinks(entries []LinkEntry) []LinkGroup {
+	var groups []LinkGroup
+	for _, entry := range entries {
+		options := entry
+		options.URL, options.Priority = "", 0
+		if last := len(groups) - 1; last >= 0 && sameOptions(groups[last].Options, options) {
+			groups[last].Links = append(groups[last].Links, entry.URL)
+			continue
+		}
+		groups = append(groups, LinkGroup{Options: options, Links: []string{entry.URL}})
+	}
+	return groups
+}
+
+func sameOptions(a, b LinkEntry) bool {
+	return a.Dir == b.Dir && a.Label == b.Label &&
+		slices.Equal(a.Include, b.Include) && slices.Equal(a.Exclude, b.Exclude)
+}
+
+// parseLinkLine parses "URL key=value ..." lines. It reports false for lines
+// that do not start with a URL or have words that are not options.
+func parseLinkLine(line string) (LinkEntry, bool, error) {
+	if words := strings.Fields(line); len(words) == 0 || !isURL(words[0]) {
+		return LinkEntry{}, false, nil
+	}
+	fields, err := splitFields(line)
+	if err != nil {
+		return LinkEntry{}, false, err
+	}
+
+	entry := LinkEntry{URL: fields[0]}
+	for _, field := range fields[1:] {
+		if strings.HasPrefix(field, "#") {
+			break
+		}
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return LinkEntry{}, false, nil
+		}
+		switch strings.ToLower(key) {
+		case "dir":
+			if entry.Dir = path.Clean(strings.ReplaceAll(value, "\\", "/")); entry.Dir == "." {
+				entry.Dir = ""
+			}
+			if entry.Dir != "" && !filepath.IsLocal(filepath.FromSlash(entry.Dir)) {
+				return LinkEntry{}, false, fmt.Errorf("dir %q escapes download directory", value)
+			}
+		case "include":
+			entry.Include = append(entry.Include, value)
+		case "exclude":
+			entry.Exclude = append(entry.Exclude, value)
+		case "priority":
+			if entry.Priority, err = strconv.Atoi(value); err != nil {
+				return LinkEntry{}, false, fmt.Errorf("invalid priority %q", value)
+			}
+		case "label":
+			entry.Label = value
+		default:
+			return LinkEntry{}, false, fmt.Errorf("unknown link option %q", key)
+		}
+	}
+	return entry, true, nil
+}
+
+func isURL(value string) bool {
+	lower := strings.ToLower(value)
+	return strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "http://")
+}
+
+// splitFields splits a line on spaces, keeping double-quoted parts together
+// and removing the quotes.
+func splitFields(line string) ([]string, error) {
+	var (
+		fields  []string
+		current strings.Builder
+		quoted  bool
+		started bool
+	)
+	for _, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			started = true
+		case !quoted && (r == ' ' || r == '\t'):
+			if started {
+				fields = append(fields, current.String())
+				current.Reset()
+				started = false
+			}
+		default:
+			current.WriteRune(r)
+			started = true
+		}
+	}
+	if quoted {
+		return nil, errors.New("unterminated quote")
+	}
+	if started {
+		fields = append(fields, current.String())
+	}
+	return fields, nil
+}
+
+// ForLink returns a client for the files of one link entry: Dir is joined to the
+// download directory, Include replaces and Exclude extends the filter, and Label
+// is set on files and progress events. Without options it returns c itself.
+// The derived client shares the rate limiter and the proxy pool of c.
+func (c *Client) ForLink(entry LinkEntry) (*Client, error) {
+	if entry.Dir == "" && entry.Label == "" && len(entry.Include) == 0 && len(entry.Exclude) == 0 {
+		return c, nil
+	}
+	cfg := c.cfg
+	if entry.Dir != "" {
+		if !filepath.IsLocal(entry.Dir) {
+			return nil, fmt.Errorf("link dir %q escapes download directory", entry.Dir)
+		}
+		cfg.DownloadDir = filepath.Join(cfg.DownloadDir, entry.Dir)
+	}
+	if len(entry.Include) > 0 {
+		cfg.Filter.Include = slices.Clone(entry.Include)
+	}
+	if len(entry.Exclude) > 0 {
+		cfg.Filter.Exclude = append(slices.Clone(cfg.Filter.Exclude), entry.Exclude...)
+	}
+	if err := cfg.Filter.Validate(); err != nil {
+		return nil, fmt.Errorf("link filter: %w", err)
+	}
+	client, err := New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	client.label = entry.Label
+	return client, nil
+}
+
+// DownloadEntries downloads link entries in order, each run of links with the
+// same options through one ForLink client. Progress events carry the label of
+// the current links; only the events of the last run finish the job.
+// With Config.ContinueOnError a failed run does not stop the next ones and all
+// failures are returned joined.
+func (c *Client) DownloadEntries(ctx context.Context, entries []LinkEntry, onProgress ProgressHandler) error {
+	groups := GroupLinks(entries)
+	if len(groups) == 0 {
+		return errors.New("empty link list")
+	}
+	var errs []error
+	for index, group := range groups {
+		handler := labelled(onProgress, group.Options.Label)
+		if index < len(groups)-1 && handler != nil {
+			handler = c.keepOpen(handler)
+		}
+		client, err := c.ForLink(group.Options)
+		if err == nil {
+			err = client.Download(ctx, group.Links, handler)
+		}
+		if err != nil {
+			if !c.cfg.ContinueOnError || ctx.Err() != nil {
+				return err
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// keepOpen keeps the job open after a run that is not the last one.
+// Errors still finish it unless ContinueOnError lets the next runs start.
+func (c *Client) keepOpen(onProgress ProgressHandler) ProgressHandler {
+	return func(event ProgressEvent) {
+		event.Done = false
+		if c.cfg.ContinueOnError {
+			event.Err = nil
+		}
+		onProgress(event)
+	}
+}
+
+// labelled sets label on events that do not carry one yet.
+func labelled(onProgress ProgressHandler, label string) ProgressHandler {
+	if onProgress == nil || label == "" {
+		return onProgress
+	}
+	return func(event ProgressEvent) {
+		if event.Label == "" {
+			event.Label = label
+		}
+		onProgress(event)
+	}
+}
@@ -0,0 +1,109 @@
+package cmrd
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseLinks(t *testing.T) {
+	input := `# books
+https://cloud.mail.ru/public/AAAA/1111 dir=books include=*.pdf include="*.djvu" label="Books 2024" # comment
+https://cloud.mail.ru/public/BBBB/2222 exclude=video/ priority=10
+https://cloud.mail.ru/public/AAAA/1111/sub dir=dupe
+see [the archive](https://cloud.mail.ru/public/CCCC/3333) and <a href="https://cloud.mail.ru/public/DDDD/4444">this</a>.
+[12:01] bob: cloud.mail.ru/public/EEEE/5555, thanks!
+https://cloud.mail.ru/public/BBBB/2222 also posted here
+`
+	entries, err := ParseLinks(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseLinks returned error: %v", err)
+	}
+	want := []LinkEntry{
+		{URL: "https://cloud.mail.ru/public/BBBB/2222", Exclude: []string{"video/"}, Priority: 10},
+		{URL: "https://cloud.mail.ru/public/AAAA/1111", Dir: "books", Include: []string{"*.pdf", "*.djvu"}, Label: "Books 2024"},
+		{URL: "https://cloud.mail.ru/public/AAAA/1111/sub", Dir: "dupe"},
+		{URL: "https://cloud.mail.ru/public/CCCC/3333"},
+		{URL: "https://cloud.mail.ru/public/DDDD/4444"},
+		{URL: "https://cloud.mail.ru/public/EEEE/5555"},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Fatalf("entries mismatch:\ngot=%+v\nwant=%+v", entries, want)
+	}
+
+	for _, bad := range []string{
+		"https://cloud.mail.ru/public/AAAA/1111 speed=1",
+		"https://cloud.mail.ru/public/AAAA/1111 priority=high",
+		`https://cloud.mail.ru/public/AAAA/1111 label="open`,
+		"https://cloud.mail.ru/public/AAAA/1111 dir=../up",
+	} {
+		if _, err := ParseLinks(strings.NewReader(bad)); err == nil || !strings.Contains(err.Error(), "line 1") {
+			t.Fatalf("expected line error for %q, got %v", bad, err)
+		}
+	}
+}
+
+func TestExtractLinks(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{text: "no links here", want: nil},
+		{text: "**https://cloud.mail.ru/public/AbCd/EfGh**", want: []string{"https://cloud.mail.ru/public/AbCd/EfGh"}},
+		{text: "(http://cloud.mail.ru/public/AbCd/EfGh/Season%202/)", want: []string{"http://cloud.mail.ru/public/AbCd/EfGh/Season%202/"}},
+		{text: "cloud.mail.ru/public/A/B; cloud.mail.ru/public/C/D.", want: []string{"https://cloud.mail.ru/public/A/B", "https://cloud.mail.ru/public/C/D"}},
+		{text: "https://cloud.mail.ru/home/private", want: nil},
+		{text: "see disk.yandex.ru/d/AbCd12 and <https://yadi.sk/i/XyZ>", want: []string{"https://disk.yandex.ru/d/AbCd12", "https://yadi.sk/i/XyZ"}},
+		{text: "https://disk.yandex.ru/client/disk", want: nil},
+	}
+	for _, test := range tests {
+		if got := ExtractLinks(test.text); !slices.Equal(got, test.want) {
+			t.Fatalf("extract mismatch for %q: got=%q want=%q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestGroupLinksAndForLink(t *testing.T) {
+	entries := []LinkEntry{
+		{URL: "a", Dir: "books", Priority: 2},
+		{URL: "b", Dir: "books"},
+		{URL: "c"},
+		{URL: "d", Dir: "books"},
+	}
+	groups := GroupLinks(entries)
+	if len(groups) != 3 || !slices.Equal(groups[0].Links, []string{"a", "b"}) || groups[2].Options.Dir != "books" {
+		t.Fatalf("unexpected groups: %+v", groups)
+	}
+
+	cfg := DefaultConfig()
+	cfg.DownloadDir = t.TempDir()
+	cfg.Backend = BackendNative
+	cfg.Filter.Exclude = []string{"*.tmp"}
+	client, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if same, err := client.ForLink(LinkEntry{URL: "a", Priority: 3}); err != nil || same != client {
+		t.Fatalf("expected the same client for a link without options, err=%v", err)
+	}
+
+	derived, err := client.ForLink(LinkEntry{Dir: "books", Include: []string{"*.pdf"}, Exclude: []string{"old/"}, Label: "Books"})
+	if err != nil {
+		t.Fatalf("ForLink returned error: %v", err)
+	}
+	got := derived.Config()
+	if !strings.HasSuffix(got.DownloadDir, "books") || !slices.Equal(got.Filter.Include, []string{"*.pdf"}) ||
+		!slices.Equal(got.Filter.Exclude, []string{"*.tmp", "old/"}) || derived.label != "Books" {
+		t.Fatalf("unexpected derived client: dir=%q filter=%+v label=%q", got.DownloadDir, got.Filter, derived.label)
+	}
+	if got.RateLimiter != client.Config().RateLimiter {
+		t.Fatalf("derived client does not share the rate limiter")
+	}
+	if !slices.Equal(client.Config().Filter.Exclude, []string{"*.tmp"}) {
+		t.Fatalf("ForLink changed the parent filter: %q", client.Config().Filter.Exclude)
+	}
+	if _, err := client.ForLink(LinkEntry{Dir: "../up"}); err == nil {
+		t.Fatalf("expected error for dir outside the download directory")
+	}
+}
@@ -0,0 +1,94 @@
+package cmrd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/jhonroun/cmrd/internal/pathpolicy"
+)
+
+// Path policies accepted by Config.PathPolicy.
+const (
+	// PathPolicyWindows replaces characters, device names and trailing dots or
+	// spaces that Windows rejects, and treats names case-insensitively.
+	PathPolicyWindows = "windows"
+	// PathPolicyPOSIX replaces only NUL bytes and limits names to 255 bytes.
+	PathPolicyPOSIX = "posix"
+	// PathPolicyPortable applies the Windows and POSIX rules and Unicode NFC normalization.
+	PathPolicyPortable = "portable"
+	// PathPolicyNone keeps remote names unchanged.
+	PathPolicyNone = "none"
+)
+
+// PathMapping describes a file whose local output differs from its remote names.
+type PathMapping struct {
+	RemotePath string `json:"remote_path"`
+	// Original is the output built from unchanged remote names.
+	Original string `json:"original"`
+	Output   string `json:"output"`
+}
+
+// PathMappings returns the files renamed by the path policy, in input order.
+func PathMappings(files []FileTask) []PathMapping {
+	var mappings []PathMapping
+	for _, file := range files {
+		if file.OriginalOutput == "" {
+			continue
+		}
+		mappings = append(mappings, PathMapping{
+			RemotePath: file.RemotePath,
+			Original:   file.OriginalOutput,
+			Output:     file.Output,
+		})
+	}
+	return mappings
+}
+
+// newNamer starts a batch of unique local outputs.
+func (c *Client) newNamer() *pathpolicy.Namer {
+	return pathpolicy.NewNamer(c.paths)
+}
+
+// UnsafePathError reports a file whose output would be written outside Config.DownloadDir.
+type UnsafePathError struct {
+	RemotePath string
+	Output     string
+}
+
+func (e *UnsafePathError) Error() string {
+	return fmt.Sprintf("unsafe output path %q for %s: escapes download directory", e.Output, e.RemotePath)
+}
+
+// CheckOutput returns *UnsafePathError unless the output stays inside the
+// download directory after cleaning. Both "/" and "\" are treated as separators
+// so names that are harmless on one system cannot escape on another.
+func CheckOutput(file FileTask) error {
+	output := file.Output
+	if !filepath.IsLocal(output) || !filepath.IsLocal(strings.ReplaceAll(output, `\`, "/")) {
+		return &UnsafePathError{RemotePath: file.RemotePath, Output: output}
+	}
+	return nil
+}
+
+// localFile converts a resolved file, assigns its local output and checks containment.
+func (c *Client) localFile(namer *pathpolicy.Namer, file FileTask) (FileTask, error) {
+	task := file
+	task.Label = c.label
+	task.Output = namer.Assign(file.Output)
+	if task.Output != file.Output {
+		task.OriginalOutput = file.Output
+	}
+	if err := CheckOutput(task); err != nil {
+		return FileTask{}, err
+	}
+	return task, nil
+}
+
+func newSanitizer(cfg Config) (pathpolicy.Sanitizer, error) {
+	policy, err := pathpolicy.ParsePolicy(cfg.PathPolicy)
+	if err != nil {
+		return pathpolicy.Sanitizer{}, err
+	}
+	return pathpolicy.NewSanitizer(policy, cfg.PathSubstitute)
+}
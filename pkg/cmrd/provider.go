@@ -0,0 +1,335 @@
+package cmrd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jhonroun/cmrd/internal/autoindex"
+	"github.com/jhonroun/cmrd/internal/cloudmail"
+	"github.com/jhonroun/cmrd/internal/proxypool"
+	"github.com/jhonroun/cmrd/internal/yadisk"
+)
+
+// Names of the built-in providers, as set in FileTask.Provider.
+const (
+	ProviderCloudMail = "cloudmail"
+	ProviderYandex    = "yadisk"
+	ProviderAutoindex = "autoindex"
+)
+
+// Provider resolves the links of one cloud service. The client routes every
+// link to the first provider whose Match accepts it: Config.Providers first,
+// then Cloud.Mail, Yandex.Disk public links and plain HTTP directory listings.
+// Links no provider accepts are handed to Cloud.Mail, which reports them as invalid.
+type Provider interface {
+	// Name identifies the provider in FileTask.Provider; it must be unique.
+	Name() string
+	// Match reports whether the provider handles link.
+	Match(link string) bool
+	// Walk lists a link. It reports every file to file and, when dir is not
+	// nil, every folder before its contents. Outputs are slash-separated and
+	// start with the name of the linked folder; a linked file is reported with
+	// its name. The client applies the path policy to outputs afterwards.
+	// Walk returns nil when a callback returns false.
+	Walk(ctx context.Context, link string, file func(FileTask) bool, dir func(Folder) bool) error
+	// Refresh returns the files, listed by Walk earlier, with fresh download
+	// URLs and mirrors, in the same order.
+	Refresh(ctx context.Context, files []FileTask) ([]FileTask, error)
+}
+
+// Folder is a folder reported by Provider.Walk.
+type Folder struct {
+	Output     string `json:"output"`
+	RemotePath string `json:"remote_path"`
+	// Empty reports that the folder has no entries on the remote side, so
+	// ResolveTree keeps it even when Config.Filter is set.
+	Empty bool `json:"empty,omitempty"`
+}
+
+// newProviders returns the providers of a client in routing order; the
+// built-in ones apply the filter of the resolver while walking.
+func newProviders(cfg Config, resolver *cloudmail.Resolver, proxies *proxypool.Pool) ([]Provider, error) {
+	client := cfg.HTTPClient
+	if client == nil {
+		var err error
+		if client, err = newHTTPClient(cfg.HTTPTimeout, proxies); err != nil {
+			return nil, err
+		}
+	}
+
+	providers := make([]Provider, 0, len(cfg.Providers)+3)
+	seen := make(map[string]bool)
+	for _, provider := range cfg.Providers {
+		if provider == nil {
+			continue
+		}
+		providers = append(providers, filteredProvider{Provider: provider, keep: resolver.Keep})
+	}
+	providers = append(providers,
+		cloudMailProvider{resolver: resolver},
+		yandexProvider{client: yadisk.New(yadisk.Config{
+			HTTPClient: client,
+			APIBaseURL: cfg.YandexAPIBaseURL,
+			Keep:       resolver.Keep,
+		})},
+		autoindexProvider{client: autoindex.New(autoindex.Config{
+			HTTPClient: client,
+			Keep:       resolver.Keep,
+		})},
+	)
+	for _, provider := range providers {
+		name := provider.Name()
+		if name == "" || seen[name] {
+			return nil, fmt.Errorf("provider name %q is empty or used twice", name)
+		}
+		seen[name] = true
+	}
+	return providers, nil
+}
+
+func newHTTPClient(timeout time.Duration, proxies *proxypool.Pool) (*http.Client, error) {
+	transport, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return nil, errors.New("unexpected default transport type")
+	}
+	var roundTripper http.RoundTripper = transport.Clone()
+	if proxies != nil {
+		roundTripper = proxies.Transport(transport.Clone())
+	}
+	return &http.Client{Timeout: timeout, Transport: roundTripper}, nil
+}
+
+// provider returns the provider that handles link.
+func (c *Client) provider(link string) Provider {
+	for _, provider := range c.providers {
+		if provider.Match(link) {
+			return provider
+		}
+	}
+	return cloudMailProvider{resolver: c.resolver}
+}
+
+// providerNamed returns the provider that resolved files with the given FileTask.Provider.
+func (c *Client) providerNamed(name string) (Provider, error) {
+	if name == "" {
+		name = ProviderCloudMail
+	}
+	for _, provider := range c.providers {
+		if provider.Name() == name {
+			return provider, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown provider %q", name)
+}
+
+// walkLink lists one link with its provider and marks files with the provider name.
+func (c *Client) walkLink(ctx context.Context, link string, file func(FileTask) bool, dir func(Folder) bool) error {
+	provider := c.provider(link)
+	name := provider.Name()
+	if name == ProviderCloudMail {
+		name = ""
+	}
+	return provider.Walk(ctx, link, func(task FileTask) bool {
+		task.Provider = name
+		return file(task)
+	}, dir)
+}
+
+// linkStream yields the files of one link as soon as they are discovered.
+// An error is yielded inline and ends the stream.
+func (c *Client) linkStream(ctx context.Context, link string) iter.Seq2[FileTask, error] {
+	return func(yield func(FileTask, error) bool) {
+		if err := c.walkLink(ctx, link, func(task FileTask) bool {
+			return yield(task, nil)
+		}, nil); err != nil {
+			yield(FileTask{}, err)
+		}
+	}
+}
+
+// refreshURLs refreshes the download URLs of files through the providers that resolved them.
+func (c *Client) refreshURLs(ctx context.Context, files []FileTask) ([]FileTask, error) {
+	refreshed := make([]FileTask, len(files))
+	groups := make(map[string][]int)
+	var order []string
+	for index, file := range files {
+		if _, ok := groups[file.Provider]; !ok {
+			order = append(order, file.Provider)
+		}
+		groups[file.Provider] = append(groups[file.Provider], index)
+	}
+	for _, name := range order {
+		provider, err := c.providerNamed(name)
+		if err != nil {
+			return nil, err
+		}
+		indexes := groups[name]
+		subset := make([]FileTask, len(indexes))
+		for i, index := range indexes {
+			subset[i] = files[index]
+		}
+		fresh, err := provider.Refresh(ctx, subset)
+		if err != nil {
+			return nil, err
+		}
+		if len(fresh) != len(subset) {
+			return nil, fmt.Errorf("provider %s refreshed %d of %d files", provider.Name(), len(fresh), len(subset))
+		}
+		for i, index := range indexes {
+			refreshed[index] = fresh[i]
+		}
+	}
+	return refreshed, nil
+}
+
+// filteredProvider applies Config.Filter to the walk of a custom provider.
+type filteredProvider struct {
+	Provider
+	keep func(rel string, size int64, dir bool) bool
+}
+
+func (p filteredProvider) Walk(ctx context.Context, link string, file func(FileTask) bool, dir func(Folder) bool) error {
+	// Keep checks the parent folders of a file too, so files below a skipped
+	// folder are dropped even though the provider lists them.
+	var walkDir func(Folder) bool
+	if dir != nil {
+		walkDir = func(folder Folder) bool {
+			if rel, ok := linkRelative(folder.Output); ok && !p.keep(rel, 0, true) {
+				return true
+			}
+			return dir(folder)
+		}
+	}
+	return p.Provider.Walk(ctx, link, func(task FileTask) bool {
+		rel, ok := linkRelative(task.Output)
+		if !ok {
+			rel = task.Output
+		}
+		return !p.keep(rel, task.Size, false) || file(task)
+	}, walkDir)
+}
+
+// linkRelative strips the linked folder from an output; it reports false for
+// outputs of a linked file or of the linked folder itself.
+func linkRelative(output string) (string, bool) {
+	_, rel, ok := strings.Cut(output, "/")
+	return rel, ok
+}
+
+// cloudMailProvider resolves Cloud.Mail public and private links.
+type cloudMailProvider struct {
+	resolver *cloudmail.Resolver
+}
+
+func (p cloudMailProvider) Name() string { return ProviderCloudMail }
+
+func (p cloudMailProvider) Match(link string) bool {
+	_, err := cloudmail.LinkID(link)
+	return err == nil || cloudmail.IsPrivateLink(link)
+}
+
+func (p cloudMailProvider) Walk(ctx context.Context, link string, file func(FileTask) bool, dir func(Folder) bool) error {
+	var walkDir func(cloudmail.Dir) bool
+	if dir != nil {
+		walkDir = func(folder cloudmail.Dir) bool {
+			return dir(Folder{Output: folder.Output, RemotePath: folder.RemotePath, Empty: folder.Empty})
+		}
+	}
+	return p.resolver.WalkLink(ctx, link, func(found cloudmail.File) bool {
+		return file(fromInternalFile(found))
+	}, walkDir)
+}
+
+func (p cloudMailProvider) Refresh(ctx context.Context, files []FileTask) ([]FileTask, error) {
+	refreshed, err := p.resolver.RefreshURLs(ctx, toInternalFiles(files))
+	if err != nil {
+		return nil, err
+	}
+	result := make([]FileTask, len(files))
+	for index, file := range files {
+		file.URL, file.Mirrors = refreshed[index].URL, refreshed[index].Mirrors
+		result[index] = file
+	}
+	return result, nil
+}
+
+// yandexProvider resolves Yandex.Disk public links.
+type yandexProvider struct {
+	client *yadisk.Client
+}
+
+func (p yandexProvider) Name() string { return ProviderYandex }
+
+func (p yandexProvider) Match(link string) bool { return yadisk.Match(link) }
+
+func (p yandexProvider) Walk(ctx context.Context, link string, file func(FileTask) bool, dir func(Folder) bool) error {
+	var walkDir func(yadisk.Dir) bool
+	if dir != nil {
+		walkDir = func(folder yadisk.Dir) bool {
+			return dir(Folder{Output: folder.Output, RemotePath: folder.RemotePath, Empty: folder.Empty})
+		}
+	}
+	return p.client.Walk(ctx, link, func(found yadisk.File) bool {
+		return file(FileTask{
+			URL:        found.URL,
+			Output:     found.Output,
+			RemotePath: found.RemotePath,
+			Size:       found.Size,
+			ModTime:    found.ModTime,
+		})
+	}, walkDir)
+}
+
+func (p yandexProvider) Refresh(ctx context.Context, files []FileTask) ([]FileTask, error) {
+	remotePaths := make([]string, 0, len(files))
+	for _, file := range files {
+		remotePaths = append(remotePaths, file.RemotePath)
+	}
+	urls, err := p.client.Refresh(ctx, remotePaths)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]FileTask, len(files))
+	for index, file := range files {
+		file.URL, file.Mirrors = urls[index], nil
+		result[index] = file
+	}
+	return result, nil
+}
+
+// autoindexProvider resolves plain HTTP directory listings.
+type autoindexProvider struct {
+	client *autoindex.Client
+}
+
+func (p autoindexProvider) Name() string { return ProviderAutoindex }
+
+func (p autoindexProvider) Match(link string) bool { return autoindex.Match(link) }
+
+func (p autoindexProvider) Walk(ctx context.Context, link string, file func(FileTask) bool, dir func(Folder) bool) error {
+	var walkDir func(autoindex.Dir) bool
+	if dir != nil {
+		walkDir = func(folder autoindex.Dir) bool {
+			return dir(Folder{Output: folder.Output, RemotePath: folder.RemotePath, Empty: folder.Empty})
+		}
+	}
+	return p.client.Walk(ctx, link, func(found autoindex.File) bool {
+		return file(FileTask{
+			URL:        found.URL,
+			Output:     found.Output,
+			RemotePath: found.RemotePath,
+			Size:       found.Size,
+			ModTime:    found.ModTime,
+		})
+	}, walkDir)
+}
+
+// Refresh returns the files unchanged: listing URLs do not expire.
+func (p autoindexProvider) Refresh(ctx context.Context, files []FileTask) ([]FileTask, error) {
+	return files, nil
+}
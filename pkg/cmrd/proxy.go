@@ -0,0 +1,79 @@
+package cmrd
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jhonroun/cmrd/internal/proxypool"
+)
+
+// Proxy selection strategies accepted by Config.ProxyStrategy.
+const (
+	ProxyRoundRobin    = proxypool.RoundRobin
+	ProxyLeastFailures = proxypool.LeastFailures
+)
+
+// defaultProxyCheckURL is requested through every proxy by ProxyPool.Watch.
+const defaultProxyCheckURL = "https://cloud.mail.ru/"
+
+// ProxyPool spreads resolver and download requests over several proxies and
+// evicts the ones that keep failing. Pass the same pool in Config.ProxyPool to
+// share it between clients.
+type ProxyPool struct {
+	pool     *proxypool.Pool
+	checkURL string
+}
+
+// NewProxyPool builds a pool from Config.Proxy, Config.Proxies, Config.ProxyAuth
+// and Config.ProxyStrategy. It returns nil when no proxy is configured.
+func NewProxyPool(cfg Config) (*ProxyPool, error) {
+	proxies := append([]string{cfg.Proxy}, cfg.Proxies...)
+	if !slices.ContainsFunc(proxies, func(proxy string) bool { return strings.TrimSpace(proxy) != "" }) {
+		return nil, nil
+	}
+
+	pool, err := proxypool.New(proxypool.Config{
+		Proxies:  proxies,
+		Auth:     cfg.ProxyAuth,
+		Strategy: cfg.ProxyStrategy,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy config: %w", err)
+	}
+	checkURL := cfg.APIBaseURL
+	if checkURL == "" {
+		checkURL = defaultProxyCheckURL
+	}
+	return &ProxyPool{pool: pool, checkURL: checkURL}, nil
+}
+
+// ReadProxyFile reads proxies from a file, one per line, skipping blank and # comment lines.
+func ReadProxyFile(path string) ([]string, error) {
+	return proxypool.ReadFile(path)
+}
+
+// Watch checks every proxy against Cloud.Mail each interval until ctx is done:
+// proxies that fail are evicted, recovered ones return to the rotation.
+func (p *ProxyPool) Watch(ctx context.Context, interval time.Duration) {
+	p.pool.Watch(ctx, p.checkURL, interval)
+}
+
+// Healthy returns the number of proxies currently in the rotation.
+func (p *ProxyPool) Healthy() int {
+	return p.pool.Healthy()
+}
+
+// Len returns the number of proxies in the pool.
+func (p *ProxyPool) Len() int {
+	return p.pool.Len()
+}
+
+func (p *ProxyPool) internal() *proxypool.Pool {
+	if p == nil {
+		return nil
+	}
+	return p.pool
+}
@@ -0,0 +1,29 @@
+package cmrd
+
+import "github.com/jhonroun/cmrd/internal/cloudmail"
+
+// DefaultRateBurst is the number of API requests allowed at once when Config.RateLimit is set.
+const DefaultRateBurst = 5
+
+// RateLimiter is a token-bucket limiter for Cloud.Mail API requests.
+// Pass the same RateLimiter in Config.RateLimiter to share it between clients.
+type RateLimiter struct {
+	limiter *cloudmail.Limiter
+}
+
+// NewRateLimiter returns a limiter for rate requests per second with the given burst,
+// or nil when rate is zero or less.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	limiter := cloudmail.NewLimiter(rate, burst)
+	if limiter == nil {
+		return nil
+	}
+	return &RateLimiter{limiter: limiter}
+}
+
+func (l *RateLimiter) internal() *cloudmail.Limiter {
+	if l == nil {
+		return nil
+	}
+	return l.limiter
+}
@@ -0,0 +1,112 @@
+package cmrd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/jhonroun/cmrd/internal/aria2"
+	"github.com/jhonroun/cmrd/internal/httpdl"
+)
+
+// DefaultURLRefreshes is the default number of times expired download URLs are refreshed.
+const DefaultURLRefreshes = 3
+
+// refreshExpired handles a failed download whose URLs were rejected by the
+// download hosts: it resolves fresh URLs for the files that are not finished
+// yet and downloads only those, up to Config.URLRefreshes times. backendProgress
+// holds back expired-link failures, so refreshExpired reports the final one.
+func (c *Client) refreshExpired(ctx context.Context, files []FileTask, err error, onProgress ProgressHandler) error {
+	err = c.retryExpired(ctx, files, err, onProgress)
+	if err != nil && onProgress != nil && c.holdsExpired(err) {
+		pending := len(c.unfinished(files))
+		onProgress(ProgressEvent{
+			Phase:          "download",
+			Message:        err.Error(),
+			TotalFiles:     len(files),
+			DoneFiles:      len(files) - pending,
+			RemainingFiles: pending,
+			Done:           true,
+			Err:            err,
+		})
+	}
+	return err
+}
+
+// holdsExpired reports whether backendProgress holds back the failure err.
+func (c *Client) holdsExpired(err error) bool {
+	return c.cfg.URLRefreshes > 0 && linksExpired(err)
+}
+
+func (c *Client) retryExpired(ctx context.Context, files []FileTask, err error, onProgress ProgressHandler) error {
+	// Fresh URLs go into a copy, files may belong to the caller of DownloadResolved.
+	files = slices.Clone(files)
+	for attempt := 1; err != nil && attempt <= c.cfg.URLRefreshes && linksExpired(err); attempt++ {
+		if ctx.Err() != nil {
+			return err
+		}
+		pending := c.unfinished(files)
+		if len(pending) == 0 {
+			return nil
+		}
+		if onProgress != nil {
+			onProgress(ProgressEvent{
+				Phase:          "download",
+				Message:        fmt.Sprintf("download URLs expired, refreshing %d files (attempt %d/%d)", len(pending), attempt, c.cfg.URLRefreshes),
+				TotalFiles:     len(files),
+				DoneFiles:      len(files) - len(pending),
+				RemainingFiles: len(pending),
+			})
+		}
+
+		subset := make([]FileTask, len(pending))
+		for i, index := range pending {
+			subset[i] = files[index]
+		}
+		refreshed, refreshErr := c.refreshURLs(ctx, subset)
+		if refreshErr != nil {
+			return errors.Join(err, fmt.Errorf("refresh download URLs: %w", refreshErr))
+		}
+		for i, index := range pending {
+			files[index].URL = refreshed[i].URL
+			files[index].Mirrors = refreshed[i].Mirrors
+			subset[i] = files[index]
+		}
+		err = c.backend.Download(ctx, subset, c.backendProgress(onProgress))
+	}
+	return err
+}
+
+// linksExpired reports whether a backend error looks like rejected download URLs.
+func linksExpired(err error) bool {
+	return httpdl.IsExpiredLink(err) || aria2.IsExpiredLink(err)
+}
+
+// unfinished returns the indexes of files that are missing on disk, have the
+// wrong size or still have a partial-download sidecar next to them.
+func (c *Client) unfinished(files []FileTask) []int {
+	var pending []int
+	for index, file := range files {
+		target := filepath.Join(c.cfg.DownloadDir, filepath.FromSlash(file.Output))
+		if !fileFinished(target, file.Size) {
+			pending = append(pending, index)
+		}
+	}
+	return pending
+}
+
+func fileFinished(target string, size int64) bool {
+	info, err := os.Stat(target)
+	if err != nil || info.IsDir() || (size > 0 && info.Size() != size) {
+		return false
+	}
+	for _, sidecar := range []string{".aria2", ".part"} {
+		if _, err := os.Stat(target + sidecar); err == nil {
+			return false
+		}
+	}
+	return true
+}
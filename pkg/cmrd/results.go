@@ -0,0 +1,69 @@
+package cmrd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// LinkResult is the outcome of resolving one input link.
+type LinkResult struct {
+	Link     string
+	Files    []FileTask
+	Err      error
+	Duration time.Duration
+}
+
+// LinkError is an error bound to one input link.
+type LinkError struct {
+	Link string
+	Err  error
+}
+
+func (e LinkError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Link, e.Err)
+}
+
+func (e LinkError) Unwrap() error {
+	return e.Err
+}
+
+// ResolveError aggregates links that failed to resolve while the rest of the batch continued.
+type ResolveError struct {
+	Links []LinkError
+}
+
+func (e *ResolveError) Error() string {
+	parts := make([]string, 0, len(e.Links))
+	for _, link := range e.Links {
+		parts = append(parts, link.Error())
+	}
+	return fmt.Sprintf("resolve failed for %d links: %s", len(e.Links), strings.Join(parts, "; "))
+}
+
+func (e *ResolveError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Links))
+	for _, link := range e.Links {
+		errs = append(errs, link)
+	}
+	return errs
+}
+
+// SplitResults returns files of resolved links and a *ResolveError for failed ones.
+func SplitResults(results []LinkResult) ([]FileTask, error) {
+	var (
+		files  []FileTask
+		failed []LinkError
+	)
+	for _, result := range results {
+		if result.Err != nil {
+			failed = append(failed, LinkError{Link: result.Link, Err: result.Err})
+			continue
+		}
+		files = append(files, result.Files...)
+	}
+	if len(failed) == 0 {
+		return files, nil
+	}
+	return files, &ResolveError{Links: failed}
+}
@@ -0,0 +1,81 @@
+package cmrd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jhonroun/cmrd/internal/cloudmail"
+)
+
+// Environment variables read by SessionFromEnv.
+const (
+	// EnvSession holds the session cookies themselves.
+	EnvSession = "CMRD_SESSION"
+	// EnvSessionFile holds the path of a session cookies file.
+	EnvSessionFile = "CMRD_SESSION_FILE"
+)
+
+// Session is a logged-in Cloud.Mail browser session. It lets a client list
+// and download private folders given as https://cloud.mail.ru/home/... links.
+// Cookies are sent only to hosts of their domain and never printed: String
+// and error messages do not include them.
+type Session struct {
+	session *cloudmail.Session
+}
+
+// ParseSession reads cookies in the Netscape cookies.txt format exported by
+// browsers and curl, or one "name=value; name2=value2" Cookie header line.
+func ParseSession(text string) (*Session, error) {
+	session, err := cloudmail.ParseSession(text)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{session: session}, nil
+}
+
+// LoadSession reads a session cookies file, see ParseSession.
+func LoadSession(path string) (*Session, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read session: %w", err)
+	}
+	session, err := ParseSession(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return session, nil
+}
+
+// SessionFromEnv reads the session from CMRD_SESSION or, when it is empty,
+// from the file named by CMRD_SESSION_FILE. It returns nil when neither is set.
+func SessionFromEnv() (*Session, error) {
+	if text := os.Getenv(EnvSession); strings.TrimSpace(text) != "" {
+		session, err := ParseSession(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", EnvSession, err)
+		}
+		return session, nil
+	}
+	if path := strings.TrimSpace(os.Getenv(EnvSessionFile)); path != "" {
+		return LoadSession(path)
+	}
+	return nil, nil
+}
+
+// String hides the cookie values.
+func (s *Session) String() string {
+	return s.internal().String()
+}
+
+// GoString hides the cookie values from %#v.
+func (s *Session) GoString() string {
+	return s.String()
+}
+
+func (s *Session) internal() *cloudmail.Session {
+	if s == nil {
+		return nil
+	}
+	return s.session
+}
@@ -0,0 +1,230 @@
+package cmrd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/jhonroun/cmrd/internal/pathpolicy"
+)
+
+// Node is a folder or a file of a resolved tree.
+type Node struct {
+	// Name is the local name of the node; empty for the tree root.
+	Name string `json:"name"`
+	// Path is the local path relative to Config.DownloadDir, as in FileTask.Output.
+	Path       string `json:"path"`
+	RemotePath string `json:"remote_path,omitempty"`
+	Dir        bool   `json:"dir"`
+	// Size is the file size, or the total size of all files below a folder.
+	Size int64 `json:"size"`
+	// Files and Folders count all files and folders below a folder.
+	Files   int `json:"files,omitempty"`
+	Folders int `json:"folders,omitempty"`
+	// File is the download target of a file node.
+	File     *FileTask `json:"file,omitempty"`
+	Children []*Node   `json:"children,omitempty"`
+}
+
+// Walk calls fn for the node and everything below it in resolve order.
+// Returning fs.SkipDir from a folder skips its contents, fs.SkipAll stops the walk.
+func (n *Node) Walk(fn func(*Node) error) error {
+	err := n.walk(fn)
+	if errors.Is(err, fs.SkipAll) {
+		return nil
+	}
+	return err
+}
+
+func (n *Node) walk(fn func(*Node) error) error {
+	if err := fn(n); err != nil {
+		if errors.Is(err, fs.SkipDir) && n.Dir {
+			return nil
+		}
+		return err
+	}
+	for _, child := range n.Children {
+		if err := child.walk(fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Tree is the folder structure of resolved links. The root is an unnamed
+// folder that holds the top-level folder or file of every link.
+type Tree struct {
+	Root *Node `json:"root"`
+}
+
+// Walk calls fn for every node of the tree, see Node.Walk.
+func (t *Tree) Walk(fn func(*Node) error) error {
+	return t.Root.Walk(fn)
+}
+
+// Find returns the node with the given local path, or nil.
+func (t *Tree) Find(local string) *Node {
+	local = strings.Trim(path.Clean("/"+local), "/")
+	if local == "" {
+		return t.Root
+	}
+	var found *Node
+	_ = t.Walk(func(node *Node) error {
+		if node.Path == local {
+			found = node
+			return fs.SkipAll
+		}
+		if node.Dir && node != t.Root && !strings.HasPrefix(local, node.Path+"/") {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	return found
+}
+
+// Files returns the download targets of the tree in resolve order.
+func (t *Tree) Files() []FileTask {
+	var files []FileTask
+	_ = t.Walk(func(node *Node) error {
+		if node.File != nil {
+			files = append(files, *node.File)
+		}
+		return nil
+	})
+	return files
+}
+
+// Dirs returns the local paths of all folders, including empty ones.
+func (t *Tree) Dirs() []string {
+	var dirs []string
+	_ = t.Walk(func(node *Node) error {
+		if node.Dir && node != t.Root {
+			dirs = append(dirs, node.Path)
+		}
+		return nil
+	})
+	return dirs
+}
+
+// ResolveTree resolves links into a folder tree. Local paths are assigned as
+// by Resolve, so Tree.Files matches its result. Folders are kept even when
+// empty, except folders left without files by Config.Filter; folders that
+// are empty on the remote side stay.
+func (c *Client) ResolveTree(ctx context.Context, links []string) (*Tree, error) {
+	builder := &treeBuilder{
+		client: c,
+		namer:  c.newNamer(),
+		root:   &Node{Dir: true},
+		dirs:   make(map[string]*Node),
+		empty:  make(map[*Node]bool),
+	}
+	for _, raw := range links {
+		link := strings.TrimSpace(raw)
+		if link == "" {
+			continue
+		}
+		err := c.walkLink(ctx, link, builder.addFile, builder.addDir)
+		if err == nil {
+			err = builder.err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("resolve %q: %w", link, err)
+		}
+	}
+
+	tree := &Tree{Root: builder.root}
+	summarize(tree.Root, !c.cfg.Filter.IsZero(), builder.empty)
+	return tree, nil
+}
+
+type treeBuilder struct {
+	client *Client
+	namer  *pathpolicy.Namer
+	root   *Node
+	// dirs maps local folder paths to their nodes.
+	dirs map[string]*Node
+	// empty holds folders reported empty by the provider.
+	empty map[*Node]bool
+	err   error
+}
+
+func (b *treeBuilder) addDir(dir Folder) bool {
+	local := b.namer.AssignDir(dir.Output)
+	if err := CheckOutput(FileTask{Output: local, RemotePath: dir.RemotePath}); err != nil {
+		b.err = err
+		return false
+	}
+	node := b.folder(local)
+	node.RemotePath = dir.RemotePath
+	if dir.Empty {
+		b.empty[node] = true
+	}
+	return true
+}
+
+func (b *treeBuilder) addFile(file FileTask) bool {
+	task, err := b.client.localFile(b.namer, file)
+	if err != nil {
+		b.err = err
+		return false
+	}
+	parent := b.folder(parentPath(task.Output))
+	parent.Children = append(parent.Children, &Node{
+		Name:       path.Base(task.Output),
+		Path:       task.Output,
+		RemotePath: task.RemotePath,
+		Size:       task.Size,
+		File:       &task,
+	})
+	return true
+}
+
+// folder returns the node of a local folder, creating missing parents.
+func (b *treeBuilder) folder(local string) *Node {
+	if local == "" {
+		return b.root
+	}
+	if node, ok := b.dirs[local]; ok {
+		return node
+	}
+	parent := b.folder(parentPath(local))
+	node := &Node{Name: path.Base(local), Path: local, Dir: true}
+	parent.Children = append(parent.Children, node)
+	b.dirs[local] = node
+	return node
+}
+
+func parentPath(local string) string {
+	parent := path.Dir(local)
+	if parent == "." {
+		return ""
+	}
+	return parent
+}
+
+// summarize fills folder totals and, when pruneEmpty is set, drops folders
+// left without files and subfolders, unless they are in remoteEmpty.
+func summarize(node *Node, pruneEmpty bool, remoteEmpty map[*Node]bool) {
+	node.Size, node.Files, node.Folders = 0, 0, 0
+	children := node.Children[:0]
+	for _, child := range node.Children {
+		if !child.Dir {
+			node.Size += child.Size
+			node.Files++
+			children = append(children, child)
+			continue
+		}
+		summarize(child, pruneEmpty, remoteEmpty)
+		if pruneEmpty && child.Files == 0 && len(child.Children) == 0 && !remoteEmpty[child] {
+			continue
+		}
+		node.Size += child.Size
+		node.Files += child.Files
+		node.Folders += child.Folders + 1
+		children = append(children, child)
+	}
+	node.Children = children
+}
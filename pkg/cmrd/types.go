@@ -1,9 +1,32 @@
 package cmrd
 
+import "time"
+
 // FileTask represents one download target.
 type FileTask struct {
-	URL    string `json:"url"`
-	Output string `json:"output"`
+	URL        string    `json:"url"`
+	Output     string    `json:"output"`
+	RemotePath string    `json:"remote_path"`
+	Size       int64     `json:"size"`
+	Hash       string    `json:"hash,omitempty"`
+	ModTime    time.Time `json:"mtime"`
+	// Mirrors are URLs of the same file on other download hosts, tried when URL fails.
+	Mirrors []string `json:"mirrors,omitempty"`
+	// OriginalOutput is the output before the path policy changed it; empty when unchanged.
+	OriginalOutput string `json:"original_output,omitempty"`
+	// Label is the label of the link the file was resolved from, see LinkEntry.
+	Label string `json:"label,omitempty"`
+	// Provider names the provider that resolved the file, see Provider; empty for Cloud.Mail.
+	Provider string `json:"provider,omitempty"`
+}
+
+// TotalSize returns the summed size of all files.
+func TotalSize(files []FileTask) int64 {
+	var total int64
+	for _, file := range files {
+		total += file.Size
+	}
+	return total
 }
 
 // ProgressEvent is emitted during resolve/download lifecycle.
@@ -17,7 +40,42 @@ type ProgressEvent struct {
 	CurrentFile    string  `json:"current_file"`
 	Done           bool    `json:"done"`
 	Err            error   `json:"-"`
+	// FileErrors lists per-file failures, e.g. integrity check errors.
+	FileErrors []FileError `json:"-"`
+	// PathMappings lists files renamed by the path policy; set on the "resolve complete" event.
+	PathMappings []PathMapping `json:"-"`
+	// RateLimitWait is the total time resolve has waited on the API rate limiter so far.
+	RateLimitWait time.Duration `json:"rate_limit_wait"`
+	// Label is the label of the links being processed, see Client.DownloadEntries.
+	Label string `json:"label,omitempty"`
+	// Files holds the exact state of every file of the batch; set only by the
+	// aria2 backend in JSON-RPC mode, see Config.Aria2Console.
+	Files []FileProgress `json:"files,omitempty"`
+	// Speed is the total download speed in bytes per second; set together with Files.
+	Speed int64 `json:"speed,omitempty"`
+}
+
+// File states reported in FileProgress.State.
+const (
+	FileStateWaiting  = "waiting"
+	FileStateActive   = "active"
+	FileStateComplete = "complete"
+	FileStateError    = "error"
+)
+
+// FileProgress is the download state of one file.
+type FileProgress struct {
+	Output string `json:"output"`
+	// State is FileStateWaiting, FileStateActive, FileStateComplete or FileStateError.
+	State string `json:"state"`
+	// Size is 0 while the size is unknown.
+	Size       int64 `json:"size"`
+	Downloaded int64 `json:"downloaded"`
+	// Speed is the download speed in bytes per second.
+	Speed int64 `json:"speed"`
+	Err   error `json:"-"`
 }
 
-// ProgressHandler receives progress events.
+// ProgressHandler receives progress events. The client never calls it
+// concurrently, so it does not have to be goroutine-safe.
 type ProgressHandler func(ProgressEvent)
@@ -0,0 +1,114 @@
+package cmrd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jhonroun/cmrd/internal/cloudmail"
+)
+
+var (
+	// ErrHashMismatch reports local content that does not match the remote hash.
+	ErrHashMismatch = errors.New("hash mismatch")
+	// ErrSizeMismatch reports a local file with unexpected size.
+	ErrSizeMismatch = errors.New("size mismatch")
+)
+
+// FileError is an error bound to one file output path.
+type FileError struct {
+	Output string
+	Err    error
+}
+
+func (e FileError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Output, e.Err)
+}
+
+func (e FileError) Unwrap() error {
+	return e.Err
+}
+
+// VerifyError aggregates per-file verification failures.
+type VerifyError struct {
+	Files []FileError
+}
+
+func (e *VerifyError) Error() string {
+	parts := make([]string, 0, len(e.Files))
+	for _, file := range e.Files {
+		parts = append(parts, file.Error())
+	}
+	return fmt.Sprintf("verification failed for %d files: %s", len(e.Files), strings.Join(parts, "; "))
+}
+
+func (e *VerifyError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Files))
+	for _, file := range e.Files {
+		errs = append(errs, file)
+	}
+	return errs
+}
+
+// LocalPath returns the local destination path of a file task.
+func (c *Client) LocalPath(file FileTask) string {
+	return filepath.Join(c.cfg.DownloadDir, filepath.FromSlash(file.Output))
+}
+
+// Verify checks that files exist in DownloadDir and match remote size and hash.
+// It returns *VerifyError when at least one file fails the check.
+func (c *Client) Verify(ctx context.Context, files []FileTask, onProgress ProgressHandler) error {
+	var failed []FileError
+	for index, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if onProgress != nil {
+			onProgress(ProgressEvent{
+				Phase:          "verify",
+				Percent:        float64(index) * 100 / float64(len(files)),
+				Message:        "verifying " + file.Output,
+				TotalFiles:     len(files),
+				DoneFiles:      index,
+				RemainingFiles: len(files) - index,
+				CurrentFile:    file.Output,
+			})
+		}
+		if err := verifyFile(ctx, c.LocalPath(file), file); err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			failed = append(failed, FileError{Output: file.Output, Err: err})
+		}
+	}
+
+	if len(failed) == 0 {
+		return nil
+	}
+	return &VerifyError{Files: failed}
+}
+
+func verifyFile(ctx context.Context, path string, file FileTask) error {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	// Size 0 without a hash means a provider did not report the size.
+	if (file.Size > 0 || file.Hash != "") && stat.Size() != file.Size {
+		return fmt.Errorf("%w: got %d bytes, want %d", ErrSizeMismatch, stat.Size(), file.Size)
+	}
+	if file.Hash == "" {
+		return nil
+	}
+	sum, err := cloudmail.HashFile(ctx, path)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(sum, file.Hash) {
+		return fmt.Errorf("%w: got %s, want %s", ErrHashMismatch, sum, strings.ToUpper(file.Hash))
+	}
+	return nil
+}